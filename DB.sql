@@ -180,4 +180,385 @@ CREATE INDEX IF NOT EXISTS push_interval
 CREATE INDEX IF NOT EXISTS user_sensor
     ON public.push_settings USING btree
     (user_id ASC NULLS LAST, sensor_id ASC NULLS LAST)
-    TABLESPACE pg_default;
\ No newline at end of file
+    TABLESPACE pg_default;
+
+-- Migration 1: channel sources
+
+ALTER TABLE public.channels
+    ADD COLUMN IF NOT EXISTS source character varying(50) COLLATE pg_catalog."default" NOT NULL DEFAULT 'thingspeak';
+
+CREATE INDEX IF NOT EXISTS channels_source
+    ON public.channels USING btree
+    (source COLLATE pg_catalog."default" ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 2: channel backfills
+
+CREATE TABLE IF NOT EXISTS public.channel_backfills
+(
+    channel_id bigint NOT NULL,
+    status character varying(20) COLLATE pg_catalog."default" NOT NULL,
+    horizon timestamp without time zone,
+    oldest_entry_at timestamp without time zone,
+    values_count bigint NOT NULL DEFAULT 0,
+    error text COLLATE pg_catalog."default",
+    requested_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone,
+    finished_at timestamp without time zone,
+    CONSTRAINT channel_backfills_pkey PRIMARY KEY (channel_id)
+)
+
+TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS channel_backfills_status
+    ON public.channel_backfills USING btree
+    (status COLLATE pg_catalog."default" ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 3: collection runs
+
+CREATE TABLE IF NOT EXISTS public.collection_runs
+(
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    status character varying(20) COLLATE pg_catalog."default" NOT NULL,
+    started_at timestamp without time zone NOT NULL,
+    finished_at timestamp without time zone,
+    channels_seconds double precision,
+    sensors_seconds double precision,
+    new_channels bigint NOT NULL DEFAULT 0,
+    new_sensors bigint NOT NULL DEFAULT 0,
+    new_values bigint NOT NULL DEFAULT 0,
+    retried_requests bigint NOT NULL DEFAULT 0,
+    abandoned_requests bigint NOT NULL DEFAULT 0,
+    errors bigint NOT NULL DEFAULT 0,
+    CONSTRAINT collection_runs_pkey PRIMARY KEY (id)
+)
+
+TABLESPACE pg_default;
+
+
+-- Migration 4: collection run triggers
+
+ALTER TABLE public.collection_runs
+    ADD COLUMN IF NOT EXISTS trigger character varying(20) COLLATE pg_catalog."default" NOT NULL DEFAULT 'schedule';
+
+
+-- Migration 5: collection rules
+
+CREATE TABLE IF NOT EXISTS public.collection_rules
+(
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    kind character varying(30) COLLATE pg_catalog."default" NOT NULL,
+    value text COLLATE pg_catalog."default" NOT NULL,
+    user_id bigint,
+    updated_at timestamp without time zone,
+    CONSTRAINT collection_rules_pkey PRIMARY KEY (id)
+)
+
+TABLESPACE pg_default;
+
+
+-- Migration 6: channel metadata
+
+ALTER TABLE public.channels
+    ADD COLUMN IF NOT EXISTS elevation double precision,
+    ADD COLUMN IF NOT EXISTS ranking integer,
+    ADD COLUMN IF NOT EXISTS public_flag boolean,
+    ADD COLUMN IF NOT EXISTS github_url character varying(255) COLLATE pg_catalog."default",
+    ADD COLUMN IF NOT EXISTS metadata text COLLATE pg_catalog."default",
+    ADD COLUMN IF NOT EXISTS remote_last_entry_id bigint,
+    ADD COLUMN IF NOT EXISTS metadata_updated_at timestamp without time zone;
+
+CREATE TABLE IF NOT EXISTS public.channel_tags
+(
+    channel_id bigint NOT NULL,
+    tag_id bigint NOT NULL DEFAULT 0,
+    name character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    CONSTRAINT channel_tags_pkey PRIMARY KEY (channel_id, name)
+)
+
+TABLESPACE pg_default;
+
+CREATE INDEX IF NOT EXISTS channel_tags_name
+    ON public.channel_tags USING btree
+    (lower(name) COLLATE pg_catalog."default" ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 7: channel health
+
+ALTER TABLE public.channels
+    ADD COLUMN IF NOT EXISTS state character varying(20) COLLATE pg_catalog."default" NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS last_fetch_at timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS last_success_at timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS last_entry_at timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS last_http_status integer,
+    ADD COLUMN IF NOT EXISTS consecutive_failures integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_fetch_at timestamp without time zone;
+
+CREATE INDEX IF NOT EXISTS channels_state
+    ON public.channels USING btree
+    (state COLLATE pg_catalog."default" ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 8: typed sensor values
+
+ALTER TABLE public.sensor_values
+    ADD COLUMN IF NOT EXISTS value_num double precision;
+
+ALTER TABLE public.sensors
+    ADD COLUMN IF NOT EXISTS value_type character varying(20) COLLATE pg_catalog."default";
+
+UPDATE public.sensor_values
+    SET value_num = CASE lower(value) WHEN 'true' THEN 1 WHEN 'false' THEN 0 ELSE value::double precision END
+    WHERE
+        value_num IS NULL AND
+        (lower(value) IN ('true', 'false') OR value ~ '^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]{1,2})?$');
+
+UPDATE public.sensors AS s
+    SET value_type = t.value_type
+    FROM (
+        SELECT
+            sensor_id,
+            CASE
+                WHEN COUNT(*) FILTER (WHERE lower(value) IN ('true', 'false')) >= 0.9 * COUNT(*) THEN 'boolean'
+                WHEN COUNT(value_num) >= 0.9 * COUNT(*) THEN 'numeric'
+                ELSE 'text'
+            END AS value_type
+        FROM public.sensor_values
+        WHERE value <> ''
+        GROUP BY sensor_id
+    ) AS t
+    WHERE
+        s.id = t.sensor_id AND
+        s.value_type IS NULL;
+
+CREATE INDEX IF NOT EXISTS sensor_values_sensor_value_num
+    ON public.sensor_values USING btree
+    (sensor_id ASC NULLS LAST, value_num ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 9: value quality flags
+
+ALTER TABLE public.sensor_values
+    ADD COLUMN IF NOT EXISTS quality_flags integer;
+
+CREATE INDEX IF NOT EXISTS sensor_values_unchecked
+    ON public.sensor_values USING btree
+    (sensor_id ASC NULLS LAST, entry_id ASC NULLS LAST)
+    TABLESPACE pg_default
+    WHERE quality_flags IS NULL;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS skip_flagged boolean NOT NULL DEFAULT false;
+
+ALTER TABLE public.collection_runs
+    ADD COLUMN IF NOT EXISTS quality_seconds double precision,
+    ADD COLUMN IF NOT EXISTS flagged_values bigint NOT NULL DEFAULT 0;
+
+
+-- Migration 10: collection run stages
+
+ALTER TABLE public.collection_runs
+    ADD COLUMN IF NOT EXISTS stages character varying(50) COLLATE pg_catalog."default" NOT NULL DEFAULT 'discover,refresh';
+
+
+-- Migration 11: private channels
+
+ALTER TABLE public.channels
+    ADD COLUMN IF NOT EXISTS owner_id bigint;
+
+CREATE INDEX IF NOT EXISTS channels_owner_id
+    ON public.channels USING btree
+    (owner_id ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+CREATE TABLE IF NOT EXISTS public.private_channels
+(
+    channel_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    read_api_key character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    CONSTRAINT private_channels_pkey PRIMARY KEY (channel_id)
+)
+
+TABLESPACE pg_default;
+
+
+-- Migration 12: entry locations
+
+CREATE TABLE IF NOT EXISTS public.channel_entries
+(
+    channel_id bigint NOT NULL,
+    entry_id bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    latitude double precision,
+    longitude double precision,
+    elevation double precision,
+    status character varying(255) COLLATE pg_catalog."default",
+    CONSTRAINT channel_entries_pkey PRIMARY KEY (channel_id, entry_id)
+)
+
+TABLESPACE pg_default;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS push_location boolean NOT NULL DEFAULT false;
+
+
+-- Migration 13: sensor quantities
+
+ALTER TABLE public.sensors
+    ADD COLUMN IF NOT EXISTS quantity character varying(50) COLLATE pg_catalog."default";
+
+ALTER TABLE public.sensors
+    ADD COLUMN IF NOT EXISTS unit character varying(20) COLLATE pg_catalog."default";
+
+ALTER TABLE public.sensors
+    ADD COLUMN IF NOT EXISTS quantity_source character varying(10) COLLATE pg_catalog."default";
+
+ALTER TABLE public.sensors
+    ADD COLUMN IF NOT EXISTS classified_at timestamp without time zone;
+
+CREATE INDEX IF NOT EXISTS sensors_quantity
+    ON public.sensors USING btree
+    (quantity COLLATE pg_catalog."default" ASC NULLS LAST)
+    TABLESPACE pg_default;
+
+
+-- Migration 14: imported channels
+
+CREATE SEQUENCE IF NOT EXISTS public.imported_channels_id_seq
+    AS bigint
+    START WITH 1
+    INCREMENT BY 1;
+
+
+
+-- Migration 15: leader leases
+
+CREATE TABLE IF NOT EXISTS public.leader_leases
+(
+    name character varying(50) COLLATE pg_catalog."default" NOT NULL,
+    holder character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    acquired_at timestamp without time zone NOT NULL,
+    renewed_at timestamp without time zone NOT NULL,
+    expires_at timestamp without time zone NOT NULL,
+    CONSTRAINT leader_leases_pkey PRIMARY KEY (name)
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.collection_runs
+    ADD COLUMN IF NOT EXISTS instance_id character varying(255) COLLATE pg_catalog."default";
+
+
+
+-- Migration 16: push targets
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS target_type character varying(20) COLLATE pg_catalog."default" NOT NULL DEFAULT 'waziup';
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS target_config text COLLATE pg_catalog."default";
+
+
+
+-- Migration 17: push intervals in seconds
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS push_interval_seconds integer;
+
+UPDATE public.push_settings
+    SET push_interval_seconds = push_interval * 60
+    WHERE push_interval_seconds IS NULL;
+
+
+
+-- Migration 18: push batches
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS batch_size integer NOT NULL DEFAULT 1;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS catch_up_policy character varying(10) COLLATE pg_catalog."default" NOT NULL DEFAULT 'batch';
+
+
+-- Migration 19: push loops
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS loop boolean NOT NULL DEFAULT false;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS loop_start_entry_id bigint;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS loop_start_time timestamp without time zone;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS loop_count integer NOT NULL DEFAULT 0;
+
+ALTER TABLE public.push_settings
+    ADD COLUMN IF NOT EXISTS loop_time_shift bigint NOT NULL DEFAULT 0;
+
+
+-- Migration 20: run errors
+
+ALTER TABLE public.collection_runs
+    ADD COLUMN IF NOT EXISTS last_error text COLLATE pg_catalog."default";
+
+
+-- Migration 21: unique sensor names
+
+-- The duplicated sensors of a channel are merged into the first one
+
+UPDATE public.push_settings AS p
+    SET sensor_id = d.keep_id
+    FROM (SELECT id, MIN(id) OVER (PARTITION BY channel_id, name) AS keep_id FROM public.sensors) AS d
+    WHERE p.sensor_id = d.id AND d.id <> d.keep_id;
+
+UPDATE public.sensor_values AS v
+    SET sensor_id = d.keep_id
+    FROM (SELECT id, MIN(id) OVER (PARTITION BY channel_id, name) AS keep_id FROM public.sensors) AS d
+    WHERE v.sensor_id = d.id AND d.id <> d.keep_id AND NOT EXISTS (
+        SELECT 1 FROM public.sensor_values AS k WHERE k.sensor_id = d.keep_id AND k.entry_id = v.entry_id);
+
+DELETE FROM public.sensor_values AS v
+    USING (SELECT id, MIN(id) OVER (PARTITION BY channel_id, name) AS keep_id FROM public.sensors) AS d
+    WHERE v.sensor_id = d.id AND d.id <> d.keep_id;
+
+DELETE FROM public.sensors AS s
+    USING (SELECT id, MIN(id) OVER (PARTITION BY channel_id, name) AS keep_id FROM public.sensors) AS d
+    WHERE s.id = d.id AND d.id <> d.keep_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sensors_channel_id_name
+    ON public.sensors USING btree
+    (channel_id ASC NULLS LAST, name COLLATE pg_catalog."default" ASC NULLS LAST);
+
+
+-- Migration 22: import creators
+
+-- The user who imported a channel, the only one who can add entries to it besides the admins
+
+ALTER TABLE public.channels
+    ADD COLUMN IF NOT EXISTS created_by bigint;
+
+
+
+-- Migration 23: collection requests
+
+-- The runs and the cancels asked on the instances that do not lead the collection
+
+CREATE TABLE IF NOT EXISTS public.collection_requests
+(
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY ( INCREMENT 1 START 1 MINVALUE 1 MAXVALUE 9223372036854775807 CACHE 1 ),
+    kind character varying(30) COLLATE pg_catalog."default" NOT NULL,
+    trigger character varying(20) COLLATE pg_catalog."default",
+    requested_at timestamp without time zone NOT NULL,
+    CONSTRAINT collection_requests_pkey PRIMARY KEY (id)
+)
+
+TABLESPACE pg_default;
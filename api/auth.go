@@ -245,6 +245,37 @@ func getAuthorizedUserID(resp http.ResponseWriter, req *http.Request) (int64, er
 
 /*---------------------*/
 
+// isAdminUser tells if a user is one of the `ADMIN_USERS`, who can change what affects everyone (e.g. the collection rules)
+func isAdminUser(userId int64) bool {
+
+	user, err := GetUserById(userId)
+	if err != nil {
+		return false
+	}
+
+	for _, username := range strings.Split(global.ENV.ADMIN_USERS, ",") {
+		if username = strings.TrimSpace(username); username != "" && username == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+/*---------------------*/
+
+// getOptionalUserID is for the APIs that are open to everyone but show more to the logged-in users
+// (e.g. their private channels), it returns 0 if the user is not logged in
+func getOptionalUserID(resp http.ResponseWriter, req *http.Request) int64 {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		return 0
+	}
+	return userId
+}
+
+/*---------------------*/
+
 func GetUserIdByTokenHash(tokenHash string) (int64, error) {
 
 	SQL := `SELECT "id" FROM "users" WHERE "tokenHash" = $1`
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sensor-data-simulator/dataimport"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	routing "github.com/julienschmidt/httprouter"
+)
+
+/*-------------*/
+
+// The biggest file that can be uploaded
+const maxImportSize = 50 << 20
+
+/*-------------*/
+/*
+* This function implements POST /channels/import
+* It imports a CSV file (a ThingSpeak export or any time series) into a new channel or an imported channel.
+* The file is either the body of the request or the `file` part of a multipart form,
+* the options are in the query string or in the form
+ */
+func PostChannelsImport(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	req.Body = http.MaxBytesReader(resp, req.Body, maxImportSize)
+
+	var file io.Reader = req.Body
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+
+		part, _, err := req.FormFile("file")
+		if err != nil {
+			http.Error(resp, "Bad Request: the `file` is missing: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer part.Close()
+		file = part
+	}
+
+	opts, err := importOptions(req)
+	if err != nil {
+		http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.UserId = userId
+
+	// The imported channels are private unless they are shared on purpose
+	if public, _ := strconv.ParseBool(req.FormValue("public")); !public {
+		opts.OwnerId = userId
+	}
+
+	/*------------*/
+
+	if opts.ChannelId != 0 {
+
+		channelRows, err := getVisibleChannel(opts.ChannelId, userId)
+		if err != nil {
+			log.Printf("Error in db query: %v", err)
+			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(channelRows) == 0 {
+			http.Error(resp, "Channel not found!", http.StatusNotFound)
+			return
+		}
+
+		// The entries of a public channel are everyone's data, only the one who imported it adds to it
+		ownerId, _ := channelRows[0]["owner_id"].(int64)
+		creatorId, _ := channelRows[0]["created_by"].(int64)
+		if ownerId != userId && creatorId != userId && !isAdminUser(userId) {
+			http.Error(resp, "Forbidden: only the user who imported the channel can add entries to it", http.StatusForbidden)
+			return
+		}
+	}
+
+	result, err := dataimport.ImportCSV(file, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, dataimport.ErrChannelNotFound):
+			http.Error(resp, err.Error(), http.StatusNotFound)
+		case errors.Is(err, dataimport.ErrInvalidFile):
+			http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("[ERR  ] PostChannelsImport: %s", err.Error())
+			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tools.SendJSON(resp, result)
+}
+
+/*-------------*/
+
+// importOptions reads the options of an import from the query string or the form
+func importOptions(req *http.Request) (dataimport.Options, error) {
+
+	opts := dataimport.Options{
+		ChannelName:   req.FormValue("name"),
+		Description:   req.FormValue("description"),
+		TimeColumn:    req.FormValue("time_column"),
+		TimeFormat:    req.FormValue("time_format"),
+		TimeZone:      req.FormValue("time_zone"),
+		EntryIdColumn: req.FormValue("entry_id_column"),
+		Columns:       dataimport.ParseColumns(req.FormValue("columns")),
+	}
+
+	if channelIdStr := req.FormValue("channel_id"); channelIdStr != "" {
+		channelId, err := strconv.ParseInt(channelIdStr, 10, 64)
+		if err != nil {
+			return opts, errors.New("invalid channel_id")
+		}
+		opts.ChannelId = channelId
+	}
+
+	if delimiter := req.FormValue("delimiter"); delimiter != "" {
+		if delimiter == `\t` || delimiter == "tab" {
+			delimiter = "\t"
+		}
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return opts, errors.New("invalid delimiter")
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+
+	return opts, nil
+}
+
+/*-------------*/
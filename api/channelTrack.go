@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"time"
+
+	routing "github.com/julienschmidt/httprouter"
+)
+
+/*-------------*/
+
+// The most points of a track in one response, the latest ones are kept
+const trackMaxPoints = 10000
+
+/*-------------*/
+/*
+* This function implements GET /channels/:channel_id/track
+* It retrieves the path of a mobile channel as a GeoJSON FeatureCollection,
+* optionally between `start` and `end` (RFC 3339)
+ */
+func GetChannelTrack(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	channel_id, err := strconv.ParseInt(params.ByName("channel_id"), 10, 64)
+	if err != nil {
+		channel_id = 0
+	}
+
+	channelRows, err := getVisibleChannel(channel_id, getOptionalUserID(resp, req))
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(channelRows) == 0 {
+		http.Error(resp, "Channel not found!", http.StatusNotFound)
+		return
+	}
+
+	/*------*/
+
+	where := ""
+	queryParams := database.QueryParams{channel_id}
+	for _, filter := range []struct{ name, operator string }{{"start", ">="}, {"end", "<="}} {
+
+		valueStr := req.URL.Query().Get(filter.name)
+		if valueStr == "" {
+			continue
+		}
+
+		value, err := time.Parse(time.RFC3339, valueStr)
+		if err != nil {
+			http.Error(resp, "Bad Request: invalid "+filter.name, http.StatusBadRequest)
+			return
+		}
+
+		queryParams = append(queryParams, value.UTC())
+		where += fmt.Sprintf(` AND "created_at" %s $%d`, filter.operator, len(queryParams))
+	}
+
+	SQL := fmt.Sprintf(`SELECT "entry_id", "created_at", "latitude", "longitude", "elevation", "status"
+			FROM "channel_entries"
+			WHERE
+				"channel_id" = $1 AND
+				"latitude" IS NOT NULL AND
+				"longitude" IS NOT NULL%s
+			ORDER BY "entry_id" DESC
+			LIMIT $%d`, where, len(queryParams)+1)
+
+	rows, err := global.DB.Query(SQL, append(queryParams, trackMaxPoints))
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	/*------*/
+
+	// The rows are the latest first, the path goes the other way
+	coordinates := make([][]float64, 0, len(rows))
+	coordTimes := make([]time.Time, 0, len(rows))
+	entryIds := make([]int64, 0, len(rows))
+	statuses := make([]interface{}, 0, len(rows))
+
+	for i := len(rows) - 1; i >= 0; i-- {
+
+		row := rows[i]
+
+		position := []float64{row["longitude"].(float64), row["latitude"].(float64)}
+		if elevation, ok := row["elevation"].(float64); ok {
+			position = append(position, elevation)
+		}
+
+		coordinates = append(coordinates, position)
+		coordTimes = append(coordTimes, row["created_at"].(time.Time))
+		entryIds = append(entryIds, row["entry_id"].(int64))
+		statuses = append(statuses, row["status"])
+	}
+
+	features := []interface{}{}
+	if len(coordinates) > 0 {
+
+		// A LineString needs two positions at least
+		geometry := map[string]interface{}{"type": "LineString", "coordinates": coordinates}
+		if len(coordinates) == 1 {
+			geometry = map[string]interface{}{"type": "Point", "coordinates": coordinates[0]}
+		}
+
+		features = append(features, map[string]interface{}{
+			"type":     "Feature",
+			"geometry": geometry,
+			"properties": map[string]interface{}{
+				"channel_id": channel_id,
+				"name":       channelRows[0]["name"],
+				"coordTimes": coordTimes,
+				"entry_ids":  entryIds,
+				"statuses":   statuses,
+			},
+		})
+	}
+
+	tools.SendJSON(resp, map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
+
+/*-------------*/
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
 	"sensor-data-simulator/global"
 	"sensor-data-simulator/tools"
 	"strconv"
+	"strings"
+	"time"
 
 	routing "github.com/julienschmidt/httprouter"
 )
@@ -16,17 +21,28 @@ import (
 
 /*
 * This function implements GET /channels
+* The channels can be filtered by `tag` (can be repeated, all of them are required),
+* `search` (in the name or description), `source`, `min_ranking`, `min_entries`, `state`, `public` and `private`.
+* The private channels are only listed for their owner
  */
 func GetChannels(resp http.ResponseWriter, req *http.Request, params routing.Params) {
 
 	limit, offset, page := tools.GetLimitOffset(req)
 
+	userId := getOptionalUserID(resp, req)
+
+	where, queryParams, err := getChannelsFilter(req, userId)
+	if err != nil {
+		http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	/*------*/
 
 	totalRows := int64(0)
 	{
-		SQL := `SELECT COUNT(*) AS "total" FROM "channels"`
-		rows, err := global.DB.Query(SQL, database.QueryParams{})
+		SQL := `SELECT COUNT(*) AS "total" FROM "channels" WHERE ` + where
+		rows, err := global.DB.Query(SQL, queryParams)
 		if err != nil {
 			log.Printf("Error in db query: %v", err)
 			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -44,20 +60,146 @@ func GetChannels(resp http.ResponseWriter, req *http.Request, params routing.Par
 
 	/*------*/
 
-	SQL := `SELECT * FROM "channels" LIMIT $1 OFFSET $2`
+	SQL := fmt.Sprintf(`SELECT * FROM "channels" WHERE %s ORDER BY "id" LIMIT $%d OFFSET $%d`, where, len(queryParams)+1, len(queryParams)+2)
 
-	rows, err := global.DB.Query(SQL, database.QueryParams{limit, offset})
+	rows, err := global.DB.Query(SQL, append(queryParams, limit, offset))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := attachChannelTags(rows); err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	tools.SendJSON(resp, map[string]interface{}{"pagination": pagination, "rows": rows})
 }
 
 /*-------------*/
 
+// getChannelsFilter builds the WHERE clause of the channels list from the query string,
+// only the channels that the given user can see are kept (0 for the anonymous users)
+func getChannelsFilter(req *http.Request, userId int64) (string, database.QueryParams, error) {
+
+	qryParams := req.URL.Query()
+
+	where := `("owner_id" IS NULL OR "owner_id" = $1)`
+	queryParams := database.QueryParams{userId}
+
+	addCondition := func(condition string, value interface{}) {
+		queryParams = append(queryParams, value)
+		where += " AND " + fmt.Sprintf(condition, len(queryParams))
+	}
+
+	for _, tag := range qryParams["tag"] {
+		addCondition(`EXISTS (SELECT 1 FROM "channel_tags" WHERE "channel_tags"."channel_id" = "channels"."id" AND lower("channel_tags"."name") = lower($%d))`, tag)
+	}
+
+	if search := qryParams.Get("search"); search != "" {
+		addCondition(`("name" ILIKE '%%' || $%[1]d || '%%' OR "description" ILIKE '%%' || $%[1]d || '%%')`, search)
+	}
+
+	if source := qryParams.Get("source"); source != "" {
+		addCondition(`"source" = $%d`, source)
+	}
+
+	if minRankingStr := qryParams.Get("min_ranking"); minRankingStr != "" {
+		minRanking, err := strconv.Atoi(minRankingStr)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid min_ranking")
+		}
+		addCondition(`"ranking" >= $%d`, minRanking)
+	}
+
+	if minEntriesStr := qryParams.Get("min_entries"); minEntriesStr != "" {
+		minEntries, err := strconv.ParseInt(minEntriesStr, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid min_entries")
+		}
+		addCondition(`"remote_last_entry_id" >= $%d`, minEntries)
+	}
+
+	if state := qryParams.Get("state"); state != "" {
+		if state != datacollection.ChannelActive && state != datacollection.ChannelStale && state != datacollection.ChannelGone {
+			return "", nil, fmt.Errorf("invalid state")
+		}
+		addCondition(`"state" = $%d`, state)
+	}
+
+	if publicStr := qryParams.Get("public"); publicStr != "" {
+		public, err := strconv.ParseBool(publicStr)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid public")
+		}
+		addCondition(`"public_flag" = $%d`, public)
+	}
+
+	if privateStr := qryParams.Get("private"); privateStr != "" {
+		private, err := strconv.ParseBool(privateStr)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid private")
+		}
+		addCondition(`("owner_id" IS NOT NULL) = $%d`, private)
+	}
+
+	return where, queryParams, nil
+}
+
+/*-------------*/
+
+// attachChannelTags adds the list of tag names to each channel row
+func attachChannelTags(channelRows database.QueryResult) error {
+
+	if len(channelRows) == 0 {
+		return nil
+	}
+
+	var queryParams database.QueryParams
+	placeholders := make([]string, len(channelRows))
+	for i, row := range channelRows {
+		queryParams = append(queryParams, row["id"])
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	SQL := `SELECT "channel_id", "name" FROM "channel_tags" WHERE "channel_id" IN (` + strings.Join(placeholders, ",") + `) ORDER BY "name"`
+	rows, err := global.DB.Query(SQL, queryParams)
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[int64][]string)
+	for _, row := range rows {
+		channelId, _ := row["channel_id"].(int64)
+		name, _ := row["name"].(string)
+		tags[channelId] = append(tags[channelId], name)
+	}
+
+	for _, row := range channelRows {
+		channelId, _ := row["id"].(int64)
+		if tags[channelId] == nil {
+			row["tags"] = []string{}
+		} else {
+			row["tags"] = tags[channelId]
+		}
+	}
+
+	return nil
+}
+
+/*-------------*/
+
+// getVisibleChannel loads a channel if the given user can see it, i.e. it is public or one of their private channels
+func getVisibleChannel(channelId interface{}, userId int64) (database.QueryResult, error) {
+
+	SQL := `SELECT * FROM "channels" WHERE "id" = $1 AND ("owner_id" IS NULL OR "owner_id" = $2)`
+	return global.DB.Query(SQL, database.QueryParams{channelId, userId})
+}
+
+/*-------------*/
+
 /*
 * This function implements GET /channels/:channel_id
  */
@@ -70,8 +212,7 @@ func GetChannel(resp http.ResponseWriter, req *http.Request, params routing.Para
 		channel_id = 0
 	}
 
-	SQL := `SELECT * FROM "channels" WHERE "id" = $1`
-	channelRows, err := global.DB.Query(SQL, database.QueryParams{channel_id})
+	channelRows, err := getVisibleChannel(channel_id, getOptionalUserID(resp, req))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -83,6 +224,12 @@ func GetChannel(resp http.ResponseWriter, req *http.Request, params routing.Para
 		return
 	}
 
+	if err := attachChannelTags(channelRows); err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	tools.SendJSON(resp, channelRows[0])
 }
 
@@ -102,8 +249,7 @@ func GetChannelSensors(resp http.ResponseWriter, req *http.Request, params routi
 
 	limit, offset, page := tools.GetLimitOffset(req)
 
-	SQL := `SELECT * FROM "channels" WHERE "id" = $1`
-	channelRows, err := global.DB.Query(SQL, database.QueryParams{channel_id})
+	channelRows, err := getVisibleChannel(channel_id, getOptionalUserID(resp, req))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -138,7 +284,7 @@ func GetChannelSensors(resp http.ResponseWriter, req *http.Request, params routi
 
 	/*------*/
 
-	SQL = `SELECT "id", "name"
+	SQL := `SELECT "id", "name"
 			FROM "sensors" 
 			WHERE
 				"channel_id" = $1
@@ -159,3 +305,158 @@ func GetChannelSensors(resp http.ResponseWriter, req *http.Request, params routi
 }
 
 /*-------------*/
+
+/*
+* This function implements POST /channels/:channel_id/backfill
+* It queues a channel for the historical data extraction or resumes it
+ */
+func PostChannelBackfill(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	channelIdStr := params.ByName("channel_id")
+
+	channel_id, err := strconv.ParseInt(channelIdStr, 10, 64)
+	if err != nil {
+		channel_id = 0
+	}
+
+	channelRows, err := getVisibleChannel(channel_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if channelRows == nil || len(channelRows) == 0 {
+		http.Error(resp, "Channel not found!", http.StatusNotFound)
+		return
+	}
+
+	/*------------*/
+
+	var inputRecord struct {
+		Horizon time.Time `json:"horizon"`
+	}
+
+	body, err := tools.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("[ERR  ] PostChannelBackfill: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &inputRecord)
+		if err != nil {
+			log.Printf("[ERR  ] PostChannelBackfill: %s", err.Error())
+			http.Error(resp, "bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	/*------------*/
+
+	err = datacollection.QueueBackfill(channel_id, inputRecord.Horizon)
+	if err != nil {
+		http.Error(resp, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
+
+/*
+* This function implements GET /channels/:channel_id/backfill
+ */
+func GetChannelBackfill(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	channelIdStr := params.ByName("channel_id")
+
+	channel_id, err := strconv.Atoi(channelIdStr)
+	if err != nil {
+		channel_id = 0
+	}
+
+	SQL := `SELECT b.*
+			FROM
+				"channel_backfills" AS b,
+				"channels" AS c
+			WHERE
+				c."id" = b."channel_id" AND
+				b."channel_id" = $1 AND
+				(c."owner_id" IS NULL OR c."owner_id" = $2)`
+	rows, err := global.DB.Query(SQL, database.QueryParams{channel_id, getOptionalUserID(resp, req)})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rows == nil || len(rows) == 0 {
+		http.Error(resp, "No backfill for this channel!", http.StatusNotFound)
+		return
+	}
+
+	tools.SendJSON(resp, rows[0])
+}
+
+/*-------------*/
+
+/*
+* This function implements POST /channels/:channel_id/refresh
+* It fetches the new entries of a channel right away
+ */
+func PostChannelRefresh(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	channelIdStr := params.ByName("channel_id")
+
+	channel_id, err := strconv.ParseInt(channelIdStr, 10, 64)
+	if err != nil {
+		channel_id = 0
+	}
+
+	channelRows, err := getVisibleChannel(channel_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if channelRows == nil || len(channelRows) == 0 {
+		http.Error(resp, "Channel not found!", http.StatusNotFound)
+		return
+	}
+
+	/*------------*/
+
+	newValues, err := datacollection.RefreshChannel(req.Context(), channel_id)
+	if err != nil {
+		log.Printf("[ERR  ] PostChannelRefresh: %s", err.Error())
+		http.Error(resp, "Could not fetch the channel: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	tools.SendJSON(resp, map[string]interface{}{
+		"channel_id": channel_id,
+		"new_values": newValues,
+	})
+}
+
+/*-------------*/
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
+	"sensor-data-simulator/global"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"time"
+
+	routing "github.com/julienschmidt/httprouter"
+)
+
+/*-------------*/
+
+type CollectionRule struct {
+	ID    int64  `json:"id"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+const notAdminMessage = "Forbidden: only the admin users (`ADMIN_USERS`) can change the collection rules"
+
+/*-------------*/
+/*
+* This function implements GET /collectionRules
+ */
+func GetCollectionRules(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	SQL := `SELECT * FROM "collection_rules" ORDER BY "id"`
+	rows, err := global.DB.Query(SQL, database.QueryParams{})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tools.SendJSON(resp, rows)
+}
+
+/*-------------*/
+/*
+* This function implements POST /collectionRules
+* It Adds or Modify a rule, the rules apply from the next collection run
+ */
+func PostCollectionRule(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The rules apply to the collection of everyone
+	if !isAdminUser(userId) {
+		http.Error(resp, notAdminMessage, http.StatusForbidden)
+		return
+	}
+
+	/*------------*/
+
+	body, err := tools.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("[ERR  ] PostCollectionRule: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var inputRecord CollectionRule
+
+	err = json.Unmarshal(body, &inputRecord)
+	if err != nil {
+		log.Printf("[ERR  ] PostCollectionRule: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := datacollection.ValidateCollectionRule(inputRecord.Kind, inputRecord.Value); err != nil {
+		http.Error(resp, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	/*------------*/
+
+	row := database.RowType{
+		"kind":       inputRecord.Kind,
+		"value":      inputRecord.Value,
+		"user_id":    userId,
+		"updated_at": time.Now().UTC(),
+	}
+
+	if inputRecord.ID == 0 { // New record
+
+		_, err := global.DB.Insert("collection_rules", row)
+		if err != nil {
+			log.Printf("\nError in `collection_rules` insertion: %v \nRow: \n%v", err, row)
+			http.Error(resp, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+	} else {
+
+		_, err := global.DB.Update("collection_rules", row, database.RowType{"id": inputRecord.ID})
+		if err != nil {
+			log.Printf("\nError in `collection_rules` update: %v \nRow: \n%v", err, row)
+			http.Error(resp, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
+/*
+* This function implements DELETE /collectionRules/:id
+ */
+func DeleteCollectionRule(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !isAdminUser(userId) {
+		http.Error(resp, notAdminMessage, http.StatusForbidden)
+		return
+	}
+
+	/*------------*/
+
+	recordId, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		recordId = 0
+	}
+
+	condRows := database.RowType{"id": recordId}
+	_, err = global.DB.Delete("collection_rules", condRows)
+	if err != nil {
+		log.Printf("\nError in `collection_rules` Deletion: %v \ncondRows: \n%v", err, condRows)
+		http.Error(resp, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
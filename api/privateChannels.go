@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
+	"sensor-data-simulator/global"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"strings"
+
+	routing "github.com/julienschmidt/httprouter"
+)
+
+/*-------------*/
+
+type PrivateChannel struct {
+	ChannelId  int64  `json:"channel_id"`
+	ReadApiKey string `json:"read_api_key"`
+}
+
+/*-------------*/
+/*
+* This function implements GET /privateChannels
+* It retrieves the private channels of the logged-in user, the API keys are masked
+ */
+func GetPrivateChannels(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	SQL := `SELECT
+				p."channel_id",
+				p."read_api_key",
+				p."created_at",
+				p."updated_at",
+				c."name",
+				c."state",
+				c."last_success_at"
+			FROM
+				"private_channels" AS p,
+				"channels" AS c
+			WHERE
+				c."id" = p."channel_id" AND
+				p."user_id" = $1
+			ORDER BY p."channel_id"`
+
+	rows, err := global.DB.Query(SQL, database.QueryParams{userId})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, row := range rows {
+		apiKey, _ := row["read_api_key"].(string)
+		row["read_api_key"] = maskApiKey(apiKey)
+	}
+
+	tools.SendJSON(resp, rows)
+}
+
+// maskApiKey keeps only the end of a key, enough for the user to recognize it
+func maskApiKey(apiKey string) string {
+
+	if len(apiKey) <= 4 {
+		return strings.Repeat("*", len(apiKey))
+	}
+	return strings.Repeat("*", len(apiKey)-4) + apiKey[len(apiKey)-4:]
+}
+
+/*-------------*/
+/*
+* This function implements POST /privateChannels
+* It registers a private channel with its read API key for the logged-in user,
+* posting an already registered channel replaces its key
+ */
+func PostPrivateChannel(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	body, err := tools.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("[ERR  ] PostPrivateChannel: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var inputRecord PrivateChannel
+
+	err = json.Unmarshal(body, &inputRecord)
+	if err != nil {
+		log.Printf("[ERR  ] PostPrivateChannel: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	inputRecord.ReadApiKey = strings.TrimSpace(inputRecord.ReadApiKey)
+	if inputRecord.ChannelId <= 0 || inputRecord.ReadApiKey == "" || len(inputRecord.ReadApiKey) > 64 {
+		http.Error(resp, "Bad Request: a channel_id and a read_api_key are required", http.StatusBadRequest)
+		return
+	}
+
+	/*------------*/
+
+	err = datacollection.RegisterPrivateChannel(req.Context(), userId, inputRecord.ChannelId, inputRecord.ReadApiKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, datacollection.ErrChannelTaken), errors.Is(err, datacollection.ErrChannelPublic):
+			http.Error(resp, err.Error(), http.StatusConflict)
+		case errors.Is(err, datacollection.ErrChannelNotFound):
+			http.Error(resp, "The channel does not exist or the API key is not valid", http.StatusBadRequest)
+		default:
+			log.Printf("[ERR  ] PostPrivateChannel: %s", err.Error())
+			http.Error(resp, "Could not fetch the channel: "+err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
+/*
+* This function implements DELETE /privateChannels/:channel_id
+* The channel is not fetched any more, the collected values stay visible to the user
+ */
+func DeletePrivateChannel(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	channel_id, err := strconv.ParseInt(params.ByName("channel_id"), 10, 64)
+	if err != nil {
+		channel_id = 0
+	}
+
+	found, err := datacollection.UnregisterPrivateChannel(userId, channel_id)
+	if err != nil {
+		log.Printf("\nError in `private_channels` Deletion: %v", err)
+		http.Error(resp, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(resp, "Channel not found!", http.StatusNotFound)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sensor-data-simulator/datacollection"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"strings"
+
+	routing "github.com/julienschmidt/httprouter"
+)
+
+/*-------------*/
+
+type SensorQuantity struct {
+	Quantity string `json:"quantity"`
+	Unit     string `json:"unit"`
+}
+
+/*-------------*/
+/*
+* This function implements GET /quantities
+* It retrieves the quantities that the sensors can be classified as, with their usual unit
+ */
+func GetQuantities(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	output := []map[string]interface{}{}
+	for _, q := range datacollection.Quantities() {
+
+		row := map[string]interface{}{"name": q.Name, "unit": q.Unit}
+		if q.HasRange {
+			row["min"] = q.Min
+			row["max"] = q.Max
+		}
+		output = append(output, row)
+	}
+
+	tools.SendJSON(resp, output)
+}
+
+/*-------------*/
+/*
+* This function implements POST /sensors/:sensor_id/quantity
+* It sets the quantity and the unit of a sensor manually, the classifier does not change them any more.
+* An empty quantity gives the sensor back to the classifier
+ */
+func PostSensorQuantity(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	sensor_id, err := strconv.ParseInt(params.ByName("sensor_id"), 10, 64)
+	if err != nil {
+		sensor_id = 0
+	}
+
+	sensorRows, err := getVisibleSensor(sensor_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(sensorRows) == 0 {
+		http.Error(resp, "Sensor not found!", http.StatusNotFound)
+		return
+	}
+
+	// The quantity of a public sensor is shared, and a new one clears its quality flags
+	allowed, err := canChangeSensor(sensor_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(resp, notSensorOwnerMessage, http.StatusForbidden)
+		return
+	}
+
+	/*------------*/
+
+	body, err := tools.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("[ERR  ] PostSensorQuantity: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var inputRecord SensorQuantity
+
+	err = json.Unmarshal(body, &inputRecord)
+	if err != nil {
+		log.Printf("[ERR  ] PostSensorQuantity: %s", err.Error())
+		http.Error(resp, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	inputRecord.Quantity = strings.TrimSpace(inputRecord.Quantity)
+	inputRecord.Unit = strings.TrimSpace(inputRecord.Unit)
+
+	if inputRecord.Quantity != "" {
+
+		q, ok := datacollection.GetQuantity(inputRecord.Quantity)
+		if !ok {
+			http.Error(resp, "Bad Request: unknown quantity, see GET /quantities", http.StatusBadRequest)
+			return
+		}
+		if inputRecord.Unit == "" {
+			inputRecord.Unit = q.Unit
+		}
+	}
+
+	if len(inputRecord.Unit) > 20 {
+		http.Error(resp, "Bad Request: the unit is too long", http.StatusBadRequest)
+		return
+	}
+
+	/*------------*/
+
+	if err := datacollection.SetSensorQuantity(sensor_id, inputRecord.Quantity, inputRecord.Unit); err != nil {
+		log.Printf("\nError in `sensors` update: %v", err)
+		http.Error(resp, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
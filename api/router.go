@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	routing "github.com/julienschmidt/httprouter"
 )
@@ -25,10 +27,20 @@ func setupRouter() *routing.Router {
 
 	router.GET("/dataCollection/status", GetDataCollectionStatus)
 	router.GET("/dataCollection/statistics", GetDataCollectionStatistics)
+	router.GET("/dataCollection/runs", GetDataCollectionRuns)
+	router.POST("/dataCollection/run", PostDataCollectionRun)
+	router.POST("/dataCollection/cancel", PostDataCollectionCancel)
+
+	router.GET("/collectionRules", GetCollectionRules)
+	router.POST("/collectionRules", PostCollectionRule)
+	router.DELETE("/collectionRules/:id", DeleteCollectionRule)
 
 	router.GET("/sensors", GetSensors)
 	router.GET("/sensors/:sensor_id", GetSensor)
 	router.GET("/sensors/:sensor_id/values", GetSensorValues)
+	router.POST("/sensors/:sensor_id/qualityCheck", PostSensorQualityCheck)
+	router.POST("/sensors/:sensor_id/quantity", PostSensorQuantity)
+	router.GET("/quantities", GetQuantities)
 
 	router.GET("/sensors/:sensor_id/pushSettings", GetSensorPushSettings)
 	router.POST("/sensors/:sensor_id/pushSettings", PostSensorPushSettings)
@@ -41,6 +53,15 @@ func setupRouter() *routing.Router {
 	router.GET("/channels/:channel_id", GetChannel)
 	router.GET("/channels/:channel_id/sensors", GetChannelSensors)
 	router.GET("/channels/:channel_id/sensors/:sensor_id/values", GetSensorValues)
+	router.GET("/channels/:channel_id/track", GetChannelTrack)
+	router.GET("/channels/:channel_id/backfill", GetChannelBackfill)
+	router.POST("/channels/:channel_id/backfill", PostChannelBackfill)
+	router.POST("/channels/:channel_id/refresh", PostChannelRefresh)
+	router.POST("/channels/:channel_id", postChannel) // POST /channels/import
+
+	router.GET("/privateChannels", GetPrivateChannels)
+	router.POST("/privateChannels", PostPrivateChannel)
+	router.DELETE("/privateChannels/:channel_id", DeletePrivateChannel)
 
 	router.GET("/user", GetUser)
 	router.GET("/userDevices", GetUserDevicesAndSensors)
@@ -50,8 +71,8 @@ func setupRouter() *routing.Router {
 
 /*-------------------------*/
 
-// ListenAndServeHTTP serves the APIs and the ui
-func ListenAndServeHTTP() {
+// ListenAndServeHTTP serves the APIs and the ui until the given context is cancelled
+func ListenAndServeHTTP(ctx context.Context) {
 
 	log.Printf("Initializing...")
 
@@ -62,9 +83,35 @@ func ListenAndServeHTTP() {
 		addr = ":8080"
 	}
 
+	server := &http.Server{Addr: addr, Handler: router}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
 	log.Printf("[Info  ] Serving on %s", addr)
 
-	log.Fatal(http.ListenAndServe(addr, router))
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+/*-------------------------*/
+
+// postChannel dispatches the POST requests on a channel path,
+// as the router does not allow `/channels/import` next to `/channels/:channel_id/...`
+func postChannel(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	if params.ByName("channel_id") == "import" {
+		PostChannelsImport(resp, req, params)
+		return
+	}
+	http.NotFound(resp, req)
 }
 
 /*-------------------------*/
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
 	"sensor-data-simulator/global"
 	"sensor-data-simulator/tools"
 	"strconv"
@@ -24,12 +26,42 @@ type SensorPushSettings struct {
 	TargetSensorId    string    `json:"target_sensor_id"`
 	Active            bool      `json:"active"`
 	LastPushedEntryId int64     `json:"last_pushed_entry_id"`
-	PushInterval      int       `json:"push_interval"`
+	PushInterval      int       `json:"push_interval"` // In minutes
+	PushIntervalSecs  int       `json:"push_interval_seconds"`
 	LastPushTime      time.Time `json:"last_push_time"`
 	UseOriginalTime   bool      `json:"use_original_time"`
 	PushedCount       bool      `json:"pushed_count"`
+	SkipFlagged       *bool     `json:"skip_flagged"`  // Do not push the values with quality issues
+	PushLocation      *bool     `json:"push_location"` // Move the target device to where each value was taken (mobile channels)
+
+	TargetType   string          `json:"target_type"`   // Where the values go: `waziup` (default), `webhook`, `file`, ...
+	TargetConfig json.RawMessage `json:"target_config"` // The settings of the target, depending on its type
+
+	BatchSize     int    `json:"batch_size"`      // The most values sent at each push
+	CatchUpPolicy string `json:"catch_up_policy"` // What is pushed when several values are waiting: `latest`, `batch` (default) or `all`
+
+	Loop             *bool      `json:"loop"`                // Start over after the last value
+	LoopStartEntryId int64      `json:"loop_start_entry_id"` // Where the loops start, the first entry by default
+	LoopStartTime    *time.Time `json:"loop_start_time"`
 }
 
+// ValidatePushTarget checks the type and the config of a push target, it is provided by the datapush package
+var ValidatePushTarget func(userId int64, targetType string, config json.RawMessage) error
+
+// The push intervals that can be set, in seconds
+const (
+	minPushInterval = 1
+	maxPushInterval = 30 * 24 * 60 * 60
+)
+
+// The batch sizes that can be set
+const (
+	minPushBatchSize = 1
+	maxPushBatchSize = 1000
+)
+
+var catchUpPolicies = map[string]bool{"latest": true, "batch": true, "all": true}
+
 /*-------------*/
 /*
 * This function implements POST /sensors/:sensor_id/pushSettings
@@ -52,6 +84,18 @@ func PostSensorPushSettings(resp http.ResponseWriter, req *http.Request, params
 		sensorId = 0
 	}
 
+	sensorRows, err := getVisibleSensor(sensorId, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(sensorRows) == 0 {
+		http.Error(resp, "Sensor not found!", http.StatusNotFound)
+		return
+	}
+
 	/*------------*/
 
 	body, err := tools.ReadAll(req.Body)
@@ -72,14 +116,116 @@ func PostSensorPushSettings(resp http.ResponseWriter, req *http.Request, params
 
 	/*------------*/
 
+	// The interval is in seconds, or in minutes like before
+	if inputRecord.PushIntervalSecs == 0 {
+		inputRecord.PushIntervalSecs = inputRecord.PushInterval * 60
+	}
+
+	if inputRecord.PushIntervalSecs < minPushInterval || inputRecord.PushIntervalSecs > maxPushInterval {
+		http.Error(resp, fmt.Sprintf("Bad Request: the push interval has to be from %v second to %v days", minPushInterval, maxPushInterval/(24*60*60)), http.StatusBadRequest)
+		return
+	}
+
+	// The new settings push one value at a time, an update without them keeps those of the setting
+	if inputRecord.ID == 0 {
+		if inputRecord.BatchSize == 0 {
+			inputRecord.BatchSize = minPushBatchSize
+		}
+		if inputRecord.CatchUpPolicy == "" {
+			inputRecord.CatchUpPolicy = "batch"
+		}
+	}
+
+	if inputRecord.BatchSize != 0 && (inputRecord.BatchSize < minPushBatchSize || inputRecord.BatchSize > maxPushBatchSize) {
+		http.Error(resp, fmt.Sprintf("Bad Request: the batch size has to be from %v to %v", minPushBatchSize, maxPushBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	if inputRecord.CatchUpPolicy != "" && !catchUpPolicies[inputRecord.CatchUpPolicy] {
+		http.Error(resp, "Bad Request: the catch-up policy has to be `latest`, `batch` or `all`", http.StatusBadRequest)
+		return
+	}
+
+	if inputRecord.LoopStartEntryId < 0 || (inputRecord.LoopStartEntryId > 0 && inputRecord.LoopStartTime != nil) {
+		http.Error(resp, "Bad Request: a loop starts either from an entry or from a date", http.StatusBadRequest)
+		return
+	}
+
+	/*------------*/
+
 	row := database.RowType{
-		"user_id":           userId,
-		"sensor_id":         sensorId,
-		"target_device_id":  inputRecord.TargetDeviceId,
-		"target_sensor_id":  inputRecord.TargetSensorId,
-		"active":            inputRecord.Active,
-		"push_interval":     inputRecord.PushInterval,
-		"use_original_time": inputRecord.UseOriginalTime,
+		"user_id":               userId,
+		"sensor_id":             sensorId,
+		"target_device_id":      inputRecord.TargetDeviceId,
+		"target_sensor_id":      inputRecord.TargetSensorId,
+		"active":                inputRecord.Active,
+		"push_interval":         (inputRecord.PushIntervalSecs + 59) / 60, // Rounded up, `push_interval_seconds` is the one that counts
+		"push_interval_seconds": inputRecord.PushIntervalSecs,
+		"use_original_time":     inputRecord.UseOriginalTime,
+	}
+
+	// An update without them keeps the quality filter and the location push of the setting
+	if inputRecord.SkipFlagged != nil {
+		row["skip_flagged"] = *inputRecord.SkipFlagged
+	}
+	if inputRecord.PushLocation != nil {
+		row["push_location"] = *inputRecord.PushLocation
+	}
+
+	if inputRecord.BatchSize != 0 {
+		row["batch_size"] = inputRecord.BatchSize
+	}
+	if inputRecord.CatchUpPolicy != "" {
+		row["catch_up_policy"] = inputRecord.CatchUpPolicy
+	}
+
+	// An update without `loop` keeps the loop of the setting
+	if inputRecord.Loop != nil || inputRecord.ID == 0 {
+
+		row["loop"] = inputRecord.Loop != nil && *inputRecord.Loop
+		row["loop_start_entry_id"] = nil
+		if inputRecord.LoopStartEntryId > 0 {
+			row["loop_start_entry_id"] = inputRecord.LoopStartEntryId
+		}
+		row["loop_start_time"] = nil
+		if inputRecord.LoopStartTime != nil {
+			row["loop_start_time"] = inputRecord.LoopStartTime.UTC()
+		}
+	}
+
+	// An update without a target keeps the one of the setting
+	if inputRecord.TargetType != "" || inputRecord.ID == 0 {
+
+		if inputRecord.TargetType == "" {
+			inputRecord.TargetType = "waziup"
+		}
+
+		// The secrets read back masked keep their stored values
+		if inputRecord.ID != 0 {
+			stored, err := global.DB.Load("push_settings", database.RowType{"id": inputRecord.ID, "user_id": userId})
+			if err != nil {
+				log.Printf("Error in db query: %v", err)
+				http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if len(stored) > 0 && stored[0]["target_type"] == inputRecord.TargetType {
+				storedConfig, _ := stored[0]["target_config"].(string)
+				inputRecord.TargetConfig = unmaskTargetConfig(inputRecord.TargetType, inputRecord.TargetConfig, storedConfig)
+			}
+		}
+
+		if ValidatePushTarget != nil {
+			if err := ValidatePushTarget(userId, inputRecord.TargetType, inputRecord.TargetConfig); err != nil {
+				http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		row["target_type"] = inputRecord.TargetType
+		row["target_config"] = nil
+		if len(inputRecord.TargetConfig) > 0 && string(inputRecord.TargetConfig) != "null" {
+			row["target_config"] = string(inputRecord.TargetConfig)
+		}
 	}
 
 	if inputRecord.ID == 0 { // New record
@@ -108,6 +254,81 @@ func PostSensorPushSettings(resp http.ResponseWriter, req *http.Request, params
 
 }
 
+/*-------------*/
+
+// The secrets of the target configs: a field, or every value of a field that is an object (e.g. the headers)
+var targetSecrets = map[string][]string{
+	"mqtt":    {"password"},
+	"webhook": {"headers"},
+}
+
+// maskTargetConfig masks the secrets of a target config like the API keys
+func maskTargetConfig(targetType string, config string) json.RawMessage {
+
+	fields := map[string]interface{}{}
+	if len(targetSecrets[targetType]) == 0 || json.Unmarshal([]byte(config), &fields) != nil {
+		return json.RawMessage(config)
+	}
+
+	for _, name := range targetSecrets[targetType] {
+		switch value := fields[name].(type) {
+		case string:
+			fields[name] = maskApiKey(value)
+		case map[string]interface{}:
+			for key, v := range value {
+				if text, ok := v.(string); ok {
+					value[key] = maskApiKey(text)
+				}
+			}
+		}
+	}
+
+	masked, err := json.Marshal(fields)
+	if err != nil {
+		return json.RawMessage(config)
+	}
+	return masked
+}
+
+// unmaskTargetConfig puts back the stored secrets that are sent as they were read, i.e. masked
+func unmaskTargetConfig(targetType string, config json.RawMessage, storedConfig string) json.RawMessage {
+
+	fields := map[string]interface{}{}
+	storedFields := map[string]interface{}{}
+	if len(targetSecrets[targetType]) == 0 || json.Unmarshal(config, &fields) != nil || json.Unmarshal([]byte(storedConfig), &storedFields) != nil {
+		return config
+	}
+
+	unmasked := false
+	for _, name := range targetSecrets[targetType] {
+		switch value := fields[name].(type) {
+		case string:
+			if stored, ok := storedFields[name].(string); ok && value == maskApiKey(stored) {
+				fields[name] = stored
+				unmasked = true
+			}
+		case map[string]interface{}:
+			storedValues, _ := storedFields[name].(map[string]interface{})
+			for key, v := range value {
+				if stored, ok := storedValues[key].(string); ok && v == maskApiKey(stored) {
+					value[key] = stored
+					unmasked = true
+				}
+			}
+		}
+	}
+
+	if !unmasked {
+		return config
+	}
+
+	output, err := json.Marshal(fields)
+	if err != nil {
+		return config
+	}
+	return output
+}
+
 /*-------------*/
 /*
 * This function implements POST /sensors/:sensor_id/pushSettings/:id
@@ -211,9 +432,20 @@ func GetSensorPushSettings(resp http.ResponseWriter, req *http.Request, params r
 					"target_sensor_id",
 					"active",
 					"push_interval",
+					"push_interval_seconds",
 					"last_push_time",
 					"use_original_time",
-					"pushed_count"
+					"pushed_count",
+					"skip_flagged",
+					"push_location",
+					"target_type",
+					"target_config",
+					"batch_size",
+					"catch_up_policy",
+					"loop",
+					"loop_start_entry_id",
+					"loop_start_time",
+					"loop_count"
 					
 			FROM	"push_settings"
 			WHERE
@@ -228,7 +460,56 @@ func GetSensorPushSettings(resp http.ResponseWriter, req *http.Request, params r
 		return
 	}
 
-	tools.SendJSON(resp, map[string]interface{}{"pagination": pagination, "rows": rows})
+	// The config is sent as it was given, with its secrets masked
+	for _, row := range rows {
+		if config, ok := row["target_config"].(string); ok {
+			targetType, _ := row["target_type"].(string)
+			row["target_config"] = maskTargetConfig(targetType, config)
+		}
+	}
+
+	/*------*/
+
+	SQL = `SELECT c."state"
+			FROM
+				"sensors" AS s,
+				"channels" AS c
+			WHERE
+				c."id" = s."channel_id" AND
+				s."id" = $1`
+
+	stateRows, err := global.DB.Query(SQL, database.QueryParams{sensorId})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var channelState interface{}
+	if len(stateRows) > 0 {
+		channelState = stateRows[0]["state"]
+	}
+
+	tools.SendJSON(resp, map[string]interface{}{
+		"pagination":    pagination,
+		"rows":          rows,
+		"channel_state": channelState,
+		"warning":       channelStateWarning(channelState),
+	})
+}
+
+/*-------------*/
+
+// channelStateWarning explains to the user why the sensors of a channel may not have new values to push
+func channelStateWarning(state interface{}) string {
+
+	switch state {
+	case datacollection.ChannelStale:
+		return "The channel of this sensor is not reporting new values at the moment, there may be nothing new to push."
+	case datacollection.ChannelGone:
+		return "The channel of this sensor is deleted or private on its source, no new values will be pushed."
+	}
+	return ""
 }
 
 /*-------------*/
@@ -278,14 +559,16 @@ func GetMyPushSensors(resp http.ResponseWriter, req *http.Request, params routin
 
 	/*------*/
 
-	SQL := `SELECT s.* 
+	SQL := `SELECT s.*, c."state" AS "channel_state"
 			FROM 
 				"push_settings" AS p, 
-				"sensors" AS s 
+				"sensors" AS s,
+				"channels" AS c
 			WHERE 
 				s."id" = p."sensor_id"	AND
+				c."id" = s."channel_id"	AND
 				p."user_id" = $1
-			GROUP BY s."id"
+			GROUP BY s."id", c."id"
 			LIMIT $2 OFFSET $3`
 
 	rows, err := global.DB.Query(SQL, database.QueryParams{userId, limit, offset})
@@ -295,6 +578,10 @@ func GetMyPushSensors(resp http.ResponseWriter, req *http.Request, params routin
 		return
 	}
 
+	for _, row := range rows {
+		row["warning"] = channelStateWarning(row["channel_state"])
+	}
+
 	tools.SendJSON(resp, map[string]interface{}{"pagination": pagination, "rows": rows})
 }
 
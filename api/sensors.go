@@ -1,10 +1,12 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
 	"sensor-data-simulator/global"
 	"sensor-data-simulator/tools"
 	"strconv"
@@ -14,17 +16,28 @@ import (
 
 /*
 * This function implements GET /sensors
+* The sensors of the private channels are only listed for their owner
  */
 func GetSensors(resp http.ResponseWriter, req *http.Request, params routing.Params) {
 
 	limit, offset, page := tools.GetLimitOffset(req)
 
+	where, queryParams, err := getSensorsFilter(req, getOptionalUserID(resp, req))
+	if err != nil {
+		http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	/*------*/
 
 	totalRows := int64(0)
 	{
-		SQL := `SELECT COUNT(*) AS "total" FROM "sensors"`
-		rows, err := global.DB.Query(SQL, database.QueryParams{})
+		SQL := `SELECT COUNT(*) AS "total"
+				FROM
+					"sensors"	AS s,
+					"channels"	AS c
+				WHERE ` + where
+		rows, err := global.DB.Query(SQL, queryParams)
 		if err != nil {
 			log.Printf("Error in db query: %v", err)
 			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -42,17 +55,16 @@ func GetSensors(resp http.ResponseWriter, req *http.Request, params routing.Para
 
 	/*------*/
 
-	SQL := `SELECT 
+	SQL := fmt.Sprintf(`SELECT 
 					s.*,
 					c."name"	AS "channel_name"
 			FROM 
 				"sensors"	AS s,
 				"channels"	AS c
-			WHERE
-				c."id" = s."channel_id"
-			LIMIT $1 OFFSET $2`
+			WHERE %s
+			LIMIT $%d OFFSET $%d`, where, len(queryParams)+1, len(queryParams)+2)
 
-	rows, err := global.DB.Query(SQL, database.QueryParams{limit, offset})
+	rows, err := global.DB.Query(SQL, append(queryParams, limit, offset))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -64,6 +76,39 @@ func GetSensors(resp http.ResponseWriter, req *http.Request, params routing.Para
 
 /*-------------*/
 
+// getSensorsFilter builds the WHERE clause of the sensors lists (`s` the sensors, `c` their channels) from the query string,
+// only the sensors that the given user can see are kept (0 for the anonymous users)
+func getSensorsFilter(req *http.Request, userId int64) (string, database.QueryParams, error) {
+
+	qryParams := req.URL.Query()
+
+	where := `c."id" = s."channel_id" AND (c."owner_id" IS NULL OR c."owner_id" = $1)`
+	queryParams := database.QueryParams{userId}
+
+	addCondition := func(condition string, value interface{}) {
+		queryParams = append(queryParams, value)
+		where += " AND " + fmt.Sprintf(condition, len(queryParams))
+	}
+
+	// `quantity=unknown` lists the sensors that are not classified
+	if quantity := qryParams.Get("quantity"); quantity == "unknown" {
+		where += ` AND s."quantity" IS NULL`
+	} else if quantity != "" {
+		if _, ok := datacollection.GetQuantity(quantity); !ok {
+			return "", nil, fmt.Errorf("invalid quantity")
+		}
+		addCondition(`s."quantity" = $%d`, quantity)
+	}
+
+	if unit := qryParams.Get("unit"); unit != "" {
+		addCondition(`s."unit" = $%d`, unit)
+	}
+
+	return where, queryParams, nil
+}
+
+/*-------------*/
+
 /*
 * This function implements GET /sensors/:sensor_id
  */
@@ -78,9 +123,7 @@ func GetSensor(resp http.ResponseWriter, req *http.Request, params routing.Param
 
 	/*------*/
 
-	SQL := `SELECT * FROM "sensors" WHERE "id" = $1`
-
-	rows, err := global.DB.Query(SQL, database.QueryParams{sensor_id})
+	rows, err := getVisibleSensor(sensor_id, getOptionalUserID(resp, req))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -95,21 +138,73 @@ func GetSensor(resp http.ResponseWriter, req *http.Request, params routing.Param
 	tools.SendJSON(resp, rows[0])
 }
 
+/*-------------*/
+
+// getVisibleSensor loads a sensor if the given user can see its channel, i.e. it is public or one of their private channels
+func getVisibleSensor(sensorId interface{}, userId int64) (database.QueryResult, error) {
+
+	SQL := `SELECT s.*
+			FROM
+				"sensors"	AS s,
+				"channels"	AS c
+			WHERE
+				c."id" = s."channel_id" AND
+				s."id" = $1 AND
+				(c."owner_id" IS NULL OR c."owner_id" = $2)`
+	return global.DB.Query(SQL, database.QueryParams{sensorId, userId})
+}
+
+const notSensorOwnerMessage = "Forbidden: only the owner of the private channel or the admin users (`ADMIN_USERS`) can change this sensor"
+
+// canChangeSensor tells if a user can change what everyone sees of a sensor:
+// the admins for all the sensors, and the owners of the private channels for their sensors
+func canChangeSensor(sensorId interface{}, userId int64) (bool, error) {
+
+	if isAdminUser(userId) {
+		return true, nil
+	}
+
+	SQL := `SELECT s."id"
+			FROM
+				"sensors"	AS s,
+				"channels"	AS c
+			WHERE
+				c."id" = s."channel_id" AND
+				s."id" = $1 AND
+				c."owner_id" = $2`
+	rows, err := global.DB.Query(SQL, database.QueryParams{sensorId, userId})
+	return len(rows) > 0, err
+}
+
 /*-------------*/
 /*
 * This function implements GET /search/sensors/:query
+* The query is searched in the names and the quantities of the sensors
  */
 func GetSearchSensors(resp http.ResponseWriter, req *http.Request, params routing.Params) {
 
 	query := params.ByName("query")
 	limit, offset, page := tools.GetLimitOffset(req)
 
+	where, queryParams, err := getSensorsFilter(req, getOptionalUserID(resp, req))
+	if err != nil {
+		http.Error(resp, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	queryParams = append(queryParams, "%"+query+"%")
+	where += fmt.Sprintf(` AND (s."name" ILIKE $%[1]d OR s."quantity" ILIKE $%[1]d)`, len(queryParams))
+
 	/*------*/
 
 	totalRows := int64(0)
 	{
-		SQL := `SELECT COUNT(*) AS "total" FROM "sensors" WHERE "name" ILIKE $1`
-		rows, err := global.DB.Query(SQL, database.QueryParams{"%" + query + "%"})
+		SQL := `SELECT COUNT(*) AS "total"
+				FROM
+					"sensors"	AS s,
+					"channels"	AS c
+				WHERE ` + where
+		rows, err := global.DB.Query(SQL, queryParams)
 		if err != nil {
 			log.Printf("Error in db query: %v", err)
 			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -127,18 +222,16 @@ func GetSearchSensors(resp http.ResponseWriter, req *http.Request, params routin
 
 	/*------*/
 
-	SQL := `SELECT 
+	SQL := fmt.Sprintf(`SELECT 
 				s.*,
 				c."name"	AS "channel_name"
 			FROM 
 				"sensors"	AS s,
 				"channels"		AS c
-			WHERE
-				c."id" = s."channel_id" AND
-				s."name" ILIKE $1
-			LIMIT $2 OFFSET $3`
+			WHERE %s
+			LIMIT $%d OFFSET $%d`, where, len(queryParams)+1, len(queryParams)+2)
 
-	rows, err := global.DB.Query(SQL, database.QueryParams{"%" + query + "%", limit, offset})
+	rows, err := global.DB.Query(SQL, append(queryParams, limit, offset))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -172,6 +265,45 @@ func GetSensorValues(resp http.ResponseWriter, req *http.Request, params routing
 
 	limit, offset, page := tools.GetLimitOffset(req)
 
+	sensorRows, err := getVisibleSensor(sensor_id, getOptionalUserID(resp, req))
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(sensorRows) == 0 {
+		http.Error(resp, "Sensor not found!", http.StatusNotFound)
+		return
+	}
+
+	/*------*/
+
+	// Optional range of the numeric values
+	where := ""
+	queryParams := database.QueryParams{sensor_id}
+	for _, filter := range []struct{ name, operator string }{{"min", ">="}, {"max", "<="}} {
+
+		valueStr := req.URL.Query().Get(filter.name)
+		if valueStr == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			http.Error(resp, "Bad Request: invalid "+filter.name, http.StatusBadRequest)
+			return
+		}
+
+		queryParams = append(queryParams, value)
+		where += fmt.Sprintf(` AND v."value_num" %s $%d`, filter.operator, len(queryParams))
+	}
+
+	// The values that are not checked yet are kept
+	if excludeFlagged, _ := strconv.ParseBool(req.URL.Query().Get("exclude_flagged")); excludeFlagged {
+		where += ` AND COALESCE(v."quality_flags", 0) = 0`
+	}
+
 	/*------*/
 
 	totalRows := int64(0)
@@ -184,8 +316,8 @@ func GetSensorValues(resp http.ResponseWriter, req *http.Request, params routing
 				WHERE 
 					s."id" = $1 AND
 					s."id" = v."sensor_id" AND
-					v."value" != ''`
-		rows, err := global.DB.Query(SQL, database.QueryParams{sensor_id})
+					v."value" != ''` + where
+		rows, err := global.DB.Query(SQL, queryParams)
 		if err != nil {
 			log.Printf("Error in db query: %v", err)
 			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
@@ -202,23 +334,86 @@ func GetSensorValues(resp http.ResponseWriter, req *http.Request, params routing
 	}
 
 	/*------*/
-	SQL := `SELECT s."name", v.* 
+	// The location and the status of the entry come along for the mobile channels
+	SQL := fmt.Sprintf(`SELECT s."name", s."value_type", v.*,
+				e."latitude", e."longitude", e."elevation", e."status"
 			FROM 
-				"sensors"			AS	s,
-				"sensor_values"		AS	v
+				"sensors"			AS	s
+				JOIN "sensor_values"	AS	v ON s."id" = v."sensor_id"
+				LEFT JOIN "channel_entries"	AS	e ON e."channel_id" = s."channel_id" AND e."entry_id" = v."entry_id"
 			WHERE 
 				s."id" = $1 AND
-				s."id" = v."sensor_id" AND
-				v."value" != ''
-			ORDER BY "entry_id" DESC
-			LIMIT $2 OFFSET $3`
+				v."value" != ''%s
+			ORDER BY v."entry_id" DESC
+			LIMIT $%d OFFSET $%d`, where, len(queryParams)+1, len(queryParams)+2)
 
-	rows, err := global.DB.Query(SQL, database.QueryParams{sensor_id, limit, offset})
+	rows, err := global.DB.Query(SQL, append(queryParams, limit, offset))
 	if err != nil {
 		log.Printf("Error in db query: %v", err)
 		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	for _, row := range rows {
+		flags, _ := row["quality_flags"].(int64)
+		row["quality_issues"] = datacollection.QualityIssues(flags)
+	}
+
 	tools.SendJSON(resp, map[string]interface{}{"pagination": pagination, "rows": rows})
 }
+
+/*-------------*/
+
+/*
+* This function implements POST /sensors/:sensor_id/qualityCheck
+* It clears the quality flags of the values of the sensor, so they are checked again in the next collection run
+ */
+func PostSensorQualityCheck(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	userId, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	sensor_id, err := strconv.ParseInt(params.ByName("sensor_id"), 10, 64)
+	if err != nil {
+		sensor_id = 0
+	}
+
+	sensorRows, err := getVisibleSensor(sensor_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(sensorRows) == 0 {
+		http.Error(resp, "Sensor not found!", http.StatusNotFound)
+		return
+	}
+
+	// The flags of a public sensor are shared, and the whole history is checked again
+	allowed, err := canChangeSensor(sensor_id, userId)
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(resp, notSensorOwnerMessage, http.StatusForbidden)
+		return
+	}
+
+	if err := datacollection.RecheckQuality(sensor_id); err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
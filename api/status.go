@@ -1,10 +1,14 @@
 package api
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
 	"sensor-data-simulator/global"
+	"sensor-data-simulator/leader"
 	"sensor-data-simulator/tools"
 
 	routing "github.com/julienschmidt/httprouter"
@@ -18,7 +22,34 @@ import (
 
 func GetDataCollectionStatus(resp http.ResponseWriter, req *http.Request, params routing.Params) {
 
-	tools.SendJSON(resp, global.DataCollectorProgress)
+	leases, err := leader.GetLeases()
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The progress is the one of this instance, only the leader of the collection has one
+	status := struct {
+		global.DataCollectorStatus
+		InstanceId string
+		IsLeader   bool
+		Leader     string
+		Leases     []leader.Lease
+	}{
+		DataCollectorStatus: global.DataCollectorProgress.Status(),
+		InstanceId:          leader.InstanceId(),
+		IsLeader:            leader.IsLeader(leader.Collection),
+		Leases:              leases,
+	}
+
+	for _, lease := range leases {
+		if lease.Name == leader.Collection {
+			status.Leader = lease.Holder
+		}
+	}
+
+	tools.SendJSON(resp, status)
 }
 
 /*-------------*/
@@ -78,3 +109,138 @@ func GetDataCollectionStatistics(resp http.ResponseWriter, req *http.Request, pa
 }
 
 /*-------------*/
+/*
+* This function implements GET /dataCollection/runs
+* It retrieves the history of the data collection runs, the latest first
+ */
+
+func GetDataCollectionRuns(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	limit, offset, page := tools.GetLimitOffset(req)
+
+	/*------*/
+
+	totalRows := int64(0)
+	{
+		SQL := `SELECT COUNT(*) AS "total" FROM "collection_runs"`
+		rows, err := global.DB.Query(SQL, database.QueryParams{})
+		if err != nil {
+			log.Printf("Error in db query: %v", err)
+			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		totalRows = rows[0]["total"].(int64)
+	}
+
+	totalPages := int64(math.Ceil(float64(totalRows) / float64(global.RowsPerPage)))
+	pagination := map[string]interface{}{
+		"current_page":  page,
+		"total_pages":   totalPages,
+		"total_entries": totalRows,
+	}
+
+	/*------*/
+
+	SQL := `SELECT * FROM "collection_runs" ORDER BY "id" DESC LIMIT $1 OFFSET $2`
+
+	rows, err := global.DB.Query(SQL, database.QueryParams{limit, offset})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tools.SendJSON(resp, map[string]interface{}{"pagination": pagination, "rows": rows})
+}
+
+/*-------------*/
+/*
+* This function implements POST /dataCollection/run
+* It starts a full data collection run right away
+ */
+
+func PostDataCollectionRun(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	_, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	if !leader.IsLeader(leader.Collection) {
+		// The leader picks the request up from the database
+		if err := datacollection.SendRunRequest(datacollection.TriggerAPI); err != nil {
+			log.Printf("Error in db query: %v", err)
+			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusAccepted)
+		resp.Write([]byte(sentToLeaderMessage(leader.Collection)))
+		return
+	}
+
+	err = datacollection.RunNow(datacollection.TriggerAPI)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusConflict)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
+/*
+* This function implements POST /dataCollection/cancel
+* It stops the current data collection run
+ */
+
+func PostDataCollectionCancel(resp http.ResponseWriter, req *http.Request, params routing.Params) {
+
+	_, err := getAuthorizedUserID(resp, req)
+	if err != nil {
+		http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	/*------------*/
+
+	if !leader.IsLeader(leader.Collection) {
+		// The leader picks the request up from the database
+		if err := datacollection.SendCancelRequest(); err != nil {
+			log.Printf("Error in db query: %v", err)
+			http.Error(resp, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.WriteHeader(http.StatusAccepted)
+		resp.Write([]byte(sentToLeaderMessage(leader.Collection)))
+		return
+	}
+
+	if !datacollection.CancelRun() {
+		http.Error(resp, "No data collection run is in progress", http.StatusConflict)
+		return
+	}
+
+	resp.Write([]byte("OK"))
+}
+
+/*-------------*/
+
+// sentToLeaderMessage tells which instance gets a request made on another one
+func sentToLeaderMessage(name string) string {
+
+	leases, err := leader.GetLeases()
+	if err == nil {
+		for _, lease := range leases {
+			if lease.Name == name {
+				return fmt.Sprintf("Accepted: the request is sent to the instance `%v` that leads the %v", lease.Holder, name)
+			}
+		}
+	}
+
+	return fmt.Sprintf("Accepted: the request is sent to the instance that leads the %v", name)
+}
+
+/*-------------*/
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sensor-data-simulator/dataimport"
+	"sensor-data-simulator/dbinit"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*--------------------------------*/
+
+// commands are run with `app <command> [flags]` instead of the server
+var commands = map[string]func(args []string) error{
+	"seed":   seedCommand,
+	"import": importCommand,
+}
+
+/*--------------------------------*/
+
+// seedCommand fills the database with synthetic data: `app seed [-channels N] [-days N]`
+func seedCommand(args []string) error {
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	channelsCount := flags.Int("channels", envInt(global.ENV.SEED_CHANNELS), "number of channels to seed")
+	days := flags.Int("days", envInt(global.ENV.SEED_DAYS), "days of values for each channel")
+	flags.Parse(args)
+
+	log.Printf("Seeding the database...")
+	if err := dbinit.SeedDatabase(seedChannels, *channelsCount, *days); err != nil {
+		return err
+	}
+	log.Printf("Done")
+	return nil
+}
+
+/*--------------------------------*/
+
+// importCommand imports a CSV file into a new public channel or an imported channel:
+// `app import [-name N] [-channel ID] [-columns field1:Temperature,...] [-time-format F] ... file.csv`
+func importCommand(args []string) error {
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	channelId := flags.Int64("channel", 0, "id of an imported channel to add the entries to, a new channel if not set")
+	name := flags.String("name", "", "name of the new channel, the file name if not set")
+	description := flags.String("description", "", "description of the new channel")
+	columns := flags.String("columns", "", "columns to import and their sensor names, e.g. field1:Temperature,field2:Humidity (default all)")
+	timeColumn := flags.String("time-column", "", "the timestamp column (default created_at, timestamp, time, date or datetime)")
+	timeFormat := flags.String("time-format", "", "Go layout of the timestamps, unix or unix_ms (default the usual formats)")
+	timeZone := flags.String("time-zone", "", "time zone of the timestamps without one, e.g. Europe/Berlin (default UTC)")
+	entryIdColumn := flags.String("entry-id-column", "", "the entry id column (default entry_id, numbered if missing)")
+	delimiter := flags.String("delimiter", "", "delimiter of the columns (default guessed from , ; and tab)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("exactly one file is expected, see `app import -h`")
+	}
+	fileName := flags.Arg(0)
+
+	opts := dataimport.Options{
+		ChannelId:     *channelId,
+		ChannelName:   *name,
+		Description:   *description,
+		TimeColumn:    *timeColumn,
+		TimeFormat:    *timeFormat,
+		TimeZone:      *timeZone,
+		EntryIdColumn: *entryIdColumn,
+		Columns:       dataimport.ParseColumns(*columns),
+	}
+
+	if opts.ChannelName == "" {
+		opts.ChannelName = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	}
+
+	if *delimiter != "" {
+		if *delimiter == `\t` || *delimiter == "tab" {
+			*delimiter = "\t"
+		}
+		if utf8.RuneCountInString(*delimiter) != 1 {
+			return errors.New("invalid delimiter")
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(*delimiter)
+	}
+
+	/*---------*/
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := dataimport.ImportCSV(file, opts)
+	if err != nil {
+		return err
+	}
+
+	output, _ := json.MarshalIndent(result, "", "  ")
+	log.Printf("Done\n%s", output)
+	return nil
+}
+
+/*--------------------------------*/
+
+// envInt reads a number from an env variable, 0 if it is not set
+func envInt(value string) int {
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+/*--------------------------------*/
@@ -84,6 +84,22 @@ func (db *Database) Insert(table string, fields RowType, tags ...map[string]stri
 
 /*-----------------------*/
 
+// BulkInsert inserts many rows with the given columns in as few statements as possible,
+// with onConflictDoNothing the rows that violate a unique constraint are silently skipped
+func (db *Database) BulkInsert(table string, columns []string, rows []QueryParams, onConflictDoNothing bool) (ExecResult, error) {
+
+	switch db.Type {
+	case InfluxDB:
+		return ExecResult{}, nil // Not implemented
+	case Postgres:
+		return db.PostgresBulkInsert(table, columns, rows, onConflictDoNothing)
+	}
+
+	return ExecResult{}, nil //TODO: provide a useful error here
+}
+
+/*-----------------------*/
+
 func (db *Database) Update(table string, fields RowType, conditions RowType) (ExecResult, error) {
 
 	switch db.Type {
@@ -52,6 +52,71 @@ func (db *Database) PostgresInsert(table string, fields RowType) (ExecResult, er
 
 /*-----------------*/
 
+// Postgres accepts at most 65535 parameters in a statement
+const postgresMaxParams = 65535
+
+func (db *Database) PostgresBulkInsert(table string, columns []string, rows []QueryParams, onConflictDoNothing bool) (ExecResult, error) {
+
+	var output ExecResult
+
+	if len(columns) == 0 {
+		return output, nil
+	}
+
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = fmt.Sprintf(`"%s"`, column)
+	}
+
+	rowsPerStatement := postgresMaxParams / len(columns)
+
+	for start := 0; start < len(rows); start += rowsPerStatement {
+
+		end := start + rowsPerStatement
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var SQL strings.Builder
+		fmt.Fprintf(&SQL, `INSERT INTO "%s" (%s) VALUES `, table, strings.Join(quotedColumns, ","))
+
+		params := make(QueryParams, 0, (end-start)*len(columns))
+		for i, row := range rows[start:end] {
+
+			if len(row) != len(columns) {
+				return output, fmt.Errorf("row %d has %d values for %d columns", start+i, len(row), len(columns))
+			}
+
+			if i > 0 {
+				SQL.WriteString(",")
+			}
+			SQL.WriteString("(")
+			for j, value := range row {
+				if j > 0 {
+					SQL.WriteString(",")
+				}
+				params = append(params, value)
+				fmt.Fprintf(&SQL, "$%d", len(params))
+			}
+			SQL.WriteString(")")
+		}
+
+		if onConflictDoNothing {
+			SQL.WriteString(" ON CONFLICT DO NOTHING")
+		}
+
+		res, err := db.PostgresExec(SQL.String(), params)
+		if err != nil {
+			return output, err
+		}
+		output.RowsAffected += res.RowsAffected
+	}
+
+	return output, nil
+}
+
+/*-----------------*/
+
 func (db *Database) PostgresUpdate(table string, fields RowType, conditions RowType) (ExecResult, error) {
 
 	SQL := fmt.Sprintf(`UPDATE "%s" SET `, table)
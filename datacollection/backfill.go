@@ -0,0 +1,235 @@
+package datacollection
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The number of entries requested per page, 8000 is the maximum that ThingSpeak returns
+const backfillPageSize = 8000
+
+const (
+	BackfillPending = "pending"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+/*--------------------------------*/
+
+// InitBackfill starts the worker that goes through the queued backfills
+// and pages backwards through the history of each channel.
+// A backfill keeps its cursor (`oldest_entry_at`) in the DB, so it is resumed after a restart
+func InitBackfill(ctx context.Context) {
+
+	collectorWG.Add(1)
+	go func() {
+		defer collectorWG.Done()
+
+		for {
+
+			// The failed ones are retried after a while, from where they stopped
+			SQL := `SELECT * FROM "channel_backfills"
+					WHERE
+						"status" IN ($1, $2) OR
+						("status" = $3 AND "updated_at" < $4)
+					ORDER BY "requested_at" ASC`
+			retryTime := time.Now().UTC().Add(-1 * time.Hour)
+
+			rows, err := global.DB.Query(SQL, database.QueryParams{BackfillPending, BackfillRunning, BackfillFailed, retryTime})
+			if err != nil {
+				log.Printf("\n[BACKFILL] Error in loading the queue: %v", err)
+			}
+
+			for _, row := range rows {
+				if ctx.Err() != nil {
+					break
+				}
+				processBackfill(ctx, row)
+			}
+
+			if sleepContext(ctx, 1*time.Minute) != nil {
+				return
+			}
+		}
+	}()
+}
+
+/*--------------------------------*/
+
+// QueueBackfill adds a channel to the backfill queue or resumes its backfill,
+// a zero horizon means the default one (`BACKFILL_HORIZON_DAYS`)
+func QueueBackfill(channelId int64, horizon time.Time) error {
+
+	if horizon.IsZero() {
+		horizon = defaultBackfillHorizon()
+	}
+
+	var horizonParam interface{}
+	if !horizon.IsZero() {
+		horizonParam = horizon.UTC()
+	}
+
+	SQL := `INSERT INTO "channel_backfills" ("channel_id", "status", "horizon", "requested_at")
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT ("channel_id") DO UPDATE SET
+				"status" = EXCLUDED."status",
+				"horizon" = EXCLUDED."horizon",
+				"requested_at" = EXCLUDED."requested_at",
+				"error" = NULL`
+
+	params := database.QueryParams{channelId, BackfillPending, horizonParam, time.Now().UTC()}
+	_, err := global.DB.Exec(SQL, params)
+	if err != nil {
+		log.Printf("\nError in queuing backfill: %v \nSQL: %v\nParams: %v", err, SQL, params)
+	}
+
+	return err
+}
+
+/*--------------------------------*/
+
+func defaultBackfillHorizon() time.Time {
+
+	days, _ := strconv.Atoi(global.ENV.BACKFILL_HORIZON_DAYS)
+	if days <= 0 {
+		return time.Time{} // The whole history
+	}
+
+	return time.Now().AddDate(0, 0, -days)
+}
+
+/*--------------------------------*/
+
+func processBackfill(ctx context.Context, backfill database.RowType) {
+
+	channelId := backfill["channel_id"].(int64)
+
+	channels, err := global.DB.Load("channels", database.RowType{"id": channelId})
+	if err != nil || len(channels) == 0 {
+		updateBackfill(channelId, database.RowType{"status": BackfillFailed, "error": "channel not found"})
+		return
+	}
+	channel := channels[0]
+
+	srcName, _ := channel["source"].(string)
+	src, ok := GetSource(srcName)
+	if !ok {
+		updateBackfill(channelId, database.RowType{"status": BackfillFailed, "error": fmt.Sprintf("source `%v` is not enabled", srcName)})
+		return
+	}
+
+	// We stop at the creation of the channel or at the horizon, whichever is later
+	stopAt, _ := channel["created_at"].(time.Time)
+	if horizon, ok := backfill["horizon"].(time.Time); ok && horizon.After(stopAt) {
+		stopAt = horizon
+	}
+
+	// The end is inclusive: the channels often have several entries in the same second,
+	// the ones of that second that are already stored are skipped on insert
+	end := time.Now().UTC()
+	if oldest, ok := backfill["oldest_entry_at"].(time.Time); ok {
+		end = oldest
+	}
+
+	lowestEntryId := int64(0) // The oldest entry so far, 0 before the first page
+
+	apiKey, err := channelApiKey(channel)
+	if err != nil {
+		updateBackfill(channelId, database.RowType{"status": BackfillFailed, "error": err.Error()})
+		return
+	}
+
+	updateBackfill(channelId, database.RowType{"status": BackfillRunning})
+
+	for {
+
+		if !end.After(stopAt) {
+			break
+		}
+
+		feed, err := src.FetchFeed(ctx, fmt.Sprint(channelId), FeedOptions{Start: stopAt, End: end, Results: backfillPageSize, ApiKey: apiKey})
+		if ctx.Err() != nil {
+			return // Stays `running`, so it is resumed on the next start
+		}
+		if err != nil {
+			log.Printf("\n[BACKFILL] Channel: %v, Err: %v", channelId, err)
+			updateBackfill(channelId, database.RowType{"status": BackfillFailed, "error": err.Error()})
+			return
+		}
+
+		if len(feed.Entries) == 0 {
+			break
+		}
+
+		// A page with nothing older than the previous ones means we are done
+		pageLowestEntryId := feed.Entries[0].EntryId
+		for _, rec := range feed.Entries {
+			if rec.EntryId < pageLowestEntryId {
+				pageLowestEntryId = rec.EntryId
+			}
+		}
+		if lowestEntryId != 0 && pageLowestEntryId >= lowestEntryId {
+			break
+		}
+		lowestEntryId = pageLowestEntryId
+
+		newValues, newSensors, err := storeFeedEntries(channelId, feed)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.NewExtractedSensors += newSensors })
+		if err != nil {
+			updateBackfill(channelId, database.RowType{"status": BackfillFailed, "error": err.Error()})
+			return
+		}
+
+		oldest := feed.Entries[0].CreatedAt
+		for _, rec := range feed.Entries {
+			if rec.CreatedAt.Before(oldest) {
+				oldest = rec.CreatedAt
+			}
+		}
+
+		SQL := `UPDATE "channel_backfills"
+				SET
+					"oldest_entry_at" = $1,
+					"values_count" = "values_count" + $2,
+					"updated_at" = $3
+				WHERE
+					"channel_id" = $4`
+		params := database.QueryParams{oldest.UTC(), newValues, time.Now().UTC(), channelId}
+		if _, err := global.DB.Exec(SQL, params); err != nil {
+			log.Printf("\nError in updating `channel_backfills`: %v \nSQL: %v\nParams: %v", err, SQL, params)
+			return
+		}
+
+		fmt.Printf("\r[BACKFILL] Channel: %-10v reached: %v", channelId, oldest.Format(time.RFC3339))
+
+		if len(feed.Entries) < backfillPageSize {
+			break // That was the last page of the range
+		}
+
+		end = oldest
+	}
+
+	updateBackfill(channelId, database.RowType{"status": BackfillDone, "finished_at": time.Now().UTC()})
+}
+
+/*--------------------------------*/
+
+func updateBackfill(channelId int64, fields database.RowType) {
+
+	fields["updated_at"] = time.Now().UTC()
+
+	_, err := global.DB.Update("channel_backfills", fields, database.RowType{"channel_id": channelId})
+	if err != nil {
+		log.Printf("\nError in updating `channel_backfills`: %v \nFields: %v", err, fields)
+	}
+}
+
+/*--------------------------------*/
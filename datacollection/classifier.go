@@ -0,0 +1,579 @@
+package datacollection
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// Quantity is what a sensor measures, e.g. `temperature` in °C
+type Quantity struct {
+	Name string
+	Unit string // the usual unit, the one that Min and Max are in
+
+	// Each phrase is a list of words that all have to be in the name of the sensor.
+	// A word matches the beginning of a word of the name, `=word` matches the whole word only
+	// and `*word` matches anywhere in a word (for the compound words, e.g. `Außentemperatur`)
+	Phrases [][]string
+
+	// The possible values in the usual unit, if there is a limit
+	HasRange bool
+	Min, Max float64
+}
+
+// The quantities are checked in this order, so the specific ones come first (e.g. `soil moisture` before `moisture`).
+// The words come from the names of the channels and sensors seen on ThingSpeak (e.g. `ui/extTools/names.json`),
+// they are lower case and without accents
+var quantities = []Quantity{
+	{Name: "dew_point", Unit: "°C", HasRange: true, Min: -90, Max: 60, Phrases: [][]string{
+		{"dew", "point"}, {"dewpoint"}, {"punto", "rocio"}, {"point", "rosee"}, {"ponto", "orvalho"},
+		{"punto", "rugiada"}, {"*taupunkt"}, {"kastepiste"}, {"=td"},
+	}},
+	{Name: "soil_moisture", Unit: "%", HasRange: true, Min: 0, Max: 100, Phrases: [][]string{
+		{"soil", "moist"}, {"soil", "hum"}, {"soil", "wet"}, {"soil", "water"}, {"hum", "suelo"}, {"hum", "tierra"},
+		{"umid", "solo"}, {"umid", "terr"}, {"hum", "sol"}, {"*bodenfeucht"}, {"kelembaban", "tanah"},
+		{"maankosteus"}, {"wilgot", "gleb"}, {"moisture"}, {"=soil"},
+	}},
+	{Name: "battery_level", Unit: "%", HasRange: true, Min: 0, Max: 100, Phrases: [][]string{
+		{"bat", "level"}, {"bat", "percent"}, {"bat", "pct"}, {"bat", "charge"}, {"=soc"}, {"nivel", "bat"},
+	}},
+	{Name: "battery_voltage", Unit: "V", HasRange: true, Min: 0, Max: 60, Phrases: [][]string{
+		{"bat"}, {"akku"}, {"vbat"}, {"=vcc"}, {"=accu"},
+	}},
+	{Name: "pm1", Unit: "µg/m³", HasRange: true, Min: 0, Max: 2000, Phrases: [][]string{{"=pm1"}}},
+	{Name: "pm25", Unit: "µg/m³", HasRange: true, Min: 0, Max: 2000, Phrases: [][]string{{"=pm25"}, {"=dust"}, {"*feinstaub"}}},
+	{Name: "pm10", Unit: "µg/m³", HasRange: true, Min: 0, Max: 2000, Phrases: [][]string{{"=pm10"}}},
+	{Name: "co2", Unit: "ppm", HasRange: true, Min: 0, Max: 50000, Phrases: [][]string{
+		{"*co2"}, {"carbon", "dioxide"}, {"dioxido", "carbono"}, {"=mhz19"}, {"=scd30"},
+	}},
+	{Name: "co", Unit: "ppm", HasRange: true, Min: 0, Max: 10000, Phrases: [][]string{
+		{"=co"}, {"carbon", "monoxide"}, {"monoxido"}, {"=mq7"},
+	}},
+	{Name: "tvoc", Unit: "ppb", HasRange: true, Min: 0, Max: 100000, Phrases: [][]string{{"tvoc"}, {"=voc"}}},
+	{Name: "wind_direction", Unit: "°", HasRange: true, Min: 0, Max: 360, Phrases: [][]string{
+		{"wind", "dir"}, {"dir", "viento"}, {"dir", "vento"}, {"*windricht"}, {"=wd"}, {"=winddir"},
+	}},
+	{Name: "wind_speed", Unit: "m/s", HasRange: true, Min: 0, Max: 120, Phrases: [][]string{
+		{"wind"}, {"viento"}, {"vento"}, {"anemo"}, {"=ws"},
+	}},
+	{Name: "rainfall", Unit: "mm", HasRange: true, Min: 0, Max: 2000, Phrases: [][]string{
+		{"rain"}, {"precip"}, {"lluvia"}, {"pluie"}, {"chuva"}, {"pluv"}, {"*regen"}, {"pioggia"}, {"=sade"}, {"hujan"}, {"opad"},
+	}},
+	{Name: "relative_humidity", Unit: "%", HasRange: true, Min: 0, Max: 100, Phrases: [][]string{
+		{"hum"}, {"umid"}, {"*feucht"}, {"kosteus"}, {"kelembaban"}, {"wilgot"}, {"vlhk"}, {"влажн"}, {"*湿度"}, {"=rh"},
+	}},
+	{Name: "temperature", Unit: "°C", HasRange: true, Min: -90, Max: 100, Phrases: [][]string{
+		{"temp"}, {"*temperat"}, {"*lampo"}, {"suhu"}, {"teplot"}, {"thermo"}, {"температур"}, {"*温度"}, {"=t"},
+		{"=ds18b20"},
+	}},
+	{Name: "pressure", Unit: "hPa", HasRange: true, Min: 300, Max: 1100, Phrases: [][]string{
+		{"pres"}, {"*druck"}, {"baro"}, {"=tlak"}, {"cisnien"}, {"tekanan"}, {"ilmanpaine"}, {"давлен"}, {"=p"},
+	}},
+	{Name: "uv_index", Unit: "", HasRange: true, Min: 0, Max: 20, Phrases: [][]string{{"=uv"}, {"uvindex"}, {"=uvi"}, {"ultraviolet"}}},
+	{Name: "light", Unit: "lx", HasRange: true, Min: 0, Max: 200000, Phrases: [][]string{
+		{"light"}, {"=lux"}, {"=luz"}, {"luce"}, {"lumin"}, {"*licht"}, {"=ldr"}, {"illum"}, {"cahaya"}, {"valoisuus"},
+	}},
+	{Name: "water_level", Unit: "cm", Phrases: [][]string{
+		{"water", "level"}, {"nivel", "agua"}, {"livello", "acqua"}, {"*wasserstand"}, {"hidronivel"}, {"pegel"}, {"tank", "level"},
+	}},
+	{Name: "ph", Unit: "pH", HasRange: true, Min: 0, Max: 14, Phrases: [][]string{{"=ph"}}},
+	{Name: "turbidity", Unit: "NTU", HasRange: true, Min: 0, Max: 4000, Phrases: [][]string{{"turbid"}}},
+	{Name: "heart_rate", Unit: "bpm", HasRange: true, Min: 0, Max: 300, Phrases: [][]string{{"heart"}, {"=bpm"}, {"pulse"}, {"pulso"}}},
+	{Name: "weight", Unit: "kg", Phrases: [][]string{{"weight"}, {"peso"}, {"*gewicht"}, {"waage"}, {"berat"}, {"=massa"}, {"poids"}}},
+	{Name: "noise", Unit: "dB", HasRange: true, Min: 0, Max: 200, Phrases: [][]string{
+		{"noise"}, {"sound"}, {"ruido"}, {"rumore"}, {"=larm"}, {"decibel"}, {"=spl"}, {"=db"},
+	}},
+	{Name: "signal_strength", Unit: "dBm", HasRange: true, Min: -150, Max: 0, Phrases: [][]string{{"rssi"}, {"signal"}}},
+	{Name: "distance", Unit: "cm", Phrases: [][]string{{"dist"}, {"ultrason"}, {"=range"}}},
+	{Name: "energy", Unit: "kWh", Phrases: [][]string{{"energ"}, {"=kwh"}, {"consum"}}},
+	{Name: "power", Unit: "W", Phrases: [][]string{{"power"}, {"potenc"}, {"potenz"}, {"leistung"}, {"watt"}, {"=daya"}}},
+	{Name: "current", Unit: "A", Phrases: [][]string{{"current"}, {"corriente"}, {"corrente"}, {"=strom"}, {"=amp"}, {"ampere"}, {"=arus"}}},
+	{Name: "voltage", Unit: "V", Phrases: [][]string{{"volt"}, {"=tension"}, {"=tensao"}, {"spannung"}, {"tegangan"}, {"napeti"}, {"=vac"}, {"=vdc"}}},
+	{Name: "frequency", Unit: "Hz", Phrases: [][]string{{"freq"}}},
+	{Name: "altitude", Unit: "m", Phrases: [][]string{{"altitu"}, {"elevation"}, {"=alt"}}},
+}
+
+var quantitiesByName = func() map[string]*Quantity {
+	output := make(map[string]*Quantity)
+	for i := range quantities {
+		output[quantities[i].Name] = &quantities[i]
+	}
+	return output
+}()
+
+// Quantities returns all the known quantities
+func Quantities() []Quantity {
+	return quantities
+}
+
+// GetQuantity returns a known quantity by its name
+func GetQuantity(name string) (Quantity, bool) {
+
+	q, ok := quantitiesByName[name]
+	if !ok {
+		return Quantity{}, false
+	}
+	return *q, true
+}
+
+/*--------------------------------*/
+
+// The units that can be found in the names of the sensors, e.g. `PM2.5 (ug/m3)`.
+// Some of them also tell the quantity when the words of the name do not
+var unitPatterns = []struct {
+	Pattern  *regexp.Regexp
+	Unit     string
+	Quantity string // empty if the unit is used for many quantities
+}{
+	{regexp.MustCompile(`[°º]\s*c\b|\bdeg\s*c\b|\bcelsius\b`), "°C", "temperature"},
+	{regexp.MustCompile(`[°º]\s*f\b|\bdeg\s*f\b|\bfahrenheit\b`), "°F", "temperature"},
+	{regexp.MustCompile(`\bkelvin\b`), "K", "temperature"},
+	{regexp.MustCompile(`[uµμ]g\s*/\s*m\s*(3|³|\^3)`), "µg/m³", ""},
+	{regexp.MustCompile(`\bhpa\b|\bmbar\b`), "hPa", "pressure"},
+	{regexp.MustCompile(`\bkpa\b`), "kPa", "pressure"},
+	{regexp.MustCompile(`\bpsi\b`), "psi", "pressure"},
+	{regexp.MustCompile(`\binhg\b`), "inHg", "pressure"},
+	{regexp.MustCompile(`\bppm\b`), "ppm", ""},
+	{regexp.MustCompile(`\bppb\b`), "ppb", ""},
+	{regexp.MustCompile(`\bkwh\b`), "kWh", "energy"},
+	{regexp.MustCompile(`\bwh\b`), "Wh", "energy"},
+	{regexp.MustCompile(`\bkw\b`), "kW", "power"},
+	{regexp.MustCompile(`\bmv\b`), "mV", "voltage"},
+	{regexp.MustCompile(`\bma\b`), "mA", "current"},
+	{regexp.MustCompile(`\blux\b|\blx\b`), "lx", "light"},
+	{regexp.MustCompile(`\bm\s*/\s*s\b`), "m/s", "wind_speed"},
+	{regexp.MustCompile(`\bkm\s*/\s*h\b|\bkmh\b|\bkph\b`), "km/h", "wind_speed"},
+	{regexp.MustCompile(`\bmph\b`), "mph", "wind_speed"},
+	{regexp.MustCompile(`\bdbm\b`), "dBm", "signal_strength"},
+	{regexp.MustCompile(`\bdba?\b`), "dB", "noise"},
+	{regexp.MustCompile(`\bbpm\b`), "bpm", "heart_rate"},
+	{regexp.MustCompile(`\bhz\b`), "Hz", "frequency"},
+	{regexp.MustCompile(`\bntu\b`), "NTU", "turbidity"},
+	{regexp.MustCompile(`\bkg\b`), "kg", "weight"},
+	{regexp.MustCompile(`\bmm\b`), "mm", ""},
+	{regexp.MustCompile(`\bcm\b`), "cm", ""},
+	{regexp.MustCompile(`%|\bpercent\b|\bpct\b`), "%", ""},
+	// The single letters are only units between brackets, e.g. `Battery (V)`
+	{regexp.MustCompile(`[(\[]\s*v\s*[)\]]`), "V", "voltage"},
+	{regexp.MustCompile(`[(\[]\s*a\s*[)\]]`), "A", "current"},
+	{regexp.MustCompile(`[(\[]\s*w\s*[)\]]`), "W", "power"},
+	{regexp.MustCompile(`[(\[]\s*m\s*[)\]]`), "m", ""},
+}
+
+/*--------------------------------*/
+
+// Where the quantity of a sensor comes from, stored in `sensors.quantity_source`
+const (
+	QuantityFromName   = "name"   // a word of the name
+	QuantityFromUnit   = "unit"   // a unit in the name
+	QuantityFromValues = "values" // the range of the values
+	QuantityManual     = "manual" // set by a user, never changed by the classifier
+)
+
+type Classification struct {
+	Quantity string // empty if not found
+	Unit     string // empty if not known
+	Source   string
+}
+
+/*--------------------------------*/
+
+var accentsReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a", "ą", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e", "ě", "e", "ę", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u", "ů", "u",
+	"ç", "c", "ć", "c", "č", "c", "ñ", "n", "ń", "n", "ň", "n",
+	"ś", "s", "š", "s", "ß", "ss", "ł", "l", "ř", "r", "ý", "y",
+	"ź", "z", "ż", "z", "ž", "z", "æ", "ae", "œ", "oe",
+)
+
+// The particulate matter sizes are written in many ways: `PM2.5`, `pm 2,5`, `PM2_5`, `PM10.0`...
+var pmPattern = regexp.MustCompile(`pm\s*(\d+)(?:[.,_](\d+))?`)
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// nameWords returns the words of a sensor name, lower case and without accents
+func nameWords(name string) []string {
+
+	name = accentsReplacer.Replace(strings.ToLower(name))
+
+	name = pmPattern.ReplaceAllStringFunc(name, func(match string) string {
+		parts := pmPattern.FindStringSubmatch(match)
+		if parts[2] == "" || strings.Trim(parts[2], "0") == "" {
+			return " pm" + parts[1] + " "
+		}
+		return " pm" + parts[1] + parts[2] + " "
+	})
+
+	return wordPattern.FindAllString(name, -1)
+}
+
+func wordMatches(words []string, word string) bool {
+
+	for _, w := range words {
+		switch {
+		case strings.HasPrefix(word, "="):
+			if w == word[1:] {
+				return true
+			}
+		case strings.HasPrefix(word, "*"):
+			if strings.Contains(w, word[1:]) {
+				return true
+			}
+		default:
+			if strings.HasPrefix(w, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*--------------------------------*/
+
+// classifyName finds the quantity and the unit of a sensor from its name only
+func classifyName(name string) Classification {
+
+	output := Classification{}
+
+	words := nameWords(name)
+	for _, q := range quantities {
+		for _, phrase := range q.Phrases {
+
+			matched := true
+			for _, word := range phrase {
+				if !wordMatches(words, word) {
+					matched = false
+					break
+				}
+			}
+
+			if matched {
+				output.Quantity = q.Name
+				output.Source = QuantityFromName
+				break
+			}
+		}
+		if output.Quantity != "" {
+			break
+		}
+	}
+
+	/*---------*/
+
+	lowerName := strings.ToLower(name)
+	for _, u := range unitPatterns {
+		if !u.Pattern.MatchString(lowerName) {
+			continue
+		}
+
+		if output.Quantity == "" {
+			if u.Quantity == "" {
+				continue // e.g. a `%` alone says nothing
+			}
+			output.Quantity = u.Quantity
+			output.Source = QuantityFromUnit
+		}
+		output.Unit = u.Unit
+		break
+	}
+
+	// A battery in percent is its charge, e.g. `Battery (%)`
+	if output.Quantity == "battery_voltage" && output.Unit == "%" {
+		output.Quantity = "battery_level"
+	}
+
+	return output
+}
+
+/*--------------------------------*/
+
+// The parts of a free text that may each name a quantity, e.g. `(Temp, Hum, Presion, Lluvia, Viento)`
+var textPartsPattern = regexp.MustCompile(`[,;:()\[\]{}/&+|\n\r]+|\s(?i:and|und|et|y|e|dan|ja)\s`)
+
+// QuantitiesInText returns the quantities named in a free text, e.g. the description of a channel, in their order
+func QuantitiesInText(text string) []string {
+
+	var output []string
+	seen := make(map[string]bool)
+	for _, part := range textPartsPattern.Split(text, -1) {
+
+		// The units alone are not enough in a free text, e.g. `MA` is a state, not milliamperes
+		c := classifyName(part)
+		if c.Source != QuantityFromName || seen[c.Quantity] {
+			continue
+		}
+		seen[c.Quantity] = true
+		output = append(output, c.Quantity)
+	}
+	return output
+}
+
+/*--------------------------------*/
+
+// A quantity is only guessed from the values if there are enough of them
+const minClassifyValues = 20
+
+// ClassifySensor finds the quantity and the unit of a sensor from its name and its latest numeric values
+func ClassifySensor(name string, values []float64) Classification {
+
+	output := classifyName(name)
+
+	if len(values) < minClassifyValues {
+		if output.Quantity != "" && output.Unit == "" {
+			output.Unit = quantitiesByName[output.Quantity].Unit
+		}
+		return output
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	low := percentile(sorted, 0.05)
+	mid := percentile(sorted, 0.5)
+	high := percentile(sorted, 0.95)
+
+	if output.Quantity == "" {
+		output = classifyValues(low, mid, high)
+	} else if output.Unit == "" {
+		output.Unit = unitFromValues(quantitiesByName[output.Quantity], low, mid, high)
+	}
+
+	return output
+}
+
+/*--------------------------------*/
+
+// classifyValues guesses the quantity of a sensor from the range of its values,
+// only for the ranges that are hard to get for anything else
+func classifyValues(low float64, mid float64, high float64) Classification {
+
+	guess := func(quantity string, unit string) Classification {
+		return Classification{Quantity: quantity, Unit: unit, Source: QuantityFromValues}
+	}
+
+	switch {
+	case low >= 870 && high <= 1085:
+		return guess("pressure", "hPa") // the atmospheric pressure, from the highest mountains to the deepest valleys
+	case low >= 87000 && high <= 108500:
+		return guess("pressure", "Pa")
+	case low >= 2.5 && high <= 4.4 && high-low <= 1.5:
+		return guess("battery_voltage", "V") // a lithium cell
+	case low >= -40 && low < 5 && high <= 45:
+		return guess("temperature", "°C") // below 5 is too dry for the humidity
+	case low >= 5 && high <= 100 && high >= 60 && high-low >= 15:
+		return guess("relative_humidity", "%")
+	}
+
+	return Classification{}
+}
+
+/*--------------------------------*/
+
+// unitFromValues picks the unit of a quantity that fits the values,
+// it is empty if the values do not fit the quantity at all (e.g. the raw readings of a sensor)
+func unitFromValues(q *Quantity, low float64, mid float64, high float64) string {
+
+	switch q.Name {
+	case "temperature", "dew_point":
+		if low >= q.Min && high <= q.Max && mid <= 50 {
+			return "°C"
+		}
+		if low >= -130 && high <= 212 {
+			return "°F"
+		}
+		return ""
+
+	case "pressure":
+		switch {
+		case mid >= 300 && mid <= 1100:
+			return "hPa"
+		case mid >= 30 && mid <= 110:
+			return "kPa"
+		case mid >= 30000 && mid <= 110000:
+			return "Pa"
+		case mid >= 25 && mid <= 32:
+			return "inHg"
+		}
+		return ""
+
+	case "battery_voltage":
+		if mid > 1000 && high <= 60000 {
+			return "mV"
+		}
+	}
+
+	if q.HasRange && (low < q.Min || high > q.Max) {
+		return ""
+	}
+	return q.Unit
+}
+
+/*--------------------------------*/
+
+// percentile of sorted values, p from 0 to 1
+func percentile(sorted []float64, p float64) float64 {
+
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(math.Round(p*float64(len(sorted)-1)))]
+}
+
+/*--------------------------------*/
+
+const (
+	classifyValuesCount = 500            // latest values looked at for a sensor
+	reclassifyInterval  = 24 * time.Hour // the sensors without a quantity or a unit are tried again with their new values
+)
+
+// ClassifySensors finds the quantity and the unit of the sensors that are not classified yet.
+// The ones set manually are never changed
+func ClassifySensors(ctx context.Context) {
+
+	fmt.Print("\n\t\t* * * Classifying the sensors * * *\n\n")
+
+	SQL := `SELECT "id", "name", "value_type"
+			FROM "sensors"
+			WHERE
+				"value_type" IS NOT NULL AND
+				"quantity_source" IS DISTINCT FROM $1 AND
+				(
+					"classified_at" IS NULL OR
+					(("quantity" IS NULL OR "unit" IS NULL) AND "classified_at" < $2)
+				)`
+	sensors, err := global.DB.Query(SQL, database.QueryParams{QuantityManual, time.Now().UTC().Add(-reclassifyInterval)})
+	if err != nil {
+		log.Printf("\nError in loading the sensors: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+		return
+	}
+
+	pool := newWorkerPool(ctx, workersCount())
+	for _, sensor := range sensors {
+
+		sensor := sensor
+		if !pool.Submit(func(ctx context.Context) {
+			if err := classifySensor(sensor); err != nil {
+				log.Printf("\nError in classification of sensor %v: %v", sensor["id"], err)
+				global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+			}
+		}) {
+			break // Cancelled
+		}
+	}
+	pool.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	fmt.Printf("\n\nAll Done [ Classified sensors: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.Status().NewClassifiedSensors)
+}
+
+/*--------------------------------*/
+
+func classifySensor(sensor database.RowType) error {
+
+	sensorId := sensor["id"].(int64)
+	sensorName, _ := sensor["name"].(string)
+	valueType, _ := sensor["value_type"].(string)
+
+	var values []float64
+	if valueType == ValueNumeric {
+
+		SQL := `SELECT "value_num"
+				FROM "sensor_values"
+				WHERE "sensor_id" = $1 AND "value_num" IS NOT NULL
+				ORDER BY "entry_id" DESC
+				LIMIT $2`
+		rows, err := global.DB.Query(SQL, database.QueryParams{sensorId, classifyValuesCount})
+		if err != nil {
+			return err
+		}
+
+		values = make([]float64, 0, len(rows))
+		for _, row := range rows {
+			if value, ok := row["value_num"].(float64); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	c := Classification{}
+	if valueType != ValueText {
+		c = ClassifySensor(sensorName, values)
+	}
+
+	/*---------*/
+
+	var quantity, unit, source interface{}
+	if c.Quantity != "" {
+		quantity = c.Quantity
+		source = c.Source
+	}
+	if c.Unit != "" {
+		unit = c.Unit
+	}
+
+	// The quantity may be set manually while the sensor is classified, it is kept then
+	SQL := `UPDATE "sensors"
+			SET "quantity" = $1, "unit" = $2, "quantity_source" = $3, "classified_at" = $4
+			WHERE "id" = $5 AND "quantity_source" IS DISTINCT FROM $6`
+	res, err := global.DB.Exec(SQL, database.QueryParams{quantity, unit, source, time.Now().UTC(), sensorId, QuantityManual})
+	if err != nil {
+		return err
+	}
+
+	if c.Quantity != "" && res.RowsAffected > 0 {
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.NewClassifiedSensors++ })
+	}
+	return nil
+}
+
+/*--------------------------------*/
+
+// SetSensorQuantity sets the quantity and the unit of a sensor manually,
+// an empty quantity gives the sensor back to the classifier
+func SetSensorQuantity(sensorId int64, quantity string, unit string) error {
+
+	fields := database.RowType{
+		"quantity":        quantity,
+		"unit":            nil,
+		"quantity_source": QuantityManual,
+		"classified_at":   time.Now().UTC(),
+	}
+	if unit != "" {
+		fields["unit"] = unit
+	}
+	if quantity == "" {
+		fields = database.RowType{
+			"quantity":        nil,
+			"unit":            nil,
+			"quantity_source": nil,
+			"classified_at":   nil,
+		}
+	}
+
+	_, err := global.DB.Update("sensors", fields, database.RowType{"id": sensorId})
+	if err != nil {
+		return err
+	}
+
+	// The physical range may have changed
+	return RecheckQuality(sensorId)
+}
+
+/*--------------------------------*/
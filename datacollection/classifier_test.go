@@ -0,0 +1,157 @@
+package datacollection
+
+import "testing"
+
+/*--------------------------------*/
+
+// testValues returns count values spread evenly from low to high
+func testValues(low float64, high float64, count int) []float64 {
+
+	values := make([]float64, count)
+	for i := range values {
+		values[i] = low + (high-low)*float64(i)/float64(count-1)
+	}
+	return values
+}
+
+/*--------------------------------*/
+
+func TestClassifyName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		want Classification
+	}{
+		{"Temperature", Classification{"temperature", "", QuantityFromName}},
+		{"Temp (°C)", Classification{"temperature", "°C", QuantityFromName}},
+		{"temperature F", Classification{"temperature", "", QuantityFromName}},
+		{"Temperatura °F", Classification{"temperature", "°F", QuantityFromName}},
+		{"Außentemperatur", Classification{"temperature", "", QuantityFromName}},
+		{"T", Classification{"temperature", "", QuantityFromName}},
+		{"Dew Point", Classification{"dew_point", "", QuantityFromName}},
+		{"Humidity %", Classification{"relative_humidity", "%", QuantityFromName}},
+		{"Luftfeuchtigkeit", Classification{"relative_humidity", "", QuantityFromName}},
+		{"Soil Moisture", Classification{"soil_moisture", "", QuantityFromName}},
+		{"Humedad del suelo", Classification{"soil_moisture", "", QuantityFromName}},
+		{"Pressure hPa", Classification{"pressure", "hPa", QuantityFromName}},
+		{"Wind direction", Classification{"wind_direction", "", QuantityFromName}},
+		{"Wind speed (km/h)", Classification{"wind_speed", "km/h", QuantityFromName}},
+
+		// The particulate matter sizes
+		{"PM2.5 (ug/m3)", Classification{"pm25", "µg/m³", QuantityFromName}},
+		{"pm 2,5", Classification{"pm25", "", QuantityFromName}},
+		{"PM2_5", Classification{"pm25", "", QuantityFromName}},
+		{"PM10.0", Classification{"pm10", "", QuantityFromName}},
+		{"PM1", Classification{"pm1", "", QuantityFromName}},
+
+		// The batteries
+		{"Battery", Classification{"battery_voltage", "", QuantityFromName}},
+		{"Battery (V)", Classification{"battery_voltage", "V", QuantityFromName}},
+		{"Battery (%)", Classification{"battery_level", "%", QuantityFromName}},
+		{"Battery level", Classification{"battery_level", "", QuantityFromName}},
+
+		// The quantity comes from the unit
+		{"Field 1 (mV)", Classification{"voltage", "mV", QuantityFromUnit}},
+		{"Sensor 2 [V]", Classification{"voltage", "V", QuantityFromUnit}},
+		{"Field 3 lx", Classification{"light", "lx", QuantityFromUnit}},
+		{"Field 4 (kWh)", Classification{"energy", "kWh", QuantityFromName}}, // `kwh` is also a word of the energy
+
+		// Nothing known
+		{"Field 1", Classification{}},
+		{"ppm", Classification{}}, // Many quantities are in ppm
+		{"%", Classification{}},
+		{"", Classification{}},
+	}
+
+	for _, test := range tests {
+		if got := classifyName(test.name); got != test.want {
+			t.Errorf("classifyName(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestClassifySensor(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   Classification
+	}{
+		// Not enough values, the usual unit of the quantity
+		{"Temperature", nil, Classification{"temperature", "°C", QuantityFromName}},
+		{"Humidity", testValues(40, 90, minClassifyValues-1), Classification{"relative_humidity", "%", QuantityFromName}},
+		{"Field 1", testValues(990, 1020, minClassifyValues-1), Classification{}},
+		{"Temp (°F)", nil, Classification{"temperature", "°F", QuantityFromName}},
+
+		// The unit from the values
+		{"Temperature", testValues(18, 25, 30), Classification{"temperature", "°C", QuantityFromName}},
+		{"Temperature", testValues(60, 90, 30), Classification{"temperature", "°F", QuantityFromName}},
+		{"Temperature", testValues(0, 4095, 30), Classification{"temperature", "", QuantityFromName}}, // Raw readings
+		{"Pressure", testValues(99, 102, 30), Classification{"pressure", "kPa", QuantityFromName}},
+		{"Battery", testValues(3600, 4100, 30), Classification{"battery_voltage", "mV", QuantityFromName}},
+		{"Humidity", testValues(0, 1023, 30), Classification{"relative_humidity", "", QuantityFromName}},
+
+		// The unit of the name comes first
+		{"Temp (°C)", testValues(60, 90, 30), Classification{"temperature", "°C", QuantityFromName}},
+
+		// The quantity from the values
+		{"Field 1", testValues(990, 1020, 30), Classification{"pressure", "hPa", QuantityFromValues}},
+		{"Field 1", testValues(99000, 102000, 30), Classification{"pressure", "Pa", QuantityFromValues}},
+		{"Field 1", testValues(3.6, 4.1, 30), Classification{"battery_voltage", "V", QuantityFromValues}},
+		{"Field 1", testValues(-3, 20, 30), Classification{"temperature", "°C", QuantityFromValues}},
+		{"Field 1", testValues(40, 90, 30), Classification{"relative_humidity", "%", QuantityFromValues}},
+		{"Field 1", testValues(500, 600, 30), Classification{}},
+		{"Field 1", testValues(20, 25, 30), Classification{}}, // Could be anything
+	}
+
+	for _, test := range tests {
+		if got := ClassifySensor(test.name, test.values); got != test.want {
+			t.Errorf("ClassifySensor(%q, %v values) = %+v, want %+v", test.name, len(test.values), got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestUnitFromValues(t *testing.T) {
+
+	tests := []struct {
+		quantity       string
+		low, mid, high float64
+		want           string
+	}{
+		{"temperature", -5, 15, 30, "°C"},
+		{"temperature", 50, 70, 90, "°F"},
+		{"temperature", -20, 60, 95, "°F"}, // The middle is too hot for °C
+		{"temperature", 300, 500, 1000, ""},
+		{"dew_point", -10, 5, 15, "°C"},
+
+		{"pressure", 990, 1010, 1020, "hPa"},
+		{"pressure", 99, 101, 102, "kPa"},
+		{"pressure", 99000, 101000, 102000, "Pa"},
+		{"pressure", 29.5, 29.9, 30.2, "inHg"},
+		{"pressure", 5, 6, 7, ""},
+
+		{"battery_voltage", 3600, 3900, 4100, "mV"},
+		{"battery_voltage", 3.6, 3.9, 4.1, "V"},
+		{"battery_voltage", 100, 200, 300, ""},
+
+		{"relative_humidity", 30, 50, 90, "%"},
+		{"relative_humidity", 0, 500, 1023, ""},
+		{"weight", 0, 1000000, 2000000, "kg"}, // No range
+	}
+
+	for _, test := range tests {
+		q, ok := quantitiesByName[test.quantity]
+		if !ok {
+			t.Fatalf("unknown quantity %q", test.quantity)
+		}
+		if got := unitFromValues(q, test.low, test.mid, test.high); got != test.want {
+			t.Errorf("unitFromValues(%v, %v, %v, %v) = %q, want %q", test.quantity, test.low, test.mid, test.high, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
@@ -1,56 +1,108 @@
 package datacollection
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
-	"net/http"
-	"runtime"
 	"sensor-data-simulator/database"
 	"sensor-data-simulator/global"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 /*--------------------------------*/
 
+// collectorWG keeps track of the background routines of the collector, so the shutdown can wait for them
+var collectorWG sync.WaitGroup
+
 // This has to be initiated manually (e.g. in main)
-func Init() {
+// The collector runs until the given context is cancelled, use Wait() to wait for it to stop
+func Init(ctx context.Context) {
+
+	InitBackfill(ctx)
+
+	closeInterruptedRuns()
+
+	discoverSchedule := loadSchedule(StageDiscover, global.ENV.COLLECTION_DISCOVER_CRON)
+	refreshSchedule := loadSchedule(StageRefresh, global.ENV.COLLECTION_REFRESH_CRON)
+
+	collectorWG.Add(1)
+	go func() {
+		defer collectorWG.Done()
+		pollRequests(ctx)
+	}()
 
+	collectorWG.Add(1)
 	go func() {
+		defer collectorWG.Done()
+
+		now := time.Now()
+		nextDiscover := firstRun(discoverSchedule, now)
+		nextRefresh := firstRun(refreshSchedule, now)
+
 		for {
 
 			/*---------*/
 
-			ExtractChannelsData()
+			setNextRunTimes(nextDiscover, nextRefresh)
 
-			time.Sleep(1 * time.Second)
-			ExtractSensorsData()
+			nextRun := nextDiscover
+			if nextRefresh.Before(nextRun) {
+				nextRun = nextRefresh
+			}
+			log.Printf("[COLL ] The next run will be at: `%v`", nextRun.Format(time.RFC1123))
+
+			trigger := TriggerSchedule
+			timer := time.NewTimer(time.Until(nextRun))
+
+			select {
+			case <-timer.C:
+			case trigger = <-runRequests:
+				timer.Stop()
+			case <-ctx.Done():
+				timer.Stop()
+				log.Printf("[COLL ] Data collection stopped.")
+				return
+			}
 
 			/*---------*/
 
-			global.DataCollectorProgress.LastExtractionTime = time.Now()
+			// From here on the requests are refused until the run is over. A request that came along
+			// with the schedule is not left waiting for a second run, this run becomes an on-demand one
+			runControl.Lock()
+			runControl.running = true
+			select {
+			case trigger = <-runRequests:
+			default:
+			}
+			runControl.Unlock()
 
-			/*---------*/
+			// The on-demand runs do everything, the scheduled ones only the stages that are due
+			now := time.Now()
+			discover := trigger != TriggerSchedule || !now.Before(nextDiscover)
+			refresh := trigger != TriggerSchedule || !now.Before(nextRefresh)
 
-			dataExtractionInterval := 60
+			runCollection(ctx, trigger, discover, refresh)
 
-			if val := global.ENV.DATA_EXTRACTION_INTERVAL; val != "" {
-				dataExtractionInterval, _ = strconv.Atoi(val)
-				if dataExtractionInterval <= 0 {
-					dataExtractionInterval = 60
-				}
+			if ctx.Err() != nil {
+				log.Printf("[COLL ] Data collection stopped.")
+				return
 			}
 
-			time.Sleep(3 * time.Second)
-
-			nextRunTime := time.Now().Add(time.Duration(dataExtractionInterval) * time.Minute).Format(time.RFC1123)
-			fmt.Printf("\nThe next run will be at: `%v`", nextRunTime)
-			time.Sleep(time.Duration(dataExtractionInterval) * time.Minute)
+			// The next times are computed from the end of the run, so the runs never overlap
+			now = time.Now()
+			if discover {
+				nextDiscover = discoverSchedule.Next(now)
+			}
+			if refresh {
+				nextRefresh = refreshSchedule.Next(now)
+			}
 
 			/*---------*/
 		}
@@ -59,335 +111,503 @@ func Init() {
 
 /*--------------------------------*/
 
-// this global var is used in go routines to inform the main func (ExtractChannelsData)
-// that the routines hit the last page of the channel data extraction
-// and it is time to break the main loop
-var channelsHitTheLastPage bool
+// Run runs the collector until the given context is cancelled, e.g. while this instance leads the collection
+func Run(ctx context.Context) {
 
-func ExtractChannelsData() {
+	Init(ctx)
+	<-ctx.Done()
+	Wait()
 
-	fmt.Print("\n\t\t* * * Extracting new channels * * *\n\n")
+	// A standby has nothing scheduled
+	setNextRunTimes(time.Time{}, time.Time{})
+}
 
-	global.DataCollectorProgress.NewExtractedChannels = 0
-	global.DataCollectorProgress.ChannelsRunning = true
-	defer func() { global.DataCollectorProgress.ChannelsRunning = false }()
+/*--------------------------------*/
 
-	channelsHitTheLastPage = false
-	var wg sync.WaitGroup
-	for page := 1; ; page++ {
+// runCollection runs the given stages one after the other and keeps it in the history
+func runCollection(ctx context.Context, trigger string, discover bool, refresh bool) {
 
-		if channelsHitTheLastPage {
-			break
-		}
+	// Each run has its own context, so it can be cancelled without stopping the collector
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
 
-		// processChannelDataExtraction(page) // Execution Time: 50.27s
+	runControl.Lock()
+	runControl.cancel = cancelRun
+	runControl.Unlock()
 
-		wg.Add(1)
-		go processChannelDataExtraction(page, &wg) // Execution Time: 04.21s
+	var stages []string
+	if discover {
+		stages = append(stages, StageDiscover)
+	}
+	if refresh {
+		stages = append(stages, StageRefresh)
+	}
+	run := startRun(trigger, stages)
 
-		// Let's wait for a timeout and when it is over, break and forget about it at all,
-		// because sometimes it keeps waiting for ever.
-		timeout := time.Now().Unix() + 5*60 // 5 minutes
+	if discover {
+		stageStart := time.Now()
+		ExtractChannelsData(runCtx)
+		run.ChannelsDuration = time.Since(stageStart)
+	}
 
-		// Let's wait for the routins to finish
-		for runtime.NumGoroutine() > global.MaxNumGoRoutines {
-			time.Sleep(200 * time.Millisecond)
-			if time.Now().Unix() > timeout {
-				fmt.Printf("\nTimeout reached! Breaking the thing")
-				return
-			}
-		}
+	if discover && refresh {
+		time.Sleep(1 * time.Second)
+	}
+
+	if refresh {
+		stageStart := time.Now()
+		ExtractSensorsData(runCtx)
+		ClassifySensors(runCtx)
+		run.SensorsDuration = time.Since(stageStart)
+
+		stageStart = time.Now()
+		CheckQuality(runCtx)
+		run.QualityDuration = time.Since(stageStart)
+	}
+
+	runControl.Lock()
+	runControl.cancel = nil
+	runControl.running = false
+	runControl.Unlock()
 
+	if runCtx.Err() != nil {
+		run.finish(RunCancelled)
+	} else {
+		run.finish(RunDone)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.LastExtractionTime = time.Now() })
 	}
-	wg.Wait()
+}
 
-	fmt.Printf("\n\nAll Done [ New channels: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.NewExtractedChannels)
+/*--------------------------------*/
+
+// Wait blocks until all the collector routines have stopped (i.e. after its context is cancelled)
+func Wait() {
+	collectorWG.Wait()
 }
 
 /*--------------------------------*/
 
-func ExtractSensorsData() {
+// What started a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+)
 
-	global.DataCollectorProgress.SensorsRunning = true
-	global.DataCollectorProgress.SensorsProgress = 0
-	global.DataCollectorProgress.NewExtractedSensorValues = 0
-	defer func() { global.DataCollectorProgress.SensorsRunning = false }()
+var ErrRunInProgress = errors.New("a data collection run is already in progress")
 
-	fmt.Print("\n\t\t* * * Extracting new sensor data * * *\n\n")
+// runRequests receives the on-demand runs, it keeps at most one waiting request
+var runRequests = make(chan string, 1)
 
-	channels, err := global.DB.Load("channels", nil)
-	if err != nil {
-		log.Fatal(err)
+var runControl struct {
+	sync.Mutex
+	running bool               // from the moment a run is picked until it is over
+	cancel  context.CancelFunc // cancels the current run, nil if there is no run
+}
+
+// RunNow starts a full run right away instead of waiting for the next scheduled one
+func RunNow(trigger string) error {
+
+	// The check and the request go together, so a run that is starting cannot be requested again
+	runControl.Lock()
+	defer runControl.Unlock()
+
+	if runControl.running {
+		return ErrRunInProgress
 	}
 
-	totalChannels := float64(len(channels))
-	var wg sync.WaitGroup
-	for chIndex, channel := range channels {
+	select {
+	case runRequests <- trigger:
+		return nil
+	default:
+		return ErrRunInProgress // Already requested
+	}
+}
 
-		progress := int(math.Round(100 * (float64(chIndex) + 1) / totalChannels))
+// CancelRun stops the current run, it returns false if there is no run in progress
+func CancelRun() bool {
 
-		// processChannelSensors(channel) // Execution Time: 9m23.08s
+	runControl.Lock()
+	defer runControl.Unlock()
 
-		wg.Add(1)
-		go processChannelSensors(channel, &wg) // Execution Time: 57.08s
+	if runControl.cancel == nil {
+		return false
+	}
 
-		// Let's wait for a timeout and when it is over, break and forget about it at all,
-		// because sometimes it keeps waiting for ever.
-		timeout := time.Now().Unix() + 10*60 // 10 minutes
+	runControl.cancel()
+	return true
+}
 
-		// Let's wait for the routins to finish
-		for runtime.NumGoroutine() > global.MaxNumGoRoutines {
-			global.DataCollectorProgress.SensorsProgress = progress
-			time.Sleep(1 * time.Second)
-			if time.Now().Unix() > timeout {
-				fmt.Printf("\nTimeout reached! Breaking the thing")
-				return
-			}
-		}
+/*--------------------------------*/
+
+// RefreshChannel fetches the feed of one channel right away, it returns the number of new values
+func RefreshChannel(ctx context.Context, channelId int64) (int64, error) {
+
+	channels, err := global.DB.Load("channels", database.RowType{"id": channelId})
+	if err != nil {
+		return 0, err
 	}
-	wg.Wait()
 
-	global.DataCollectorProgress.SensorsProgress = 100
+	if len(channels) == 0 {
+		return 0, fmt.Errorf("channel not found")
+	}
 
-	fmt.Printf("\n\nAll Done [ New sensor values: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.NewExtractedSensorValues)
+	return processChannelSensors(ctx, channels[0])
 }
 
 /*--------------------------------*/
 
-func processChannelSensors(channel database.RowType, wg *sync.WaitGroup) {
+// this flag is used in the workers to inform the main func (ExtractChannelsData)
+// that they hit the last page of the channel data extraction
+// and it is time to break the main loop
+var channelsHitTheLastPage int32
+
+// The pages that failed in a row, e.g. while the source is down. The discovery
+// gives up after maxFailedPages of them instead of asking for the next pages forever
+var channelsFailedPages int32
+
+const maxFailedPages = 3
 
-	defer wg.Done()
+func ExtractChannelsData(ctx context.Context) {
 
-	apiURL := "https://thingspeak.com/channels/%v/feed.json"
+	fmt.Print("\n\t\t* * * Extracting new channels * * *\n\n")
 
-	fmt.Printf("\r\t[ %3v %% ]\tProcessing Channel: %-20v", global.DataCollectorProgress.SensorsProgress, channel["id"])
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.ChannelsRunning = true })
+	defer global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.ChannelsRunning = false })
 
-	req, err := http.NewRequest("GET", fmt.Sprintf(apiURL, channel["id"]), nil)
+	rules, err := LoadCollectionRules()
 	if err != nil {
-		log.Printf("Error in sensor data extraction: %v", err)
+		log.Printf("\nError in loading the collection rules: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	for _, src := range EnabledSources() {
+
+		fmt.Printf("\nSource: %v\n", src.Name())
+
+		atomic.StoreInt32(&channelsHitTheLastPage, 0)
+		atomic.StoreInt32(&channelsFailedPages, 0)
+		pool := newWorkerPool(ctx, workersCount())
+		for page := 1; atomic.LoadInt32(&channelsHitTheLastPage) == 0; page++ {
+
+			src, page := src, page
+			if !pool.Submit(func(ctx context.Context) { processChannelDataExtraction(ctx, src, page, rules) }) {
+				break // Cancelled
+			}
+		}
+		pool.Wait()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	fmt.Printf("\n\nAll Done [ New channels: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.Status().NewExtractedChannels)
+}
+
+/*--------------------------------*/
+
+func ExtractSensorsData(ctx context.Context) {
+
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+		s.SensorsRunning = true
+		s.SensorsProgress = 0
+	})
+	defer global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.SensorsRunning = false })
 
-	resp, err := http.DefaultClient.Do(req)
+	fmt.Print("\n\t\t* * * Extracting new sensor data * * *\n\n")
+
+	// The gone channels are skipped, and so are the failing ones until their backoff is over
+	SQL := `SELECT * FROM "channels"
+			WHERE
+				"state" <> $1 AND
+				("next_fetch_at" IS NULL OR "next_fetch_at" <= $2)`
+	channels, err := global.DB.Query(SQL, database.QueryParams{ChannelGone, time.Now().UTC()})
 	if err != nil {
-		log.Printf("\nError in sensor data extraction: %v", err)
+		log.Printf("\nError in loading the channels: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
 		return
 	}
-	defer resp.Body.Close()
 
-	content, err := ioutil.ReadAll(resp.Body)
+	rules, err := LoadCollectionRules()
 	if err != nil {
-		log.Printf("\nCould not read the content: %v", err)
-	}
-
-	var sensorFeedJSON struct {
-		Channel struct {
-			Id          json.Number `json:"id"`
-			LastEntryId json.Number `json:"last_entry_id"`
-			Field1      string      `json:"field1"`
-			Field2      string      `json:"field2"`
-			Field3      string      `json:"field3"`
-			Field4      string      `json:"field4"`
-			Field5      string      `json:"field5"`
-			Field6      string      `json:"field6"`
-			Field7      string      `json:"field7"`
-			Field8      string      `json:"field8"`
-		} `json:"channel"`
-		Feeds []struct {
-			EntryId   json.Number `json:"entry_id"`
-			CreatedAt time.Time   `json:"created_at"`
-			Field1    string      `json:"field1"`
-			Field2    string      `json:"field2"`
-			Field3    string      `json:"field3"`
-			Field4    string      `json:"field4"`
-			Field5    string      `json:"field5"`
-			Field6    string      `json:"field6"`
-			Field7    string      `json:"field7"`
-			Field8    string      `json:"field8"`
-		} `json:"feeds"`
-	}
-
-	if err := json.Unmarshal(content, &sensorFeedJSON); err != nil {
-		// log.Printf("\nChannel: %v, Err: %v", channel["id"], err)
+		log.Printf("\nError in loading the collection rules: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
 		return
 	}
 
-	if sensorFeedJSON.Channel.LastEntryId.String() == channel["last_entry_id"] {
-		// fmt.Printf("Already updated")
+	channelTags, err := loadChannelTags()
+	if err != nil {
+		log.Printf("\nError in loading the channel tags: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
 		return
 	}
 
-	ch := &sensorFeedJSON.Channel
-	fieldNames := []string{ch.Field1, ch.Field2, ch.Field3, ch.Field4, ch.Field5, ch.Field6, ch.Field7, ch.Field8}
+	// The channels of the disabled sources are kept as they are, e.g. the seed data
+	enabledSources := make(map[string]bool)
+	for _, src := range EnabledSources() {
+		enabledSources[src.Name()] = true
+	}
 
-	dataPointsCounts := int64(0)
-	extractedSensorsCount := int64(0)
-	for _, rec := range sensorFeedJSON.Feeds {
+	totalChannels := float64(len(channels))
+	pool := newWorkerPool(ctx, workersCount())
+	for chIndex, channel := range channels {
 
-		// ideally a combination of fields (e.g. name, channel_id, ...) is required, but since the entry_id is unique in thingspeak, it is sufficient
-		rows, _ := global.DB.Load("sensor_values", database.RowType{"entry_id": rec.EntryId})
-		if rows != nil && len(rows) > 0 {
-			// log.Printf("Already exist rec.EntryId: %v\n", rec.EntryId)
-			continue
+		// The private channels are registered on purpose, the rules are for what is discovered
+		channel := channel
+		srcName, _ := channel["source"].(string)
+		if enabledSources[srcName] && (channel["owner_id"] != nil || rules.Match(channelFromRow(channel, channelTags))) {
+			if !pool.Submit(func(ctx context.Context) { processChannelSensors(ctx, channel) }) {
+				break // Cancelled
+			}
 		}
 
-		fieldValues := []string{rec.Field1, rec.Field2, rec.Field3, rec.Field4, rec.Field5, rec.Field6, rec.Field7, rec.Field8}
-		for i := 0; i != 8; i++ {
+		progress := int(math.Round(100 * (float64(chIndex) + 1) / totalChannels))
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.SensorsProgress = progress })
+	}
+	pool.Wait()
 
-			if fieldNames[i] == "" {
-				continue
-			}
+	if ctx.Err() != nil {
+		return
+	}
 
-			// Process the sensor details:
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.SensorsProgress = 100 })
 
-			sensorId := int64(0)
-			sensorRow := database.RowType{
-				"channel_id": sensorFeedJSON.Channel.Id,
-				"name":       fieldNames[i],
-			}
+	fmt.Printf("\n\nAll Done [ New sensor values: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.Status().NewExtractedSensorValues)
+}
 
-			rows, _ := global.DB.Load("sensors", sensorRow)
-			if rows != nil && len(rows) > 0 {
-				sensorId = rows[0]["id"].(int64)
-			} else {
+/*--------------------------------*/
 
-				insRes, err := global.DB.Insert("sensors", sensorRow)
-				if err != nil {
-					if !strings.Contains(err.Error(), "duplicate key") {
-						log.Printf("\nError in sensor insertion: %v \nRow: \n%v", err, sensorRow)
-					}
-				}
-				sensorId = insRes.LastInsertId
-				extractedSensorsCount += insRes.RowsAffected
-			}
+// processChannelSensors fetches the new entries of a channel and stores them,
+// it returns the number of new values
+func processChannelSensors(ctx context.Context, channel database.RowType) (int64, error) {
 
-			if sensorId == 0 {
-				log.Printf("\nError: sensor id (LastInsertId) is zero! \nRow: \n%v", sensorRow)
-				continue
-			}
+	fmt.Printf("\r\t[ %3v %% ]\tProcessing Channel: %-20v", global.DataCollectorProgress.Status().SensorsProgress, channel["id"])
 
-			/*------------*/
+	srcName, _ := channel["source"].(string)
+	src, ok := GetSource(srcName)
+	if !ok {
+		return 0, fmt.Errorf("the source of this channel (`%v`) is not enabled", srcName)
+	}
 
-			// Clean the garbage from the value
-			value := strings.Trim(fieldValues[i], " \n\t\r")
+	lastEntryId, _ := channel["last_entry_id"].(int64)
 
-			row := database.RowType{
-				"entry_id":   rec.EntryId,
-				"created_at": rec.CreatedAt,
-				"value":      value,
-				"sensor_id":  sensorId,
-			}
-			insRes, err := global.DB.Insert("sensor_values", row)
-			if err != nil {
-				// Let's ignore duplicate key as some user's have used same sensor name twice or more
-				if !strings.Contains(err.Error(), "duplicate key") {
-					log.Printf("\nError in sensor_value insertion: %v", err)
-				}
-			}
+	apiKey, err := channelApiKey(channel)
+	if err != nil {
+		return 0, err
+	}
 
-			dataPointsCounts += insRes.RowsAffected
-		}
+	feed, err := src.FetchFeed(ctx, fmt.Sprint(channel["id"]), FeedOptions{AfterEntryId: lastEntryId, ApiKey: apiKey})
+	if ctx.Err() != nil {
+		return 0, ctx.Err() // Cancelled, it says nothing about the health of the channel
+	}
+	recordChannelFetch(channel, feed, err)
+	if err != nil {
+		// log.Printf("\nChannel: %v, Err: %v", channel["id"], err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+		return 0, err
 	}
 
-	if dataPointsCounts > 0 {
-		_, err := global.DB.Update("channels", database.RowType{"last_entry_id": sensorFeedJSON.Channel.LastEntryId}, database.RowType{"id": sensorFeedJSON.Channel.Id})
-		if err != nil {
-			log.Printf("\nError in data update: %v", err)
-		}
+	if feed.LastEntryId == lastEntryId {
+		// fmt.Printf("Already updated")
+		return 0, nil
+	}
+
+	dataPointsCounts, extractedSensorsCount, err := storeFeedEntries(channel["id"], feed)
+
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+		s.NewExtractedSensorValues += dataPointsCounts
+		s.NewExtractedSensors += extractedSensorsCount
+	})
+
+	if err != nil {
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+		return dataPointsCounts, err
+	}
 
-		global.DataCollectorProgress.NewExtractedSensorValues += dataPointsCounts
+	// Everything is stored (or was already there), the cursor can move on
+	fields := database.RowType{"last_entry_id": feed.LastEntryId}
+	if metadata, _ := channel["metadata"].(string); feed.Metadata != "" && feed.Metadata != metadata {
+		fields["metadata"] = feed.Metadata
 	}
 
-	if extractedSensorsCount > 0 {
-		global.DataCollectorProgress.NewExtractedSensors += extractedSensorsCount
+	_, err = global.DB.Update("channels", fields, database.RowType{"id": channel["id"]})
+	if err != nil {
+		log.Printf("\nError in data update: %v", err)
 	}
 
+	return dataPointsCounts, nil
 }
 
 /*--------------------------------*/
 
-func processChannelDataExtraction(page int, wg *sync.WaitGroup) {
-
-	defer wg.Done()
+func processChannelDataExtraction(ctx context.Context, src Source, page int, rules *CollectionRules) {
 
 	fmt.Printf("\rPage %-5d Started...", page)
-	apiURL := "https://api.thingspeak.com/channels/public.json?page="
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s%d", apiURL, page), nil)
+	channels, err := src.ListChannels(ctx, page)
 	if err != nil {
-		log.Printf("\nError in channel extraction: %v", err)
-		return
-	}
+		log.Printf("\nError in channel extraction [%v] Page: %v, Err: %v", src.Name(), page, err)
+		if ctx.Err() != nil {
+			return
+		}
 
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+			s.Errors++
+			s.LastError = fmt.Sprintf("channel discovery [%v] page %v: %v", src.Name(), page, err)
+		})
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("\nError in channel extraction: %v", err)
+		if atomic.AddInt32(&channelsFailedPages, 1) >= maxFailedPages {
+			log.Printf("\nThe channel discovery of `%v` stopped after %v failed pages", src.Name(), maxFailedPages)
+			atomic.StoreInt32(&channelsHitTheLastPage, 1)
+		}
 		return
 	}
-	defer resp.Body.Close()
+	atomic.StoreInt32(&channelsFailedPages, 0)
 
-	content, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("\nCould not read the content: %v", err)
+	if len(channels) == 0 {
+		// fmt.Printf("\nAll Done [Page: %d ] \n\n", page)
+		atomic.StoreInt32(&channelsHitTheLastPage, 1)
 		return
 	}
 
-	var channelsJSON struct {
-		Channels []struct {
-			Id json.Number `json:"id"`
-			// LastEntryId json.Number `json:"last_entry_id"`
-			Name        string    `json:"name"`
-			Description string    `json:"description"`
-			Latitude    string    `json:"latitude"`
-			Longitude   string    `json:"longitude"`
-			CreatedAt   time.Time `json:"created_at"`
-			URL         string    `json:"url"`
-		} `json:"channels"`
+	for _, rec := range channels {
+
+		if !rules.Match(rec) {
+			continue
+		}
+
+		fields := channelMetadataRow(rec)
+
+		rows, _ := global.DB.Load("channels", database.RowType{"id": rec.Id})
+		if rows != nil && len(rows) > 0 {
+			// Already exist, only its metadata is refreshed
+			_, err := global.DB.Update("channels", fields, database.RowType{"id": rec.Id})
+			if err != nil {
+				log.Printf("\nError in data update: %v", err)
+			}
+			reviveChannel(rec.Id)
+
+			// The channel is public now, its owner cannot keep it for themselves
+			if rows[0]["owner_id"] != nil {
+				makeChannelPublic(rec.Id)
+			}
+
+		} else {
+
+			fields["id"] = rec.Id
+			fields["source"] = src.Name()
+			fields["last_entry_id"] = "0" // We keep this Zero for the first time, later it will be updated through sensor data extraction
+			fields["created_at"] = rec.CreatedAt
+
+			insRes, err := global.DB.Insert("channels", fields)
+			if err != nil {
+				log.Printf("\nError in data insertion: %v", err)
+				continue
+			}
+			global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.NewExtractedChannels += insRes.RowsAffected })
+
+			if insRes.RowsAffected > 0 && global.ENV.BACKFILL_ON_DISCOVERY == "true" {
+				if channelId, err := strconv.ParseInt(rec.Id, 10, 64); err == nil {
+					QueueBackfill(channelId, time.Time{})
+				}
+			}
+		}
+
+		if err := storeChannelTags(rec.Id, rec.Tags); err != nil {
+			log.Printf("\nError in `channel_tags` update: %v", err)
+		}
 	}
-	if err := json.Unmarshal(content, &channelsJSON); err != nil {
+	fmt.Printf("\rPage %-5d done", page)
 
-		log.Printf("Page: %v, Err: %v", page, err)
-		return
+}
+
+/*--------------------------------*/
+
+// storeFeedEntries stores the sensors and the values of the given feed entries for a channel,
+// the values that are already stored are skipped.
+// It returns the number of new values and new sensors
+func storeFeedEntries(channelId interface{}, feed Feed) (int64, int64, error) {
+
+	// The trackers may have a location without any field, so this goes first
+	if err := storeEntryLocations(channelId, feed.Entries); err != nil {
+		log.Printf("\nError in channel_entries insertion: %v", err)
+		return 0, 0, err
 	}
 
-	if len(channelsJSON.Channels) == 0 {
-		// fmt.Printf("\nAll Done [Page: %d ] \n\n", page)
-		channelsHitTheLastPage = true
-		return
+	var names []string
+	for _, fieldName := range feed.Fields {
+		if fieldName != "" {
+			names = append(names, fieldName)
+		}
 	}
 
-	for _, rec := range channelsJSON.Channels {
+	if len(names) == 0 || len(feed.Entries) == 0 {
+		return 0, 0, nil
+	}
 
-		fields := database.RowType{
-			"id":            rec.Id.String(),
-			"last_entry_id": "0", // We keep this Zero for the first time, later it will be updated through sensor data extraction
-			"name":          rec.Name,
-			"description":   rec.Description,
-			"latitude":      rec.Latitude,
-			"longitude":     rec.Longitude,
-			"url":           rec.URL,
-			"created_at":    rec.CreatedAt,
-		}
+	sensorIdsByName, extractedSensorsCount, err := sensorIds.Get(channelId, names)
+	if err != nil {
+		log.Printf("\nError in sensor insertion: %v \nChannel: %v", err, channelId)
+		return 0, extractedSensorsCount, err
+	}
 
-		rows, _ := global.DB.Load("channels", database.RowType{"id": fields["id"]})
-		if rows != nil && len(rows) > 0 {
-			// log.Printf("Already exist\n")
-			continue
-		}
+	/*------------*/
+
+	var rows []database.QueryParams
+	valueTypes := make(map[int64]valueTypeCounter)
+	for _, rec := range feed.Entries {
+
+		// Some users have used the same sensor name twice or more, the first field wins
+		seen := make(map[int64]bool)
+
+		for i, fieldName := range feed.Fields {
+
+			if fieldName == "" || i >= len(rec.Values) {
+				continue
+			}
+
+			sensorId := sensorIdsByName[fieldName]
+			if seen[sensorId] {
+				continue
+			}
+			seen[sensorId] = true
+
+			value := cleanValue(rec.Values[i])
+			valueNum, valueType := parseValue(value)
+			if valueTypes[sensorId] == nil {
+				valueTypes[sensorId] = make(valueTypeCounter)
+			}
+			valueTypes[sensorId][valueType]++
 
-		insRes, err := global.DB.Insert("channels", fields)
-		if err != nil {
-			log.Printf("\nError in data insertion: %v", err)
+			rows = append(rows, database.QueryParams{rec.EntryId, rec.CreatedAt, value, valueNum, sensorId})
 		}
-		global.DataCollectorProgress.NewExtractedChannels += insRes.RowsAffected
+	}
 
+	insRes, err := global.DB.BulkInsert("sensor_values", []string{"entry_id", "created_at", "value", "value_num", "sensor_id"}, rows, true)
+	if err != nil {
+		log.Printf("\nError in sensor_value insertion: %v", err)
+	} else {
+		setSensorValueTypes(valueTypes)
 	}
-	fmt.Printf("\rPage %-5d done", page)
 
+	return insRes.RowsAffected, extractedSensorsCount, err
+}
+
+/*--------------------------------*/
+
+// maxValueLength is the size of the `sensor_values.value` column
+const maxValueLength = 100
+
+// cleanValue removes the garbage from a value and makes it fit in the database
+func cleanValue(value string) string {
+
+	value = strings.Trim(value, " \n\t\r")
+
+	if utf8.RuneCountInString(value) > maxValueLength {
+		value = string([]rune(value)[:maxValueLength])
+	}
+	return value
 }
 
 /*--------------------------------*/
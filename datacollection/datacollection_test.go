@@ -0,0 +1,35 @@
+package datacollection
+
+import "testing"
+
+/*--------------------------------*/
+
+func TestRunNow(t *testing.T) {
+
+	defer func() {
+		runControl.running = false
+		select {
+		case <-runRequests:
+		default:
+		}
+	}()
+
+	// A run is picked, e.g. by the schedule, but not started yet
+	runControl.running = true
+	if err := RunNow(TriggerAPI); err != ErrRunInProgress {
+		t.Errorf("RunNow while a run starts: error = %v, want %v", err, ErrRunInProgress)
+	}
+	if len(runRequests) != 0 {
+		t.Errorf("RunNow while a run starts: %v requests waiting, want 0", len(runRequests))
+	}
+
+	runControl.running = false
+	if err := RunNow(TriggerAPI); err != nil {
+		t.Errorf("RunNow: %v", err)
+	}
+	if err := RunNow(TriggerAPI); err != ErrRunInProgress {
+		t.Errorf("RunNow with a waiting request: error = %v, want %v", err, ErrRunInProgress)
+	}
+}
+
+/*--------------------------------*/
@@ -0,0 +1,140 @@
+package datacollection
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The health states of a channel
+const (
+	ChannelActive = "active" // fetched successfully and still reporting
+	ChannelStale  = "stale"  // failing to be fetched, or no new entries for a while
+	ChannelGone   = "gone"   // deleted or turned private on its source, not fetched any more
+)
+
+const (
+	// A channel is gone after this many consecutive responses saying it does not exist or is not public
+	goneAfterFailures = 3
+
+	// A channel without new entries for this long is stale
+	staleAfter = 30 * 24 * time.Hour
+
+	// The waiting time before fetching a failing channel again, doubled on each failure
+	minFetchBackoff = 15 * time.Minute
+	maxFetchBackoff = 24 * time.Hour
+)
+
+/*--------------------------------*/
+
+// recordChannelFetch updates the health of a channel after fetching its feed
+func recordChannelFetch(channel database.RowType, feed Feed, fetchErr error) {
+
+	now := time.Now().UTC()
+	fields := database.RowType{"last_fetch_at": now}
+
+	if fetchErr == nil {
+
+		lastEntryAt, _ := channel["last_entry_at"].(time.Time)
+		for _, entry := range feed.Entries {
+			if entry.CreatedAt.After(lastEntryAt) {
+				lastEntryAt = entry.CreatedAt
+			}
+		}
+
+		state := ChannelActive
+		if lastEntryAt.IsZero() || now.Sub(lastEntryAt) > staleAfter {
+			state = ChannelStale
+		}
+
+		fields["state"] = state
+		fields["last_success_at"] = now
+		fields["last_http_status"] = http.StatusOK
+		fields["consecutive_failures"] = 0
+		fields["next_fetch_at"] = nil
+		if !lastEntryAt.IsZero() {
+			fields["last_entry_at"] = lastEntryAt.UTC()
+		}
+
+	} else {
+
+		failures, _ := channel["consecutive_failures"].(int64)
+		failures++
+
+		var statusErr StatusError
+		if errors.As(fetchErr, &statusErr) {
+			fields["last_http_status"] = statusErr.StatusCode
+		} else {
+			fields["last_http_status"] = nil // e.g. network errors or unexpected content
+		}
+
+		state := ChannelStale
+		if isChannelNotFound(fetchErr) && failures >= goneAfterFailures {
+			state = ChannelGone
+		}
+
+		fields["state"] = state
+		fields["consecutive_failures"] = failures
+		fields["next_fetch_at"] = now.Add(fetchBackoff(failures))
+	}
+
+	_, err := global.DB.Update("channels", fields, database.RowType{"id": channel["id"]})
+	if err != nil {
+		log.Printf("\nError in channel health update: %v", err)
+	}
+}
+
+/*--------------------------------*/
+
+// isChannelNotFound tells if the source says the channel does not exist or is not public
+func isChannelNotFound(err error) bool {
+
+	if errors.Is(err, ErrChannelNotFound) {
+		return true
+	}
+
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+			return true
+		}
+	}
+
+	return false
+}
+
+/*--------------------------------*/
+
+func fetchBackoff(failures int64) time.Duration {
+
+	delay := minFetchBackoff
+	for i := int64(1); i < failures && delay < maxFetchBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxFetchBackoff {
+		delay = maxFetchBackoff
+	}
+	return delay
+}
+
+/*--------------------------------*/
+
+// reviveChannel brings a gone channel back when it shows up again in the public list of its source
+func reviveChannel(channelId string) {
+
+	SQL := `UPDATE "channels"
+			SET "state" = $1, "consecutive_failures" = 0, "next_fetch_at" = NULL
+			WHERE "id" = $2 AND "state" = $3`
+	_, err := global.DB.Exec(SQL, database.QueryParams{ChannelActive, channelId, ChannelGone})
+	if err != nil {
+		log.Printf("\nError in channel health update: %v", err)
+	}
+}
+
+/*--------------------------------*/
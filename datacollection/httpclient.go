@@ -0,0 +1,239 @@
+package datacollection
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sensor-data-simulator/global"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The default settings of the outbound HTTP calls, can be changed by the env variables
+const (
+	defaultRateLimit   = 10 // requests per second per host
+	defaultHTTPTimeout = 30 // seconds
+	defaultMaxRetries  = 4
+
+	minBackoff = 1 * time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+/*--------------------------------*/
+
+// StatusError is returned when the remote server responds with an unsuccessful status code
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected response (%d %s) from: %v", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
+/*--------------------------------*/
+
+// collectorHTTPClient is the shared outbound HTTP layer of the collector.
+// It applies a token-bucket rate limit per host, a timeout per request and
+// retries with exponential backoff (honouring `Retry-After`) on network errors, 429 and 5xx responses
+type collectorHTTPClient struct {
+	client     *http.Client
+	rateLimit  float64
+	maxRetries int
+	backoff    func(attempt int, retryAfter time.Duration) time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+var collectorHTTP = newCollectorHTTPClient()
+
+func newCollectorHTTPClient() *collectorHTTPClient {
+
+	rateLimit, _ := strconv.ParseFloat(global.ENV.COLLECTION_RATE_LIMIT, 64)
+	if rateLimit <= 0 {
+		rateLimit = defaultRateLimit
+	}
+
+	timeout, _ := strconv.Atoi(global.ENV.COLLECTION_HTTP_TIMEOUT)
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	maxRetries, err := strconv.Atoi(global.ENV.COLLECTION_MAX_RETRIES)
+	if err != nil || maxRetries < 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	return &collectorHTTPClient{
+		client:     &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		rateLimit:  rateLimit,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+/*--------------------------------*/
+
+// Do sends a request without body (e.g. GET) and returns the response only if it is successful (2xx),
+// the caller has to close the body of the response
+func (c *collectorHTTPClient) Do(req *http.Request) (*http.Response, error) {
+
+	ctx := req.Context()
+	bucket := c.bucket(req.URL.Host)
+
+	for attempt := 0; ; attempt++ {
+
+		if err := bucket.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req)
+
+		var retryAfter time.Duration
+		if err == nil {
+
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
+			}
+
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+
+			err = StatusError{StatusCode: resp.StatusCode, URL: req.URL.String()}
+			if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+				return nil, err // Retrying would not help
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // Cancelled, not a failure of the remote server
+		}
+
+		if attempt >= c.maxRetries {
+			global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.AbandonedRequests++ })
+			return nil, err
+		}
+
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.RetriedRequests++ })
+		if err := sleepContext(ctx, c.backoff(attempt, retryAfter)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func (c *collectorHTTPClient) bucket(host string) *tokenBucket {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.buckets[host]
+	if !ok {
+		capacity := math.Max(1, c.rateLimit)
+		b = &tokenBucket{rate: c.rateLimit, capacity: capacity, tokens: capacity, last: time.Now()}
+		c.buckets[host] = b
+	}
+	return b
+}
+
+/*--------------------------------*/
+
+// backoff returns the waiting time before the next attempt:
+// an exponential delay with full jitter, or what the server asked for in `Retry-After` if it is longer
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+
+	delay := minBackoff << uint(attempt)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+/*--------------------------------*/
+
+// parseRetryAfter reads the `Retry-After` header, which is either in seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+/*--------------------------------*/
+
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // tokens added per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// wait blocks until a token is available and takes it
+func (b *tokenBucket) wait(ctx context.Context) error {
+
+	for {
+		b.mu.Lock()
+
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+
+		needed := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, needed); err != nil {
+			return err
+		}
+	}
+}
+
+/*--------------------------------*/
+
+// sleepContext sleeps for the given duration, or less if the context is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*--------------------------------*/
@@ -0,0 +1,272 @@
+package datacollection
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*--------------------------------*/
+
+// testHTTPClient sends the requests to a test server that answers with the given status codes in order,
+// it records the waits asked to the backoff instead of sleeping
+type testHTTPClient struct {
+	*collectorHTTPClient
+	server *httptest.Server
+
+	mu          sync.Mutex
+	statuses    []int
+	retryAfter  string
+	attempts    int
+	retryAfters []time.Duration
+}
+
+func newTestHTTPClient(maxRetries int, retryAfter string, statuses ...int) *testHTTPClient {
+
+	c := &testHTTPClient{statuses: statuses, retryAfter: retryAfter}
+
+	c.server = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		c.mu.Lock()
+		status := c.statuses[len(c.statuses)-1]
+		if c.attempts < len(c.statuses) {
+			status = c.statuses[c.attempts]
+		}
+		c.attempts++
+		c.mu.Unlock()
+
+		if c.retryAfter != "" {
+			resp.Header().Set("Retry-After", c.retryAfter)
+		}
+		resp.WriteHeader(status)
+	}))
+
+	c.collectorHTTPClient = &collectorHTTPClient{
+		client:     c.server.Client(),
+		rateLimit:  1000,
+		maxRetries: maxRetries,
+		backoff: func(attempt int, retryAfter time.Duration) time.Duration {
+			c.retryAfters = append(c.retryAfters, retryAfter)
+			return 0
+		},
+		buckets: make(map[string]*tokenBucket),
+	}
+	return c
+}
+
+/*--------------------------------*/
+
+func TestCollectorHTTPDo(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantStatus   int // 0 if the request fails
+		wantError    int // The status code of the StatusError
+		wantAttempts int
+	}{
+		{"success", []int{200}, 4, 200, 0, 1},
+		{"server error then success", []int{503, 500, 200}, 4, 200, 0, 3},
+		{"rate limited then success", []int{429, 200}, 4, 200, 0, 2},
+		{"not found is not retried", []int{404}, 4, 0, 404, 1},
+		{"bad request is not retried", []int{400, 200}, 4, 0, 400, 1},
+		{"too many server errors", []int{502}, 2, 0, 502, 3},
+		{"no retries", []int{503, 200}, 0, 0, 503, 1},
+	}
+
+	for _, test := range tests {
+
+		c := newTestHTTPClient(test.maxRetries, "", test.statuses...)
+
+		req, _ := http.NewRequest("GET", c.server.URL, nil)
+		resp, err := c.Do(req)
+
+		if test.wantStatus != 0 {
+			if err != nil {
+				t.Errorf("%v: error = %v, want status %v", test.name, err, test.wantStatus)
+			} else if resp.StatusCode != test.wantStatus {
+				t.Errorf("%v: status = %v, want %v", test.name, resp.StatusCode, test.wantStatus)
+			}
+		} else if statusErr, ok := err.(StatusError); !ok || statusErr.StatusCode != test.wantError {
+			t.Errorf("%v: error = %v, want a %v error", test.name, err, test.wantError)
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if c.attempts != test.wantAttempts {
+			t.Errorf("%v: attempts = %v, want %v", test.name, c.attempts, test.wantAttempts)
+		}
+		if len(c.retryAfters) != test.wantAttempts-1 {
+			t.Errorf("%v: %v waits, want %v", test.name, len(c.retryAfters), test.wantAttempts-1)
+		}
+
+		c.server.Close()
+	}
+}
+
+/*--------------------------------*/
+
+func TestCollectorHTTPRetryAfter(t *testing.T) {
+
+	c := newTestHTTPClient(4, "7", 429, 503, 200)
+	defer c.server.Close()
+
+	req, _ := http.NewRequest("GET", c.server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+
+	want := []time.Duration{7 * time.Second, 7 * time.Second}
+	if !reflect.DeepEqual(c.retryAfters, want) {
+		t.Errorf("Retry-After given to the backoff = %v, want %v", c.retryAfters, want)
+	}
+}
+
+/*--------------------------------*/
+
+func TestCollectorHTTPCancel(t *testing.T) {
+
+	c := newTestHTTPClient(4, "", 503)
+	defer c.server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.backoff = func(attempt int, retryAfter time.Duration) time.Duration {
+		cancel() // Cancelled while waiting for the next attempt
+		return time.Minute
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", c.server.URL, nil)
+	if _, err := c.Do(req); err != context.Canceled {
+		t.Errorf("Do cancelled during the backoff: error = %v, want %v", err, context.Canceled)
+	}
+	if c.attempts != 1 {
+		t.Errorf("Do cancelled during the backoff: attempts = %v, want 1", c.attempts)
+	}
+}
+
+/*--------------------------------*/
+
+func TestBackoff(t *testing.T) {
+
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{0, 0, minBackoff / 2, minBackoff},
+		{1, 0, minBackoff, 2 * minBackoff},
+		{3, 0, 4 * minBackoff, 8 * minBackoff},
+		{10, 0, maxBackoff / 2, maxBackoff},
+		{100, 0, maxBackoff / 2, maxBackoff}, // The shift overflows
+		{0, 30 * time.Second, 30 * time.Second, 30 * time.Second},
+		{3, 2 * time.Second, 4 * minBackoff, 8 * minBackoff}, // Shorter than the backoff
+	}
+
+	for _, test := range tests {
+		// The jitter is random, so each attempt is tried several times
+		for i := 0; i < 100; i++ {
+			if got := backoff(test.attempt, test.retryAfter); got < test.min || got > test.max {
+				t.Errorf("backoff(%v, %v) = %v, want between %v and %v", test.attempt, test.retryAfter, got, test.min, test.max)
+				break
+			}
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestParseRetryAfter(t *testing.T) {
+
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", test.value, got, test.min, test.max)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestTokenBucket(t *testing.T) {
+
+	// 20 tokens per second, 2 at most
+	b := &tokenBucket{rate: 20, capacity: 2, tokens: 2, last: time.Now()}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatalf("wait %v: %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("the tokens of the capacity took %v, want no wait", elapsed)
+	}
+
+	// The next tokens come at the rate
+	for i := 0; i < 2; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatalf("wait %v: %v", i+3, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 tokens took %v, want at least 100ms", elapsed)
+	}
+
+	// No token for a long time
+	slow := &tokenBucket{rate: 0.01, capacity: 1, tokens: 0, last: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := slow.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wait with an empty bucket: error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+/*--------------------------------*/
+
+func TestCollectorHTTPBucket(t *testing.T) {
+
+	tests := []struct {
+		rateLimit    float64
+		wantCapacity float64
+	}{
+		{10, 10},
+		{0.5, 1}, // At least one request at once
+	}
+
+	for _, test := range tests {
+
+		c := &collectorHTTPClient{rateLimit: test.rateLimit, buckets: make(map[string]*tokenBucket)}
+
+		b := c.bucket("api.thingspeak.com")
+		if b.capacity != test.wantCapacity || b.tokens != test.wantCapacity || b.rate != test.rateLimit {
+			t.Errorf("bucket with a rate of %v: capacity = %v, tokens = %v, rate = %v, want %v, %v, %v",
+				test.rateLimit, b.capacity, b.tokens, b.rate, test.wantCapacity, test.wantCapacity, test.rateLimit)
+		}
+		if c.bucket("api.thingspeak.com") != b {
+			t.Errorf("bucket with a rate of %v: the same host has another bucket", test.rateLimit)
+		}
+		if c.bucket("other.example.com") == b {
+			t.Errorf("bucket with a rate of %v: another host has the same bucket", test.rateLimit)
+		}
+	}
+}
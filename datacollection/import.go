@@ -0,0 +1,83 @@
+package datacollection
+
+import (
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"time"
+)
+
+/*--------------------------------*/
+
+// ImportChannel stores a channel with its feed that do not come from a source, e.g. the seed data or an uploaded file.
+// A new channel is private to the given owner (0 for a public channel), an existing one only gets its metadata refreshed and the new entries.
+// It returns the number of new values and new sensors
+func ImportChannel(rec Channel, sourceName string, ownerId int64, creatorId int64, feed Feed) (int64, int64, error) {
+
+	channels, err := global.DB.Load("channels", database.RowType{"id": rec.Id})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := channelMetadataRow(rec)
+	if feed.Metadata != "" {
+		fields["metadata"] = feed.Metadata
+	}
+
+	if len(channels) > 0 {
+
+		if _, err := global.DB.Update("channels", fields, database.RowType{"id": rec.Id}); err != nil {
+			return 0, 0, err
+		}
+
+	} else {
+
+		fields["id"] = rec.Id
+		fields["source"] = sourceName
+		fields["last_entry_id"] = "0"
+		fields["created_at"] = rec.CreatedAt
+		if rec.CreatedAt.IsZero() {
+			fields["created_at"] = time.Now().UTC()
+		}
+		if ownerId != 0 {
+			fields["owner_id"] = ownerId
+		}
+		if creatorId != 0 {
+			fields["created_by"] = creatorId
+		}
+
+		insRes, err := global.DB.Insert("channels", fields)
+		if err != nil {
+			return 0, 0, err
+		}
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.NewExtractedChannels += insRes.RowsAffected })
+	}
+
+	if err := storeChannelTags(rec.Id, rec.Tags); err != nil {
+		return 0, 0, err
+	}
+
+	return StoreImportedFeed(rec.Id, feed)
+}
+
+/*--------------------------------*/
+
+// StoreImportedFeed adds the entries of a feed to a channel that is already stored,
+// it returns the number of new values and new sensors
+func StoreImportedFeed(channelId interface{}, feed Feed) (int64, int64, error) {
+
+	newValues, newSensors, err := storeFeedEntries(channelId, feed)
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+		s.NewExtractedSensorValues += newValues
+		s.NewExtractedSensors += newSensors
+	})
+	if err != nil {
+		return newValues, newSensors, err
+	}
+
+	// The cursor never goes back, e.g. when older entries are imported again
+	SQL := `UPDATE "channels" SET "last_entry_id" = $1 WHERE "id" = $2 AND "last_entry_id" < $1`
+	_, err = global.DB.Exec(SQL, database.QueryParams{feed.LastEntryId, channelId})
+	return newValues, newSensors, err
+}
+
+/*--------------------------------*/
@@ -0,0 +1,59 @@
+package datacollection
+
+import (
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+)
+
+/*--------------------------------*/
+
+// storeEntryLocations stores the location, elevation and status of the entries that have any of them,
+// they are kept per entry (`channel_entries`) as they are shared by all the sensors of the channel
+func storeEntryLocations(channelId interface{}, entries []FeedEntry) error {
+
+	var rows []database.QueryParams
+	for _, rec := range entries {
+
+		if rec.Latitude == nil && rec.Longitude == nil && rec.Elevation == nil && rec.Status == "" {
+			continue
+		}
+
+		var status interface{}
+		if rec.Status != "" {
+			status = cleanStatus(rec.Status)
+		}
+
+		rows = append(rows, database.QueryParams{
+			channelId,
+			rec.EntryId,
+			rec.CreatedAt,
+			rec.Latitude, // nil pointers are stored as NULL
+			rec.Longitude,
+			rec.Elevation,
+			status,
+		})
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := global.DB.BulkInsert("channel_entries", []string{"channel_id", "entry_id", "created_at", "latitude", "longitude", "elevation", "status"}, rows, true)
+	return err
+}
+
+/*--------------------------------*/
+
+// maxStatusLength is the size of the `channel_entries.status` column
+const maxStatusLength = 255
+
+func cleanStatus(status string) string {
+
+	runes := []rune(status)
+	if len(runes) > maxStatusLength {
+		return string(runes[:maxStatusLength])
+	}
+	return status
+}
+
+/*--------------------------------*/
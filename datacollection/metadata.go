@@ -0,0 +1,88 @@
+package datacollection
+
+import (
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// channelMetadataRow returns the columns of a channel that are refreshed every time it is listed
+func channelMetadataRow(rec Channel) database.RowType {
+
+	row := database.RowType{
+		"name":                 rec.Name,
+		"description":          rec.Description,
+		"latitude":             rec.Latitude,
+		"longitude":            rec.Longitude,
+		"url":                  rec.URL,
+		"ranking":              rec.Ranking,
+		"public_flag":          rec.PublicFlag,
+		"github_url":           rec.GithubURL,
+		"elevation":            nil,
+		"remote_last_entry_id": nil,
+		"metadata_updated_at":  time.Now().UTC(),
+	}
+
+	if elevation, err := strconv.ParseFloat(strings.TrimSpace(rec.Elevation), 64); err == nil {
+		row["elevation"] = elevation
+	}
+	if rec.LastEntryId >= 0 {
+		row["remote_last_entry_id"] = rec.LastEntryId
+	}
+
+	return row
+}
+
+/*--------------------------------*/
+
+// storeChannelTags replaces the tags of a channel
+func storeChannelTags(channelId string, tags []ChannelTag) error {
+
+	_, err := global.DB.Delete("channel_tags", database.RowType{"channel_id": channelId})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+
+		name := strings.TrimSpace(tag.Name)
+		if name == "" {
+			continue
+		}
+
+		SQL := `INSERT INTO "channel_tags" ("channel_id", "tag_id", "name") VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+		_, err := global.DB.Exec(SQL, database.QueryParams{channelId, tag.Id, name})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*--------------------------------*/
+
+// loadChannelTags returns the tags of all the channels
+func loadChannelTags() (map[int64][]ChannelTag, error) {
+
+	rows, err := global.DB.Load("channel_tags", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(map[int64][]ChannelTag)
+	for _, row := range rows {
+		channelId, _ := row["channel_id"].(int64)
+		tagId, _ := row["tag_id"].(int64)
+		name, _ := row["name"].(string)
+		output[channelId] = append(output[channelId], ChannelTag{Id: tagId, Name: name})
+	}
+
+	return output, nil
+}
+
+/*--------------------------------*/
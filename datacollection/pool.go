@@ -0,0 +1,76 @@
+package datacollection
+
+import (
+	"context"
+	"sensor-data-simulator/global"
+	"strconv"
+	"sync"
+)
+
+/*--------------------------------*/
+
+// workerPool runs the submitted jobs on a fixed number of goroutines.
+// All the jobs receive the context of the pool, so they can stop as soon as it is cancelled
+type workerPool struct {
+	ctx  context.Context
+	jobs chan func(ctx context.Context)
+	wg   sync.WaitGroup
+}
+
+// workersCount returns the size of the pools, from `COLLECTION_WORKERS` or `global.MaxNumGoRoutines` by default
+func workersCount() int {
+
+	size, _ := strconv.Atoi(global.ENV.COLLECTION_WORKERS)
+	if size <= 0 {
+		size = global.MaxNumGoRoutines
+	}
+	return size
+}
+
+func newWorkerPool(ctx context.Context, size int) *workerPool {
+
+	pool := &workerPool{
+		ctx:  ctx,
+		jobs: make(chan func(ctx context.Context)),
+	}
+
+	for i := 0; i < size; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				job(ctx)
+			}
+		}()
+	}
+
+	return pool
+}
+
+/*--------------------------------*/
+
+// Submit blocks until a worker picks the job up,
+// it returns false if the context is cancelled before that
+func (pool *workerPool) Submit(job func(ctx context.Context)) bool {
+
+	if pool.ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case pool.jobs <- job:
+		return true
+	case <-pool.ctx.Done():
+		return false
+	}
+}
+
+/*--------------------------------*/
+
+// Wait stops accepting new jobs and waits for the running ones to finish
+func (pool *workerPool) Wait() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+/*--------------------------------*/
@@ -0,0 +1,164 @@
+package datacollection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The private channels are registered by the users with their read API key,
+// they are collected like the others but only their owner can see them
+
+// privateChannelsSource is the source that the private channels are fetched from
+const privateChannelsSource = "thingspeak"
+
+var ErrChannelTaken = errors.New("the channel is already collected, as a public channel or for another user")
+
+var ErrChannelPublic = errors.New("the channel is public, it cannot be registered as a private channel")
+
+/*--------------------------------*/
+
+// RegisterPrivateChannel checks the API key of a channel on its source and adds the channel for the given user,
+// registering it again only replaces its API key
+func RegisterPrivateChannel(ctx context.Context, userId int64, channelId int64, apiKey string) error {
+
+	channels, err := global.DB.Load("channels", database.RowType{"id": channelId})
+	if err != nil {
+		return err
+	}
+
+	exists := len(channels) > 0
+	if exists {
+		if ownerId, _ := channels[0]["owner_id"].(int64); ownerId != userId {
+			return ErrChannelTaken
+		}
+	}
+
+	/*---------*/
+
+	src, ok := GetSource(privateChannelsSource)
+	if !ok {
+		return fmt.Errorf("the source of the private channels (`%v`) is not enabled", privateChannelsSource)
+	}
+
+	// A public channel is for everyone, even if the discovery has not listed it yet
+	_, err = src.FetchFeed(ctx, strconv.FormatInt(channelId, 10), FeedOptions{Results: 1})
+	if err == nil {
+		return ErrChannelPublic
+	}
+	if !errors.Is(err, ErrChannelNotFound) {
+		return err
+	}
+
+	feed, err := src.FetchFeed(ctx, strconv.FormatInt(channelId, 10), FeedOptions{ApiKey: apiKey, Results: 1})
+	if err != nil {
+		return err
+	}
+
+	rec := feed.Channel
+	rec.Id = strconv.FormatInt(channelId, 10)
+
+	fields := channelMetadataRow(rec)
+	fields["metadata"] = feed.Metadata
+	fields["owner_id"] = userId
+
+	if exists {
+
+		if _, err := global.DB.Update("channels", fields, database.RowType{"id": channelId}); err != nil {
+			return err
+		}
+		reviveChannel(rec.Id)
+
+	} else {
+
+		fields["id"] = channelId
+		fields["source"] = src.Name()
+		fields["last_entry_id"] = "0" // The first refresh gets the latest entries, like for the discovered channels
+		fields["created_at"] = rec.CreatedAt
+
+		if _, err := global.DB.Insert("channels", fields); err != nil {
+			return err
+		}
+
+		if global.ENV.BACKFILL_ON_DISCOVERY == "true" {
+			QueueBackfill(channelId, time.Time{})
+		}
+	}
+
+	/*---------*/
+
+	now := time.Now().UTC()
+	SQL := `INSERT INTO "private_channels" ("channel_id", "user_id", "read_api_key", "created_at", "updated_at")
+			VALUES ($1, $2, $3, $4, $4)
+			ON CONFLICT ("channel_id") DO UPDATE SET
+				"user_id" = EXCLUDED."user_id",
+				"read_api_key" = EXCLUDED."read_api_key",
+				"updated_at" = EXCLUDED."updated_at"`
+	_, err = global.DB.Exec(SQL, database.QueryParams{channelId, userId, apiKey, now})
+	return err
+}
+
+/*--------------------------------*/
+
+// UnregisterPrivateChannel forgets the API key of a private channel of the user, so it is not fetched any more.
+// The collected values are kept for the owner. It returns false if the user has no such channel
+func UnregisterPrivateChannel(userId int64, channelId int64) (bool, error) {
+
+	delRes, err := global.DB.Delete("private_channels", database.RowType{"channel_id": channelId, "user_id": userId})
+	if err != nil {
+		return false, err
+	}
+	if delRes.RowsAffected == 0 {
+		return false, nil
+	}
+
+	_, err = global.DB.Update("channels", database.RowType{"state": ChannelGone}, database.RowType{"id": channelId, "owner_id": userId})
+	return true, err
+}
+
+/*--------------------------------*/
+
+// makeChannelPublic gives a private channel to everyone once its source lists it as public
+func makeChannelPublic(channelId string) {
+
+	_, err := global.DB.Update("channels", database.RowType{"owner_id": nil}, database.RowType{"id": channelId})
+	if err != nil {
+		log.Printf("\nError in data update: %v", err)
+		return
+	}
+
+	_, err = global.DB.Delete("private_channels", database.RowType{"channel_id": channelId})
+	if err != nil {
+		log.Printf("\nError in `private_channels` deletion: %v", err)
+	}
+}
+
+/*--------------------------------*/
+
+// channelApiKey returns the read API key of a channel, empty for the public channels
+func channelApiKey(channel database.RowType) (string, error) {
+
+	if channel["owner_id"] == nil {
+		return "", nil
+	}
+
+	rows, err := global.DB.Load("private_channels", database.RowType{"channel_id": channel["id"]})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil // Unregistered, the source tells us it is not reachable
+	}
+
+	apiKey, _ := rows[0]["read_api_key"].(string)
+	return apiKey, nil
+}
+
+/*--------------------------------*/
@@ -0,0 +1,403 @@
+package datacollection
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The quality flags of a value, stored as a bitmask in `sensor_values.quality_flags`.
+// A NULL `quality_flags` means the value is not checked yet, 0 means no issue is found
+const (
+	FlagOutlier            = 1 << iota // far from the other values of the sensor (robust z-score)
+	FlagOutOfPhysicalRange             // impossible for what the sensor measures, e.g. -127 °C
+	FlagStuck                          // the same value repeated for a long time
+	FlagSpike                          // a sudden jump that goes right back
+)
+
+var qualityFlagNames = []struct {
+	Flag int64
+	Name string
+}{
+	{FlagOutlier, "outlier"},
+	{FlagOutOfPhysicalRange, "out_of_physical_range"},
+	{FlagStuck, "stuck"},
+	{FlagSpike, "spike"},
+}
+
+// QualityIssues returns the names of the flags that are set
+func QualityIssues(flags int64) []string {
+
+	output := []string{}
+	for _, f := range qualityFlagNames {
+		if flags&f.Flag != 0 {
+			output = append(output, f.Name)
+		}
+	}
+	return output
+}
+
+/*--------------------------------*/
+
+const (
+	qualityBatchSize   = 2000 // unchecked values processed at once for a sensor
+	qualityContextSize = 200  // checked values before the batch, so the checks see what came before
+
+	outlierThreshold = 3.5 // robust z-score
+	spikeThreshold   = 6   // times the typical change between two consecutive values
+
+	stuckMinCount    = 10
+	stuckMinDuration = 24 * time.Hour
+)
+
+// physicalRange returns the range of the possible values of a sensor, if it is known from its quantity.
+// The sensors that are not classified yet are guessed from their name
+func physicalRange(sensorName string, quantity string, unit string) (float64, float64, bool) {
+
+	if quantity == "" {
+		c := classifyName(sensorName)
+		quantity, unit = c.Quantity, c.Unit
+		if q, ok := quantitiesByName[quantity]; ok && unit == "" {
+			unit = q.Unit
+		}
+	}
+
+	q, ok := quantitiesByName[quantity]
+	if !ok || !q.HasRange || unit != q.Unit {
+		return 0, 0, false // The range is in the usual unit only
+	}
+	return q.Min, q.Max, true
+}
+
+/*--------------------------------*/
+
+// CheckQuality flags the values that are not checked yet, sensor by sensor
+func CheckQuality(ctx context.Context) {
+
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.QualityRunning = true })
+	defer global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.QualityRunning = false })
+
+	fmt.Print("\n\t\t* * * Checking the quality of the new values * * *\n\n")
+
+	SQL := `SELECT s."id", s."name", s."value_type", s."quantity", s."unit"
+			FROM "sensors" AS s
+			WHERE EXISTS (
+				SELECT 1 FROM "sensor_values" AS v
+				WHERE v."sensor_id" = s."id" AND v."quality_flags" IS NULL
+			)`
+	sensors, err := global.DB.Query(SQL, database.QueryParams{})
+	if err != nil {
+		log.Printf("\nError in loading the sensors: %v", err)
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+		return
+	}
+
+	pool := newWorkerPool(ctx, workersCount())
+	for _, sensor := range sensors {
+
+		sensor := sensor
+		if !pool.Submit(func(ctx context.Context) {
+			if err := checkSensorQuality(ctx, sensor); err != nil {
+				log.Printf("\nError in quality check of sensor %v: %v", sensor["id"], err)
+				global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.Errors++ })
+			}
+		}) {
+			break // Cancelled
+		}
+	}
+	pool.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	fmt.Printf("\n\nAll Done [ New flagged values: %d ] :)\n\n---------------------------------------------------------\n", global.DataCollectorProgress.Status().NewFlaggedValues)
+}
+
+/*--------------------------------*/
+
+// RecheckQuality clears the flags of all the values of a sensor, so they are checked again in the next run
+func RecheckQuality(sensorId int64) error {
+
+	SQL := `UPDATE "sensor_values" SET "quality_flags" = NULL WHERE "sensor_id" = $1`
+	_, err := global.DB.Exec(SQL, database.QueryParams{sensorId})
+	return err
+}
+
+/*--------------------------------*/
+
+type qualityPoint struct {
+	EntryId   int64
+	CreatedAt time.Time
+	Value     *float64 // nil for the values that are not numbers
+	Flags     int64    // the stored flags of the values already checked
+}
+
+func checkSensorQuality(ctx context.Context, sensor database.RowType) error {
+
+	sensorId := sensor["id"].(int64)
+	sensorName, _ := sensor["name"].(string)
+	valueType, _ := sensor["value_type"].(string)
+	quantity, _ := sensor["quantity"].(string)
+	unit, _ := sensor["unit"].(string)
+
+	minValue, maxValue, hasRange := physicalRange(sensorName, quantity, unit)
+
+	for ctx.Err() == nil {
+
+		SQL := `SELECT "entry_id", "created_at", "value_num"
+				FROM "sensor_values"
+				WHERE "sensor_id" = $1 AND "quality_flags" IS NULL
+				ORDER BY "entry_id" ASC
+				LIMIT $2`
+		uncheckedRows, err := global.DB.Query(SQL, database.QueryParams{sensorId, qualityBatchSize})
+		if err != nil {
+			return err
+		}
+		if len(uncheckedRows) == 0 {
+			return nil
+		}
+
+		SQL = `SELECT "entry_id", "created_at", "value_num", "quality_flags"
+				FROM "sensor_values"
+				WHERE "sensor_id" = $1 AND "quality_flags" IS NOT NULL AND "entry_id" < $2
+				ORDER BY "entry_id" DESC
+				LIMIT $3`
+		contextRows, err := global.DB.Query(SQL, database.QueryParams{sensorId, uncheckedRows[0]["entry_id"], qualityContextSize})
+		if err != nil {
+			return err
+		}
+
+		/*---------*/
+
+		points := make([]qualityPoint, 0, len(contextRows)+len(uncheckedRows))
+		for i := len(contextRows) - 1; i >= 0; i-- {
+			points = append(points, toQualityPoint(contextRows[i]))
+		}
+		for _, row := range uncheckedRows {
+			points = append(points, toQualityPoint(row))
+		}
+
+		var flags []int64
+		if valueType == ValueBoolean || valueType == ValueText {
+			flags = make([]int64, len(points)) // Nothing to check on these
+		} else {
+			flags = computeQualityFlags(points, minValue, maxValue, hasRange)
+		}
+
+		/*---------*/
+
+		checked := points[len(contextRows):]
+		checkedFlags := flags[len(contextRows):]
+
+		if err := storeQualityFlags(sensorId, checked, checkedFlags); err != nil {
+			return err
+		}
+
+		flagged := int64(0)
+		for _, f := range checkedFlags {
+			if f != 0 {
+				flagged++
+			}
+		}
+
+		// The last checked value was checked without the one after it, it can be a spike now
+		if n := len(contextRows); n > 0 && flags[n-1]&FlagSpike != 0 && points[n-1].Flags&FlagSpike == 0 {
+			if err := storeQualityFlags(sensorId, points[n-1:n], []int64{points[n-1].Flags | FlagSpike}); err != nil {
+				return err
+			}
+			if points[n-1].Flags == 0 {
+				flagged++
+			}
+		}
+
+		global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) { s.NewFlaggedValues += flagged })
+	}
+
+	return ctx.Err()
+}
+
+/*--------------------------------*/
+
+func toQualityPoint(row database.RowType) qualityPoint {
+
+	point := qualityPoint{}
+	point.EntryId, _ = row["entry_id"].(int64)
+	point.CreatedAt, _ = row["created_at"].(time.Time)
+	if value, ok := row["value_num"].(float64); ok {
+		point.Value = &value
+	}
+	point.Flags, _ = row["quality_flags"].(int64)
+	return point
+}
+
+/*--------------------------------*/
+
+// computeQualityFlags returns the flags of each point, the points are in the order of their entries
+func computeQualityFlags(points []qualityPoint, minValue float64, maxValue float64, hasRange bool) []int64 {
+
+	flags := make([]int64, len(points))
+
+	// Only the numbers are checked
+	var idx []int
+	var values []float64
+	for i, p := range points {
+		if p.Value != nil {
+			idx = append(idx, i)
+			values = append(values, *p.Value)
+		}
+	}
+
+	if len(values) == 0 {
+		return flags
+	}
+
+	/*---------*/
+
+	if hasRange {
+		for k, v := range values {
+			if v < minValue || v > maxValue {
+				flags[idx[k]] |= FlagOutOfPhysicalRange
+			}
+		}
+	}
+
+	/*---------*/
+
+	// Robust z-score: 0.6745 * (x - median) / MAD
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for k, v := range values {
+		deviations[k] = math.Abs(v - med)
+	}
+	scale := median(deviations) / 0.6745
+	if scale == 0 {
+		// More than half of the values are the same, the mean absolute deviation is used instead
+		scale = 1.253314 * mean(deviations)
+	}
+	if scale > 0 {
+		for k, v := range values {
+			if math.Abs(v-med)/scale > outlierThreshold {
+				flags[idx[k]] |= FlagOutlier
+			}
+		}
+	}
+
+	/*---------*/
+
+	// A run of the same value, long enough in count and in time
+	for start := 0; start < len(values); {
+		end := start + 1
+		for end < len(values) && values[end] == values[start] {
+			end++
+		}
+
+		duration := points[idx[end-1]].CreatedAt.Sub(points[idx[start]].CreatedAt)
+		if end-start >= stuckMinCount && duration >= stuckMinDuration {
+			for k := start + 1; k < end; k++ {
+				flags[idx[k]] |= FlagStuck
+			}
+		}
+		start = end
+	}
+
+	/*---------*/
+
+	// A spike jumps away from the previous value and comes right back with the next one
+	if len(values) >= 3 {
+		changes := make([]float64, len(values)-1)
+		for k := 1; k < len(values); k++ {
+			changes[k-1] = math.Abs(values[k] - values[k-1])
+		}
+		typicalChange := math.Max(median(changes), 0.001*math.Max(1, math.Abs(med)))
+
+		for k := 1; k < len(values)-1; k++ {
+			jumpIn := values[k] - values[k-1]
+			jumpOut := values[k+1] - values[k]
+			if math.Abs(jumpIn) > spikeThreshold*typicalChange &&
+				math.Abs(jumpOut) > spikeThreshold*typicalChange &&
+				(jumpIn > 0) != (jumpOut > 0) &&
+				math.Abs(values[k+1]-values[k-1]) <= spikeThreshold*typicalChange {
+				flags[idx[k]] |= FlagSpike
+			}
+		}
+	}
+
+	return flags
+}
+
+/*--------------------------------*/
+
+func median(values []float64) float64 {
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func mean(values []float64) float64 {
+
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+/*--------------------------------*/
+
+// storeQualityFlags writes the flags of the checked values in a few statements
+func storeQualityFlags(sensorId int64, points []qualityPoint, flags []int64) error {
+
+	// 2 params per value
+	const valuesPerStatement = 10000
+
+	for start := 0; start < len(points); start += valuesPerStatement {
+
+		end := start + valuesPerStatement
+		if end > len(points) {
+			end = len(points)
+		}
+
+		params := database.QueryParams{sensorId}
+		tuples := make([]string, 0, end-start)
+		for k := start; k < end; k++ {
+			params = append(params, points[k].EntryId, flags[k])
+			tuples = append(tuples, fmt.Sprintf("($%d::bigint, $%d::integer)", len(params)-1, len(params)))
+		}
+
+		SQL := `UPDATE "sensor_values" AS v
+				SET "quality_flags" = t."flags"
+				FROM (VALUES ` + strings.Join(tuples, ",") + `) AS t("entry_id", "flags")
+				WHERE
+					v."sensor_id" = $1 AND
+					v."entry_id" = t."entry_id"`
+		if _, err := global.DB.Exec(SQL, params); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*--------------------------------*/
@@ -0,0 +1,160 @@
+package datacollection
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*--------------------------------*/
+
+// testPoints builds consecutive points every step, NaN is a value that is not a number
+func testPoints(step time.Duration, values ...float64) []qualityPoint {
+
+	start := time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC)
+	points := make([]qualityPoint, len(values))
+	for i, v := range values {
+		points[i] = qualityPoint{EntryId: int64(i + 1), CreatedAt: start.Add(time.Duration(i) * step)}
+		if !math.IsNaN(v) {
+			value := v
+			points[i].Value = &value
+		}
+	}
+	return points
+}
+
+func repeatValue(value float64, count int) []float64 {
+
+	values := make([]float64, count)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+/*--------------------------------*/
+
+func TestComputeQualityFlags(t *testing.T) {
+
+	nan := math.NaN()
+
+	const (
+		O = FlagOutlier
+		R = FlagOutOfPhysicalRange
+		S = FlagStuck
+		P = FlagSpike
+	)
+
+	stuckCount := func(step time.Duration, count int) []qualityPoint {
+		return testPoints(step, repeatValue(5, count)...)
+	}
+	stuckFlags := func(count int) []int64 {
+		flags := make([]int64, count)
+		for i := 1; i < count; i++ {
+			flags[i] = S // The first value of the run is fine
+		}
+		return flags
+	}
+
+	// 24 hours between the first and the tenth value
+	stuckStep := stuckMinDuration / (stuckMinCount - 1)
+
+	tests := []struct {
+		name     string
+		points   []qualityPoint
+		hasRange bool
+		want     []int64
+	}{
+		{"no points", nil, false, []int64{}},
+		{"no numbers", testPoints(time.Hour, nan, nan), false, []int64{0, 0}},
+		{"smooth values", testPoints(time.Hour, 10, 12, 11, 13, 10, 12, 11, 13), false, []int64{0, 0, 0, 0, 0, 0, 0, 0}},
+
+		// Physical range of -40 to 85
+		{"out of range", testPoints(time.Hour, 20, -127, 90, 85, -40), true, []int64{0, R, R, 0, 0}},
+		{"no range", testPoints(time.Hour, 20, -127, 90, 85, -40), false, []int64{0, 0, 0, 0, 0}},
+
+		// Outliers
+		{"outlier", testPoints(time.Hour, 10, 12, 11, 13, 10, 12, 11, 13, 100), false, []int64{0, 0, 0, 0, 0, 0, 0, 0, O}},
+		{"not numbers are skipped", testPoints(time.Hour, 10, nan, 12, 11, 13, 10, 12, 11, 13, 100), false, []int64{0, 0, 0, 0, 0, 0, 0, 0, 0, O}},
+		{"same values", testPoints(time.Hour, 20, 20, 20, 20, 20), false, []int64{0, 0, 0, 0, 0}},
+		{
+			"MAD of 0", // More than half of the values are the same
+			testPoints(time.Hour, 20, 20, 20, 20, 20, 25, 20, 20, 20, 20, 20),
+			false,
+			[]int64{0, 0, 0, 0, 0, O | P, 0, 0, 0, 0, 0},
+		},
+		{
+			"MAD of 0 with a level change",
+			testPoints(time.Hour, 20, 20, 20, 20, 20, 20, 21, 21, 21, 21, 21),
+			false,
+			[]int64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+
+		// Stuck values
+		{"stuck", stuckCount(stuckStep, stuckMinCount), false, stuckFlags(stuckMinCount)},
+		{"stuck longer", stuckCount(stuckStep, stuckMinCount+5), false, stuckFlags(stuckMinCount + 5)},
+		{"not enough values to be stuck", stuckCount(2*stuckStep, stuckMinCount-1), false, make([]int64, stuckMinCount-1)},
+		{"not long enough to be stuck", stuckCount(stuckStep-time.Minute, stuckMinCount), false, make([]int64, stuckMinCount)},
+		{
+			"stuck over a value that is not a number",
+			testPoints(stuckStep, 5, 5, 5, 5, 5, nan, 5, 5, 5, 5, 5),
+			false,
+			[]int64{0, S, S, S, S, 0, S, S, S, S, S},
+		},
+		{
+			"stuck values are consecutive",
+			testPoints(stuckStep, 5, 5, 5, 5, 5, 6, 5, 5, 5, 5, 5),
+			false,
+			[]int64{0, 0, 0, 0, 0, O | P, 0, 0, 0, 0, 0},
+		},
+
+		// Spikes
+		{"spike", testPoints(time.Hour, 0, 10, 20, 30, 110, 40, 50, 60, 70, 80), false, []int64{0, 0, 0, 0, P, 0, 0, 0, 0, 0}},
+		{"step is not a spike", testPoints(time.Hour, 0, 10, 20, 30, 110, 120, 130), false, []int64{0, 0, 0, 0, 0, 0, 0}},
+		{"too few values for spikes", testPoints(time.Hour, 0, 100), false, []int64{0, 0}},
+		{"jump at the first value", testPoints(time.Hour, 110, 10, 20, 30, 40, 50), false, []int64{0, 0, 0, 0, 0, 0}},
+		{
+			"jump at the last value of the batch", // Not known yet if it comes back
+			testPoints(time.Hour, 0, 10, 20, 30, 40, 50, 60, 70, 80, 160),
+			false,
+			[]int64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			"spike once the next values are known", // The same values with the next batch
+			testPoints(time.Hour, 0, 10, 20, 30, 40, 50, 60, 70, 80, 160, 90, 100),
+			false,
+			[]int64{0, 0, 0, 0, 0, 0, 0, 0, 0, P, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		got := computeQualityFlags(test.points, -40, 85, test.hasRange)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: flags = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestQualityIssues(t *testing.T) {
+
+	tests := []struct {
+		flags int64
+		want  []string
+	}{
+		{0, []string{}},
+		{FlagOutlier, []string{"outlier"}},
+		{FlagStuck | FlagOutOfPhysicalRange, []string{"out_of_physical_range", "stuck"}},
+		{FlagOutlier | FlagOutOfPhysicalRange | FlagStuck | FlagSpike, []string{"outlier", "out_of_physical_range", "stuck", "spike"}},
+	}
+
+	for _, test := range tests {
+		if got := QualityIssues(test.flags); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("QualityIssues(%v) = %q, want %q", test.flags, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
@@ -0,0 +1,102 @@
+package datacollection
+
+import (
+	"context"
+	"log"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sort"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The runs and the cancels asked on the instances that do not lead the collection are stored
+// in the `collection_requests` table, the leader picks them up
+
+const (
+	RequestRun    = "run"
+	RequestCancel = "cancel"
+
+	requestPollInterval = 2 * time.Second
+	requestMaxAge       = "1 minute" // Older requests are dropped, e.g. when no instance was leading
+)
+
+/*--------------------------------*/
+
+// SendRunRequest asks the leader to start a run
+func SendRunRequest(trigger string) error {
+	return sendRequest(RequestRun, trigger)
+}
+
+// SendCancelRequest asks the leader to stop its current run
+func SendCancelRequest() error {
+	return sendRequest(RequestCancel, "")
+}
+
+func sendRequest(kind string, trigger string) error {
+
+	SQL := `INSERT INTO "collection_requests" ("kind", "trigger", "requested_at") VALUES ($1, $2, timezone('UTC', now()))`
+	_, err := global.DB.Exec(SQL, database.QueryParams{kind, trigger})
+	return err
+}
+
+/*--------------------------------*/
+
+// pollRequests applies the stored requests until the context is done
+func pollRequests(ctx context.Context) {
+
+	ticker := time.NewTicker(requestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			applyRequests()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func applyRequests() {
+
+	// Each request is taken by one leader only
+	SQL := `DELETE FROM "collection_requests"
+		RETURNING "id", "kind", "trigger", ("requested_at" < timezone('UTC', now()) - interval '` + requestMaxAge + `') AS "expired"`
+	rows, err := global.DB.Query(SQL, database.QueryParams{})
+	if err != nil {
+		log.Printf("\nError in `collection_requests` query: %v", err)
+		return
+	}
+
+	// In the order they were made
+	sort.Slice(rows, func(i, j int) bool { return rows[i]["id"].(int64) < rows[j]["id"].(int64) })
+
+	for _, row := range rows {
+
+		kind, _ := row["kind"].(string)
+		trigger, _ := row["trigger"].(string)
+
+		if expired, _ := row["expired"].(bool); expired {
+			log.Printf("[COLL ] The %v request %v is too old, it is dropped", kind, row["id"])
+			continue
+		}
+
+		switch kind {
+		case RequestRun:
+			if trigger == "" {
+				trigger = TriggerAPI
+			}
+			if err := RunNow(trigger); err != nil {
+				log.Printf("[COLL ] The run request %v is dropped: %v", row["id"], err)
+			}
+		case RequestCancel:
+			if !CancelRun() {
+				log.Printf("[COLL ] The cancel request %v is dropped: no run is in progress", row["id"])
+			}
+		}
+	}
+}
+
+/*--------------------------------*/
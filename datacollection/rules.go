@@ -0,0 +1,286 @@
+package datacollection
+
+import (
+	"fmt"
+	"regexp"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+)
+
+/*--------------------------------*/
+
+// The kinds of collection rules, the value of each rule is:
+const (
+	RuleAllowIds         = "allow_ids"         // comma separated channel ids
+	RuleDenyIds          = "deny_ids"          // comma separated channel ids
+	RuleNameRegex        = "name_regex"        // a regular expression on the channel name
+	RuleDescriptionRegex = "description_regex" // a regular expression on the channel description
+	RuleTag              = "tag"               // a ThingSpeak tag, case insensitive
+	RuleBoundingBox      = "bbox"              // min_lat,min_lng,max_lat,max_lng
+	RuleMinEntries       = "min_entries"       // the minimum number of entries of the channel
+)
+
+/*--------------------------------*/
+
+// CollectionRules decides which channels are stored and refreshed by the collector:
+//
+//   - A channel in a deny list is never collected.
+//   - A channel in an allow list is always collected.
+//   - Otherwise, if there is any rule other than the deny lists, the channel has to match
+//     every kind of filter (name, description, tag, bounding box, activity) that has at least one rule,
+//     matching one rule of a kind is enough for that kind.
+//   - With no rules at all, every channel is collected.
+type CollectionRules struct {
+	allowIds map[string]bool
+	denyIds  map[string]bool
+
+	nameRegexes        []*regexp.Regexp
+	descriptionRegexes []*regexp.Regexp
+	tags               map[string]bool
+	boundingBoxes      [][4]float64
+	minEntries         []int64
+}
+
+/*--------------------------------*/
+
+// LoadCollectionRules reads the rules from the `collection_rules` table
+func LoadCollectionRules() (*CollectionRules, error) {
+
+	rows, err := global.DB.Load("collection_rules", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &CollectionRules{
+		allowIds: make(map[string]bool),
+		denyIds:  make(map[string]bool),
+		tags:     make(map[string]bool),
+	}
+
+	for _, row := range rows {
+		kind, _ := row["kind"].(string)
+		value, _ := row["value"].(string)
+
+		if err := rules.add(kind, value); err != nil {
+			return nil, fmt.Errorf("collection rule %v: %v", row["id"], err)
+		}
+	}
+
+	return rules, nil
+}
+
+/*--------------------------------*/
+
+// ValidateCollectionRule checks a rule before it is stored
+func ValidateCollectionRule(kind string, value string) error {
+
+	rules := &CollectionRules{
+		allowIds: make(map[string]bool),
+		denyIds:  make(map[string]bool),
+		tags:     make(map[string]bool),
+	}
+	return rules.add(kind, value)
+}
+
+/*--------------------------------*/
+
+func (rules *CollectionRules) add(kind string, value string) error {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("the value is empty")
+	}
+
+	switch kind {
+
+	case RuleAllowIds, RuleDenyIds:
+		list := rules.allowIds
+		if kind == RuleDenyIds {
+			list = rules.denyIds
+		}
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+				return fmt.Errorf("invalid channel id `%v`", id)
+			}
+			list[id] = true
+		}
+
+	case RuleNameRegex, RuleDescriptionRegex:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+		if kind == RuleNameRegex {
+			rules.nameRegexes = append(rules.nameRegexes, re)
+		} else {
+			rules.descriptionRegexes = append(rules.descriptionRegexes, re)
+		}
+
+	case RuleTag:
+		rules.tags[strings.ToLower(value)] = true
+
+	case RuleBoundingBox:
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return fmt.Errorf("a bounding box needs 4 numbers: min_lat,min_lng,max_lat,max_lng")
+		}
+		var bbox [4]float64
+		for i, part := range parts {
+			var err error
+			bbox[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return fmt.Errorf("invalid number `%v` in the bounding box", part)
+			}
+		}
+		if bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+			return fmt.Errorf("the minimums of the bounding box are greater than the maximums")
+		}
+		rules.boundingBoxes = append(rules.boundingBoxes, bbox)
+
+	case RuleMinEntries:
+		minEntries, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || minEntries < 0 {
+			return fmt.Errorf("invalid number of entries `%v`", value)
+		}
+		rules.minEntries = append(rules.minEntries, minEntries)
+
+	default:
+		return fmt.Errorf("unknown kind of rule `%v`", kind)
+	}
+
+	return nil
+}
+
+/*--------------------------------*/
+
+// Match tells if a channel has to be collected.
+// Tags of a nil list and a negative LastEntryId are considered unknown and those filters are skipped
+func (rules *CollectionRules) Match(ch Channel) bool {
+
+	if rules == nil {
+		return true
+	}
+
+	if rules.denyIds[ch.Id] {
+		return false
+	}
+
+	if rules.allowIds[ch.Id] {
+		return true
+	}
+
+	hasFilters := len(rules.nameRegexes) > 0 || len(rules.descriptionRegexes) > 0 || len(rules.tags) > 0 ||
+		len(rules.boundingBoxes) > 0 || len(rules.minEntries) > 0
+
+	if !hasFilters {
+		// Only the allow list is given, so nothing else is wanted
+		return len(rules.allowIds) == 0
+	}
+
+	/*---------*/
+
+	if len(rules.nameRegexes) > 0 && !matchAnyRegex(rules.nameRegexes, ch.Name) {
+		return false
+	}
+
+	if len(rules.descriptionRegexes) > 0 && !matchAnyRegex(rules.descriptionRegexes, ch.Description) {
+		return false
+	}
+
+	if len(rules.tags) > 0 && ch.Tags != nil {
+		found := false
+		for _, tag := range ch.Tags {
+			if rules.tags[strings.ToLower(tag.Name)] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(rules.boundingBoxes) > 0 {
+		lat, errLat := strconv.ParseFloat(ch.Latitude, 64)
+		lng, errLng := strconv.ParseFloat(ch.Longitude, 64)
+		if errLat != nil || errLng != nil {
+			return false
+		}
+
+		found := false
+		for _, bbox := range rules.boundingBoxes {
+			if lat >= bbox[0] && lng >= bbox[1] && lat <= bbox[2] && lng <= bbox[3] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(rules.minEntries) > 0 && ch.LastEntryId >= 0 {
+		found := false
+		for _, minEntries := range rules.minEntries {
+			if ch.LastEntryId >= minEntries {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*--------------------------------*/
+
+func matchAnyRegex(regexes []*regexp.Regexp, text string) bool {
+
+	for _, re := range regexes {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+/*--------------------------------*/
+
+// channelFromRow converts a stored channel to be checked against the rules,
+// its tags are unknown until its metadata is captured by the channel extraction
+func channelFromRow(row database.RowType, channelTags map[int64][]ChannelTag) Channel {
+
+	ch := Channel{
+		Id:          fmt.Sprint(row["id"]),
+		LastEntryId: -1,
+	}
+	ch.Name, _ = row["name"].(string)
+	ch.Description, _ = row["description"].(string)
+
+	if lat, ok := row["latitude"].(float64); ok {
+		ch.Latitude = strconv.FormatFloat(lat, 'f', -1, 64)
+	}
+	if lng, ok := row["longitude"].(float64); ok {
+		ch.Longitude = strconv.FormatFloat(lng, 'f', -1, 64)
+	}
+	if lastEntryId, ok := row["remote_last_entry_id"].(int64); ok {
+		ch.LastEntryId = lastEntryId
+	}
+
+	if id, ok := row["id"].(int64); ok && row["metadata_updated_at"] != nil {
+		ch.Tags = channelTags[id]
+		if ch.Tags == nil {
+			ch.Tags = []ChannelTag{}
+		}
+	}
+
+	return ch
+}
+
+/*--------------------------------*/
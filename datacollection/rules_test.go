@@ -0,0 +1,146 @@
+package datacollection
+
+import "testing"
+
+/*--------------------------------*/
+
+// testRules builds the rules from kind/value pairs, like the rows of `collection_rules`
+func testRules(t *testing.T, kindValues ...string) *CollectionRules {
+
+	rules := &CollectionRules{
+		allowIds: make(map[string]bool),
+		denyIds:  make(map[string]bool),
+		tags:     make(map[string]bool),
+	}
+	for i := 0; i+1 < len(kindValues); i += 2 {
+		if err := rules.add(kindValues[i], kindValues[i+1]); err != nil {
+			t.Fatalf("add(%q, %q): %v", kindValues[i], kindValues[i+1], err)
+		}
+	}
+	return rules
+}
+
+/*--------------------------------*/
+
+func TestCollectionRulesMatch(t *testing.T) {
+
+	weather := Channel{
+		Id:          "12",
+		Name:        "Weather Station Berlin",
+		Description: "Temperature and humidity",
+		Latitude:    "52.52",
+		Longitude:   "13.40",
+		Tags:        []ChannelTag{{Name: "Weather"}, {Name: "IoT"}},
+		LastEntryId: 500,
+	}
+	farm := Channel{
+		Id:          "34",
+		Name:        "Farm sensors",
+		Description: "Soil moisture",
+		Latitude:    "-1.29",
+		Longitude:   "36.82",
+		Tags:        []ChannelTag{{Name: "agriculture"}},
+		LastEntryId: 20,
+	}
+	unknown := Channel{Id: "56", Name: "Weather", LastEntryId: -1} // Tags and entries not known yet
+
+	tests := []struct {
+		name    string
+		rules   *CollectionRules
+		channel Channel
+		want    bool
+	}{
+		{"nil rules", nil, weather, true},
+		{"no rules", testRules(t), weather, true},
+
+		// Allow and deny lists
+		{"denied", testRules(t, RuleDenyIds, "12"), weather, false},
+		{"not denied", testRules(t, RuleDenyIds, "12"), farm, true},
+		{"allowed", testRules(t, RuleAllowIds, "12, 99"), weather, true},
+		{"only the allowed ones", testRules(t, RuleAllowIds, "12"), farm, false},
+		{"deny wins over allow", testRules(t, RuleAllowIds, "12", RuleDenyIds, "12"), weather, false},
+		{"allow wins over filters", testRules(t, RuleAllowIds, "34", RuleTag, "weather"), farm, true},
+		{"deny wins over filters", testRules(t, RuleDenyIds, "12", RuleTag, "weather"), weather, false},
+		{"filters apply to the others", testRules(t, RuleAllowIds, "34", RuleTag, "weather"), weather, true},
+
+		// Regular expressions
+		{"name regex", testRules(t, RuleNameRegex, `^Weather`), weather, true},
+		{"name regex no match", testRules(t, RuleNameRegex, `^Weather`), farm, false},
+		{"name regex is case sensitive", testRules(t, RuleNameRegex, `^weather`), weather, false},
+		{"name regex with a flag", testRules(t, RuleNameRegex, `(?i)^weather`), weather, true},
+		{"name regex anywhere", testRules(t, RuleNameRegex, `Berlin`), weather, true},
+		{"one of the name regexes", testRules(t, RuleNameRegex, `^Farm`, RuleNameRegex, `Berlin$`), weather, true},
+		{"description regex", testRules(t, RuleDescriptionRegex, `(?i)soil`), farm, true},
+		{"name and description", testRules(t, RuleNameRegex, `Farm`, RuleDescriptionRegex, `Temperature`), farm, false},
+
+		// Tags
+		{"tag is case insensitive", testRules(t, RuleTag, "weather"), weather, true},
+		{"rule tag is case insensitive", testRules(t, RuleTag, "AGRICULTURE"), farm, true},
+		{"tag no match", testRules(t, RuleTag, "weather"), farm, false},
+		{"unknown tags are skipped", testRules(t, RuleTag, "weather"), unknown, true},
+		{"no tags", testRules(t, RuleTag, "weather"), Channel{Id: "78", Tags: []ChannelTag{}}, false},
+
+		// Bounding boxes
+		{"inside the box", testRules(t, RuleBoundingBox, "50,10,55,15"), weather, true},
+		{"outside the box", testRules(t, RuleBoundingBox, "50,10,55,15"), farm, false},
+		{"on the edge of the box", testRules(t, RuleBoundingBox, "52.52,13.40,53,14"), weather, true},
+		{"one of the boxes", testRules(t, RuleBoundingBox, "50,10,55,15", RuleBoundingBox, "-5,30,5,40"), farm, true},
+		{"no location", testRules(t, RuleBoundingBox, "-90,-180,90,180"), unknown, false},
+
+		// Entries
+		{"enough entries", testRules(t, RuleMinEntries, "100"), weather, true},
+		{"not enough entries", testRules(t, RuleMinEntries, "100"), farm, false},
+		{"unknown entries are skipped", testRules(t, RuleMinEntries, "100"), unknown, true},
+
+		// Every kind of filter has to match
+		{"all the kinds match", testRules(t, RuleTag, "iot", RuleBoundingBox, "50,10,55,15", RuleMinEntries, "100"), weather, true},
+		{"one kind does not match", testRules(t, RuleTag, "iot", RuleBoundingBox, "50,10,55,15", RuleMinEntries, "1000"), weather, false},
+	}
+
+	for _, test := range tests {
+		if got := test.rules.Match(test.channel); got != test.want {
+			t.Errorf("%v: Match(%v) = %v, want %v", test.name, test.channel.Id, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestValidateCollectionRule(t *testing.T) {
+
+	tests := []struct {
+		kind  string
+		value string
+		valid bool
+	}{
+		{RuleAllowIds, "1,2, 3", true},
+		{RuleDenyIds, "42", true},
+		{RuleNameRegex, `^Weather\s+\d+$`, true},
+		{RuleDescriptionRegex, "(?i)soil", true},
+		{RuleTag, "weather", true},
+		{RuleBoundingBox, "-10.5, 20, 10.5, 30", true},
+		{RuleMinEntries, "0", true},
+
+		{RuleAllowIds, "", false},
+		{RuleAllowIds, "   ", false},
+		{RuleAllowIds, "1,a", false},
+		{RuleDenyIds, "1,,2", false},
+		{RuleNameRegex, "(unclosed", false},
+		{RuleDescriptionRegex, "[a-", false},
+		{RuleBoundingBox, "1,2,3", false},
+		{RuleBoundingBox, "1,2,3,x", false},
+		{RuleBoundingBox, "10,20,0,30", false},
+		{RuleMinEntries, "-1", false},
+		{RuleMinEntries, "many", false},
+		{"glob", "*", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateCollectionRule(test.kind, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateCollectionRule(%q, %q): error = %v, valid = %v", test.kind, test.value, err, test.valid)
+		}
+	}
+}
+
+/*--------------------------------*/
@@ -0,0 +1,125 @@
+package datacollection
+
+import (
+	"log"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sensor-data-simulator/leader"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+const (
+	RunRunning     = "running"
+	RunDone        = "done"
+	RunCancelled   = "cancelled"
+	RunInterrupted = "interrupted" // The app stopped in the middle of the run
+)
+
+// collectionRun keeps the timings of a run, its counters are in `global.DataCollectorProgress`
+// and everything is stored in the `collection_runs` table once the run is over
+type collectionRun struct {
+	Id        int64
+	Trigger   string
+	Stages    []string
+	StartedAt time.Time
+
+	ChannelsDuration time.Duration
+	SensorsDuration  time.Duration
+	QualityDuration  time.Duration
+}
+
+/*--------------------------------*/
+
+// startRun resets the counters of the progress and adds the run to the history
+func startRun(trigger string, stages []string) *collectionRun {
+
+	run := &collectionRun{Trigger: trigger, Stages: stages, StartedAt: time.Now().UTC()}
+
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+		s.Trigger = trigger
+		s.NewExtractedChannels = 0
+		s.NewExtractedSensors = 0
+		s.NewExtractedSensorValues = 0
+		s.NewFlaggedValues = 0
+		s.NewClassifiedSensors = 0
+		s.RetriedRequests = 0
+		s.AbandonedRequests = 0
+		s.Errors = 0
+		s.LastError = ""
+	})
+
+	SQL := `INSERT INTO "collection_runs" ("started_at", "status", "trigger", "stages", "instance_id") VALUES ($1, $2, $3, $4, $5) RETURNING "id"`
+	rows, err := global.DB.Query(SQL, database.QueryParams{run.StartedAt, RunRunning, run.Trigger, strings.Join(run.Stages, ","), leader.InstanceId()})
+	if err != nil {
+		log.Printf("\nError in `collection_runs` insertion: %v", err)
+		return run
+	}
+	run.Id = rows[0]["id"].(int64)
+
+	return run
+}
+
+/*--------------------------------*/
+
+// finish stores the final state of the run in the history
+func (run *collectionRun) finish(status string) {
+
+	if run.Id == 0 {
+		return // It was not stored in the first place
+	}
+
+	progress := global.DataCollectorProgress.Status()
+
+	row := database.RowType{
+		"status":             status,
+		"finished_at":        time.Now().UTC(),
+		"channels_seconds":   run.ChannelsDuration.Seconds(),
+		"sensors_seconds":    run.SensorsDuration.Seconds(),
+		"quality_seconds":    run.QualityDuration.Seconds(),
+		"new_channels":       progress.NewExtractedChannels,
+		"new_sensors":        progress.NewExtractedSensors,
+		"new_values":         progress.NewExtractedSensorValues,
+		"flagged_values":     progress.NewFlaggedValues,
+		"retried_requests":   progress.RetriedRequests,
+		"abandoned_requests": progress.AbandonedRequests,
+		"errors":             progress.Errors,
+	}
+	if progress.LastError != "" {
+		row["last_error"] = progress.LastError
+	}
+
+	_, err := global.DB.Update("collection_runs", row, database.RowType{"id": run.Id})
+	if err != nil {
+		log.Printf("\nError in `collection_runs` update: %v \nRow: \n%v", err, row)
+	}
+}
+
+/*--------------------------------*/
+
+// closeInterruptedRuns marks the runs that were left running by a previous process or a previous leader.
+// Only the runs started before this instance took the lease over are marked, and only if their instance
+// holds no lease anymore (or is a previous process of this one), so a leader that is still finishing its run
+// when it steps down, or that still leads another subsystem, stores the final state of its run itself
+func closeInterruptedRuns() {
+
+	SQL := `UPDATE "collection_runs" SET "status" = $1
+			WHERE
+				"status" = $2 AND
+				"started_at" < COALESCE(
+					(SELECT "acquired_at" FROM "leader_leases" WHERE "name" = $3 AND "holder" = $4),
+					timezone('UTC', now())
+				) AND (
+					"instance_id" IS NULL OR
+					"instance_id" = $4 OR
+					"instance_id" NOT IN (SELECT "holder" FROM "leader_leases" WHERE "expires_at" >= timezone('UTC', now()))
+				)`
+	_, err := global.DB.Exec(SQL, database.QueryParams{RunInterrupted, RunRunning, leader.Collection, leader.InstanceId()})
+	if err != nil {
+		log.Printf("\nError in `collection_runs` update: %v", err)
+	}
+}
+
+/*--------------------------------*/
@@ -0,0 +1,85 @@
+package datacollection
+
+import (
+	"log"
+	"sensor-data-simulator/global"
+	"sensor-data-simulator/tools"
+	"strconv"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The stages of a run that are scheduled separately
+const (
+	StageDiscover = "discover" // listing the channels of the sources
+	StageRefresh  = "refresh"  // fetching the new entries of the channels and checking them
+)
+
+// schedule gives the time of the next run of a stage
+type schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// intervalSchedule runs a stage every given duration after the end of the previous run,
+// it is used when no cron expression is set
+type intervalSchedule time.Duration
+
+func (interval intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(interval))
+}
+
+/*--------------------------------*/
+
+// loadSchedule returns the schedule of a stage from its cron expression,
+// or the `DATA_EXTRACTION_INTERVAL` if there is none (or it is not valid)
+func loadSchedule(stage string, cronExpr string) schedule {
+
+	if cronExpr != "" {
+		cron, err := tools.ParseCron(cronExpr)
+		if err == nil {
+			return cron
+		}
+		log.Printf("[COLL ] Invalid cron expression for the %v stage (`%v`): %v, falling back to the interval", stage, cronExpr, err)
+	}
+
+	dataExtractionInterval := 60
+
+	if val := global.ENV.DATA_EXTRACTION_INTERVAL; val != "" {
+		dataExtractionInterval, _ = strconv.Atoi(val)
+		if dataExtractionInterval <= 0 {
+			dataExtractionInterval = 60
+		}
+	}
+
+	return intervalSchedule(time.Duration(dataExtractionInterval) * time.Minute)
+}
+
+// firstRun returns when a stage runs for the first time after the start of the app:
+// right away for the intervals, and at the next matching time for the cron expressions
+func firstRun(s schedule, now time.Time) time.Time {
+
+	if _, ok := s.(intervalSchedule); ok {
+		return now
+	}
+	return s.Next(now)
+}
+
+/*--------------------------------*/
+
+// setNextRunTimes shows the scheduled times in the status of the collector
+func setNextRunTimes(nextDiscover time.Time, nextRefresh time.Time) {
+
+	nextRun := nextDiscover
+	if nextRefresh.Before(nextRun) {
+		nextRun = nextRefresh
+	}
+
+	global.DataCollectorProgress.Update(func(s *global.DataCollectorStatus) {
+		s.NextDiscoveryTime = nextDiscover
+		s.NextRefreshTime = nextRefresh
+		s.NextRunTime = nextRun
+	})
+}
+
+/*--------------------------------*/
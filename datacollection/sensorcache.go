@@ -0,0 +1,95 @@
+package datacollection
+
+import (
+	"fmt"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sync"
+)
+
+/*--------------------------------*/
+
+// sensorIdCache keeps the sensor ids of each channel by their names, so storing a feed
+// does not need to look the sensors up in the database every time.
+// The sensors are never deleted, so the cached ids are always valid
+type sensorIdCache struct {
+	mu       sync.Mutex
+	channels map[string]*channelSensorIds
+}
+
+type channelSensorIds struct {
+	mu     sync.Mutex
+	loaded bool
+	ids    map[string]int64 // sensor name => sensor id
+}
+
+var sensorIds = &sensorIdCache{channels: make(map[string]*channelSensorIds)}
+
+/*--------------------------------*/
+
+// Get returns the ids of the given sensor names of a channel, the missing sensors are created.
+// It also returns the number of created sensors
+func (c *sensorIdCache) Get(channelId interface{}, names []string) (map[string]int64, int64, error) {
+
+	key := fmt.Sprint(channelId)
+
+	c.mu.Lock()
+	cached, ok := c.channels[key]
+	if !ok {
+		cached = &channelSensorIds{ids: make(map[string]int64)}
+		c.channels[key] = cached
+	}
+	c.mu.Unlock()
+
+	// Only the calls for the same channel wait for each other
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if !cached.loaded {
+		// First time for this channel, get all its sensors at once
+		rows, err := global.DB.Load("sensors", database.RowType{"channel_id": channelId})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, row := range rows {
+			name, _ := row["name"].(string)
+			if _, exist := cached.ids[name]; !exist {
+				cached.ids[name] = row["id"].(int64)
+			}
+		}
+		cached.loaded = true
+	}
+
+	/*---------*/
+
+	newSensors := int64(0)
+	output := make(map[string]int64)
+	for _, name := range names {
+
+		if id, exist := cached.ids[name]; exist {
+			output[name] = id
+			continue
+		}
+
+		// Another instance (or an import) may add the same sensor at the same time, we all get the same id.
+		// `xmax` is 0 only for the row that is inserted here
+		SQL := `INSERT INTO "sensors" ("channel_id", "name") VALUES ($1, $2)
+				ON CONFLICT ("channel_id", "name") DO UPDATE SET "name" = EXCLUDED."name"
+				RETURNING "id", ("xmax" = 0) AS "inserted"`
+		rows, err := global.DB.Query(SQL, database.QueryParams{channelId, name})
+		if err != nil {
+			return nil, newSensors, err
+		}
+
+		cached.ids[name] = rows[0]["id"].(int64)
+		output[name] = cached.ids[name]
+		if inserted, _ := rows[0]["inserted"].(bool); inserted {
+			newSensors++
+		}
+	}
+
+	return output, newSensors, nil
+}
+
+/*--------------------------------*/
@@ -0,0 +1,143 @@
+package datacollection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sensor-data-simulator/global"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// Source is a platform that the collector can extract channels and their feeds from.
+// Every implementation registers itself with RegisterSource and is enabled through
+// the `DATA_SOURCES` env variable (e.g. `thingspeak,othersource`)
+type Source interface {
+
+	// Name is stored in the `source` column of the channels extracted from this source
+	Name() string
+
+	// ListChannels returns one page of public channels, an empty list means there is no more pages
+	ListChannels(ctx context.Context, page int) ([]Channel, error)
+
+	// FetchFeed returns the feed entries of a channel that come after the given cursor
+	FetchFeed(ctx context.Context, channelId string, opts FeedOptions) (Feed, error)
+}
+
+/*--------------------------------*/
+
+// ErrChannelNotFound is returned by FetchFeed when the channel does not exist on the source or it is not public any more
+// (or the API key of a private channel is not valid)
+var ErrChannelNotFound = errors.New("the channel does not exist or is not public")
+
+/*--------------------------------*/
+
+type Channel struct {
+	Id          string
+	Name        string
+	Description string
+	Latitude    string
+	Longitude   string
+	CreatedAt   time.Time
+	URL         string
+	Elevation   string
+	Ranking     int
+	PublicFlag  bool
+	GithubURL   string
+	Tags        []ChannelTag
+	LastEntryId int64 // the number of entries on the source, -1 if unknown
+}
+
+type ChannelTag struct {
+	Id   int64 // 0 if the source has no ids for its tags
+	Name string
+}
+
+type FeedOptions struct {
+	AfterEntryId int64 // the cursor: only the entries with a greater entry id are returned
+
+	ApiKey string // the read API key of a private channel
+
+	// Optional time range, used to page through the history of a channel.
+	// When set, the latest `Results` entries created between `Start` and `End` are returned
+	Start   time.Time
+	End     time.Time
+	Results int
+}
+
+type Feed struct {
+	ChannelId   string
+	LastEntryId int64
+	Channel     Channel  // what the feed tells about the channel, it is how the private channels get their metadata
+	Metadata    string   // the free form metadata of the channel, usually the units of the fields
+	Fields      []string // sensor names, an empty name means the field is not in use
+	Entries     []FeedEntry
+}
+
+type FeedEntry struct {
+	EntryId   int64
+	CreatedAt time.Time
+	Values    []string // aligned with Feed.Fields
+
+	// Where the entry was taken and its status message, for the mobile channels (nil or empty if not given)
+	Latitude  *float64
+	Longitude *float64
+	Elevation *float64
+	Status    string
+}
+
+/*--------------------------------*/
+
+const defaultSources = "thingspeak"
+
+var registeredSources = make(map[string]Source)
+
+func RegisterSource(src Source) {
+	registeredSources[src.Name()] = src
+}
+
+/*--------------------------------*/
+
+// EnabledSources returns the registered sources that are listed in `DATA_SOURCES`
+func EnabledSources() []Source {
+
+	names := global.ENV.DATA_SOURCES
+	if names == "" {
+		names = defaultSources
+	}
+
+	var output []Source
+	for _, name := range strings.Split(names, ",") {
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		src, ok := registeredSources[name]
+		if !ok {
+			log.Printf("[COLL ] Unknown data source `%v`, ignoring it", name)
+			continue
+		}
+		output = append(output, src)
+	}
+
+	return output
+}
+
+/*--------------------------------*/
+
+// GetSource returns an enabled source by its name
+func GetSource(name string) (Source, bool) {
+
+	for _, src := range EnabledSources() {
+		if src.Name() == name {
+			return src, true
+		}
+	}
+	return nil, false
+}
+
+/*--------------------------------*/
@@ -0,0 +1,360 @@
+package datacollection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// ThingSpeak implements the Source interface for the public API of thingspeak.com
+type ThingSpeak struct{}
+
+func init() {
+	RegisterSource(&ThingSpeak{})
+}
+
+/*--------------------------------*/
+
+func (ts *ThingSpeak) Name() string {
+	return "thingspeak"
+}
+
+/*--------------------------------*/
+
+const defaultThingSpeakURL = "https://api.thingspeak.com/"
+
+const thingSpeakTimeFormat = "2006-01-02 15:04:05" // the format of `start` and `end` params, in UTC
+
+func (ts *ThingSpeak) baseURL() string {
+
+	baseURL := global.ENV.THINGSPEAK_API_URL
+	if baseURL == "" {
+		baseURL = defaultThingSpeakURL
+	}
+	return strings.TrimRight(baseURL, "/") + "/"
+}
+
+/*--------------------------------*/
+
+// get calls the given path of the ThingSpeak API,
+// or reads it from the recorded files when the fixture mode is on (i.e. `THINGSPEAK_FIXTURE_DIR` is set)
+func (ts *ThingSpeak) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+
+	if global.ENV.THINGSPEAK_FIXTURE_DIR != "" {
+		return ts.readFixture(path, query)
+	}
+
+	apiURL := ts.baseURL() + path
+	if len(query) > 0 {
+		apiURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := collectorHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the content: %v", err)
+	}
+
+	return content, nil
+}
+
+/*--------------------------------*/
+
+// readFixture maps an API path to a file in the fixture directory, the directory mirrors the API paths:
+//
+//	channels/public.json		page 1 of the channels (or `channels/public_<page>.json` for each page)
+//	channels/<id>/feed.json		feed of a channel
+//
+// A channel list can be either the API response or just a JSON array of channels (e.g. `ui/extTools/data.json`),
+// the latter is also picked up as `data.json` in the root of the directory.
+func (ts *ThingSpeak) readFixture(path string, query url.Values) ([]byte, error) {
+
+	dir := global.ENV.THINGSPEAK_FIXTURE_DIR
+
+	if path != "channels/public.json" {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if os.IsNotExist(err) {
+			return nil, ErrChannelNotFound
+		}
+		return content, err
+	}
+
+	/*---------*/
+
+	page := query.Get("page")
+	fileNames := []string{filepath.Join(dir, "channels", "public_"+page+".json")}
+	if page == "1" {
+		fileNames = append(fileNames,
+			filepath.Join(dir, "channels", "public.json"),
+			filepath.Join(dir, "data.json"),
+		)
+	}
+
+	for _, fileName := range fileNames {
+
+		content, err := ioutil.ReadFile(fileName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content = bytes.TrimSpace(content)
+		if bytes.HasPrefix(content, []byte("[")) {
+			content = []byte(fmt.Sprintf(`{"channels": %s}`, content))
+		}
+		return content, nil
+	}
+
+	// No more pages
+	return []byte(`{"channels": []}`), nil
+}
+
+/*--------------------------------*/
+
+func (ts *ThingSpeak) ListChannels(ctx context.Context, page int) ([]Channel, error) {
+
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+
+	content, err := ts.get(ctx, "channels/public.json", query)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseThingSpeakChannels(content)
+}
+
+/*--------------------------------*/
+
+// ParseThingSpeakChannels reads a list of channels in the format of ThingSpeak,
+// a `channels/public.json` response or a plain JSON array of channels (e.g. `ui/extTools/data.json`)
+func ParseThingSpeakChannels(content []byte) ([]Channel, error) {
+
+	content = bytes.TrimSpace(content)
+	if bytes.HasPrefix(content, []byte("[")) {
+		content = []byte(fmt.Sprintf(`{"channels": %s}`, content))
+	}
+
+	var channelsJSON struct {
+		Channels []struct {
+			Id          json.Number `json:"id"`
+			LastEntryId json.Number `json:"last_entry_id"`
+			Name        string      `json:"name"`
+			Description string      `json:"description"`
+			Latitude    string      `json:"latitude"`
+			Longitude   string      `json:"longitude"`
+			CreatedAt   time.Time   `json:"created_at"`
+			URL         string      `json:"url"`
+			Elevation   string      `json:"elevation"`
+			Ranking     int         `json:"ranking"`
+			PublicFlag  bool        `json:"public_flag"`
+			GithubURL   string      `json:"github_url"`
+			Tags        []struct {
+				Id   json.Number `json:"id"`
+				Name string      `json:"name"`
+			} `json:"tags"`
+		} `json:"channels"`
+	}
+	if err := json.Unmarshal(content, &channelsJSON); err != nil {
+		return nil, err
+	}
+
+	var output []Channel
+	for _, rec := range channelsJSON.Channels {
+
+		lastEntryId, err := rec.LastEntryId.Int64()
+		if err != nil {
+			lastEntryId = -1
+		}
+
+		tags := []ChannelTag{}
+		for _, tag := range rec.Tags {
+			tagId, _ := tag.Id.Int64()
+			tags = append(tags, ChannelTag{Id: tagId, Name: tag.Name})
+		}
+
+		output = append(output, Channel{
+			Id:          rec.Id.String(),
+			Name:        rec.Name,
+			Description: rec.Description,
+			Latitude:    rec.Latitude,
+			Longitude:   rec.Longitude,
+			CreatedAt:   rec.CreatedAt,
+			URL:         rec.URL,
+			Elevation:   rec.Elevation,
+			Ranking:     rec.Ranking,
+			PublicFlag:  rec.PublicFlag,
+			GithubURL:   rec.GithubURL,
+			Tags:        tags,
+			LastEntryId: lastEntryId,
+		})
+	}
+
+	return output, nil
+}
+
+/*--------------------------------*/
+
+func (ts *ThingSpeak) FetchFeed(ctx context.Context, channelId string, opts FeedOptions) (Feed, error) {
+
+	query := url.Values{}
+	query.Set("metadata", "true")
+	query.Set("location", "true")
+	query.Set("status", "true")
+	if opts.ApiKey != "" {
+		query.Set("api_key", opts.ApiKey)
+	}
+	if opts.Results > 0 {
+		query.Set("results", strconv.Itoa(opts.Results))
+	}
+	if !opts.Start.IsZero() {
+		query.Set("start", opts.Start.UTC().Format(thingSpeakTimeFormat))
+	}
+	if !opts.End.IsZero() {
+		query.Set("end", opts.End.UTC().Format(thingSpeakTimeFormat))
+	}
+
+	content, err := ts.get(ctx, fmt.Sprintf("channels/%s/feed.json", url.PathEscape(channelId)), query)
+	if err != nil {
+		return Feed{}, err
+	}
+
+	// ThingSpeak responds with `-1` for the channels that are deleted or private
+	if string(bytes.TrimSpace(content)) == "-1" {
+		return Feed{}, ErrChannelNotFound
+	}
+
+	var sensorFeedJSON struct {
+		Channel struct {
+			Id          json.Number `json:"id"`
+			Name        string      `json:"name"`
+			Description string      `json:"description"`
+			Latitude    string      `json:"latitude"`
+			Longitude   string      `json:"longitude"`
+			Elevation   string      `json:"elevation"`
+			CreatedAt   time.Time   `json:"created_at"`
+			LastEntryId json.Number `json:"last_entry_id"`
+			Metadata    string      `json:"metadata"`
+			Field1      string      `json:"field1"`
+			Field2      string      `json:"field2"`
+			Field3      string      `json:"field3"`
+			Field4      string      `json:"field4"`
+			Field5      string      `json:"field5"`
+			Field6      string      `json:"field6"`
+			Field7      string      `json:"field7"`
+			Field8      string      `json:"field8"`
+		} `json:"channel"`
+		Feeds []struct {
+			EntryId   json.Number `json:"entry_id"`
+			CreatedAt time.Time   `json:"created_at"`
+			Field1    string      `json:"field1"`
+			Field2    string      `json:"field2"`
+			Field3    string      `json:"field3"`
+			Field4    string      `json:"field4"`
+			Field5    string      `json:"field5"`
+			Field6    string      `json:"field6"`
+			Field7    string      `json:"field7"`
+			Field8    string      `json:"field8"`
+			Latitude  string      `json:"latitude"`
+			Longitude string      `json:"longitude"`
+			Elevation string      `json:"elevation"`
+			Status    string      `json:"status"`
+		} `json:"feeds"`
+	}
+
+	if err := json.Unmarshal(content, &sensorFeedJSON); err != nil {
+		return Feed{}, err
+	}
+
+	ch := &sensorFeedJSON.Channel
+	lastEntryId, _ := ch.LastEntryId.Int64()
+
+	output := Feed{
+		ChannelId:   ch.Id.String(),
+		LastEntryId: lastEntryId,
+		Channel: Channel{
+			Id:          ch.Id.String(),
+			Name:        ch.Name,
+			Description: ch.Description,
+			Latitude:    ch.Latitude,
+			Longitude:   ch.Longitude,
+			Elevation:   ch.Elevation,
+			CreatedAt:   ch.CreatedAt,
+			LastEntryId: lastEntryId,
+		},
+		Metadata: ch.Metadata,
+		Fields:   []string{ch.Field1, ch.Field2, ch.Field3, ch.Field4, ch.Field5, ch.Field6, ch.Field7, ch.Field8},
+	}
+
+	for _, rec := range sensorFeedJSON.Feeds {
+
+		entryId, err := rec.EntryId.Int64()
+		if err != nil || entryId <= opts.AfterEntryId {
+			continue
+		}
+
+		// The API already applies the range, but the recorded fixtures do not
+		if (!opts.Start.IsZero() && rec.CreatedAt.Before(opts.Start)) || (!opts.End.IsZero() && rec.CreatedAt.After(opts.End)) {
+			continue
+		}
+
+		output.Entries = append(output.Entries, FeedEntry{
+			EntryId:   entryId,
+			CreatedAt: rec.CreatedAt,
+			Values:    []string{rec.Field1, rec.Field2, rec.Field3, rec.Field4, rec.Field5, rec.Field6, rec.Field7, rec.Field8},
+			Latitude:  ParseCoordinate(rec.Latitude, 90),
+			Longitude: ParseCoordinate(rec.Longitude, 180),
+			Elevation: ParseCoordinate(rec.Elevation, 100000),
+			Status:    strings.TrimSpace(rec.Status),
+		})
+	}
+
+	// Same here, the API returns the latest entries of the range
+	if opts.Results > 0 && len(output.Entries) > opts.Results {
+		output.Entries = output.Entries[len(output.Entries)-opts.Results:]
+	}
+
+	return output, nil
+}
+
+/*--------------------------------*/
+
+// ParseCoordinate returns the number of a location attribute of an entry,
+// nil if it is empty, not a number or out of the [-limit, limit] range
+func ParseCoordinate(value string, limit float64) *float64 {
+
+	num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(num) || num < -limit || num > limit {
+		return nil
+	}
+	return &num
+}
+
+/*--------------------------------*/
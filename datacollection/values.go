@@ -0,0 +1,89 @@
+package datacollection
+
+import (
+	"log"
+	"math"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+)
+
+/*--------------------------------*/
+
+// The types of the values of a sensor, stored in `sensors.value_type`
+const (
+	ValueNumeric = "numeric"
+	ValueBoolean = "boolean" // stored as 1 and 0 in `value_num`
+	ValueText    = "text"
+)
+
+// A sensor is numeric (or boolean) if at least this share of its values are
+const valueTypeThreshold = 0.9
+
+/*--------------------------------*/
+
+// parseValue returns the number of a raw value to be stored in `value_num` (nil if it is not a number)
+// and the type of the value, empty for empty values
+func parseValue(value string) (interface{}, string) {
+
+	if value == "" {
+		return nil, ""
+	}
+
+	switch strings.ToLower(value) {
+	case "true":
+		return float64(1), ValueBoolean
+	case "false":
+		return float64(0), ValueBoolean
+	}
+
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+		return nil, ValueText
+	}
+	return num, ValueNumeric
+}
+
+/*--------------------------------*/
+
+// valueTypeCounter infers the type of a sensor from its values
+type valueTypeCounter map[string]int
+
+func (counter valueTypeCounter) ValueType() string {
+
+	total := counter[ValueNumeric] + counter[ValueBoolean] + counter[ValueText]
+	if total == 0 {
+		return ""
+	}
+
+	if float64(counter[ValueBoolean]) >= valueTypeThreshold*float64(total) {
+		return ValueBoolean
+	}
+	if float64(counter[ValueNumeric]+counter[ValueBoolean]) >= valueTypeThreshold*float64(total) {
+		return ValueNumeric
+	}
+	return ValueText
+}
+
+/*--------------------------------*/
+
+// setSensorValueTypes stores the inferred types of the sensors that do not have one yet
+func setSensorValueTypes(counters map[int64]valueTypeCounter) {
+
+	for sensorId, counter := range counters {
+
+		valueType := counter.ValueType()
+		if valueType == "" {
+			continue
+		}
+
+		SQL := `UPDATE "sensors" SET "value_type" = $1 WHERE "id" = $2 AND "value_type" IS NULL`
+		_, err := global.DB.Exec(SQL, database.QueryParams{valueType, sensorId})
+		if err != nil {
+			log.Printf("\nError in sensor type update: %v", err)
+		}
+	}
+}
+
+/*--------------------------------*/
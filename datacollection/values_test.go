@@ -0,0 +1,74 @@
+package datacollection
+
+import (
+	"strings"
+	"testing"
+)
+
+/*--------------------------------*/
+
+func TestParseValue(t *testing.T) {
+
+	tests := []struct {
+		value    string
+		wantNum  interface{}
+		wantType string
+	}{
+		{"", nil, ""},
+		{"21.5", 21.5, ValueNumeric},
+		{"-3", float64(-3), ValueNumeric},
+		{"1e3", float64(1000), ValueNumeric},
+		{"true", float64(1), ValueBoolean},
+		{"FALSE", float64(0), ValueBoolean},
+		{"offline", nil, ValueText},
+		{"20,5", nil, ValueText}, // Decimal commas are converted by the importers
+		{"NaN", nil, ValueText},
+		{"Inf", nil, ValueText},
+		{" 1", nil, ValueText},
+	}
+
+	for _, test := range tests {
+		num, valueType := parseValue(test.value)
+		if num != test.wantNum || valueType != test.wantType {
+			t.Errorf("parseValue(%q) = %v, %q, want %v, %q", test.value, num, valueType, test.wantNum, test.wantType)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestValueType(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		values string // comma separated raw values of a sensor
+		want   string
+	}{
+		{"no values", "", ""},
+		{"only empty values", ",,", ""},
+		{"numbers", "1,2.5,-3", ValueNumeric},
+		{"booleans", "true,false,True", ValueBoolean},
+		{"text", "on,off,on", ValueText},
+		{"numbers and booleans", "1,0,true,false", ValueNumeric},
+		{"a few errors in numbers", "1,2,3,4,5,6,7,8,9,error", ValueNumeric},
+		{"too many errors in numbers", "1,2,3,4,5,6,7,8,error,error", ValueText},
+		{"a number in booleans", "true,true,true,true,true,true,true,true,true,2", ValueBoolean},
+		{"empty values are not counted", "1,,2,,,3", ValueNumeric},
+	}
+
+	for _, test := range tests {
+
+		counter := make(valueTypeCounter)
+		for _, value := range strings.Split(test.values, ",") {
+			if _, valueType := parseValue(value); valueType != "" {
+				counter[valueType]++
+			}
+		}
+
+		if got := counter.ValueType(); got != test.want {
+			t.Errorf("%v: ValueType() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
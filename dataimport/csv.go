@@ -0,0 +1,421 @@
+package dataimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
+	"sensor-data-simulator/global"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // The time zones work without the database of the system, e.g. in the alpine image
+	"unicode/utf8"
+)
+
+/*--------------------------------*/
+
+// The CSV files are ThingSpeak exports (`created_at,entry_id,field1,...,field8,latitude,longitude,elevation,status`)
+// or any time series with a timestamp column and one column per sensor
+
+// ImportSource is the source of the imported channels, they are never fetched
+const ImportSource = "import"
+
+const maxSensorColumns = 100
+
+var (
+	ErrInvalidFile     = errors.New("invalid file")
+	ErrChannelNotFound = errors.New("the channel does not exist or it is not an imported channel")
+	ErrNoTimeColumn    = errors.New("no timestamp column found, set the time column")
+	ErrNoSensorColumn  = errors.New("no sensor column found")
+)
+
+/*--------------------------------*/
+
+// Column maps a column of the file to a sensor
+type Column struct {
+	Name   string // the header of the column
+	Sensor string // the name of the sensor, the header if empty
+}
+
+// Options of an import, the zero values are guessed from the file
+type Options struct {
+	ChannelId   int64  // an imported channel to add the entries to, 0 for a new channel
+	ChannelName string // the name of the new channel
+	Description string
+	OwnerId     int64 // the new channel is private to this user, 0 for a public channel
+	UserId      int64 // the user who imports the file, who can add entries to the new channel later
+
+	Delimiter     rune     // `,`, `;` or a tab if not set
+	TimeColumn    string   // `created_at`, `timestamp`, `time`, `date` or `datetime` if not set
+	TimeFormat    string   // a Go layout (e.g. `02/01/2006 15:04`), `unix` or `unix_ms`, the usual formats if not set
+	TimeZone      string   // of the timestamps without a zone, UTC if not set
+	EntryIdColumn string   // `entry_id` if not set, the entries are numbered after the last one of the channel if there is none
+	Columns       []Column // the columns to import as sensors, all the other columns if not set
+}
+
+// ParseColumns reads a column mapping like `field1:Temperature,field2:Humidity,rain`
+func ParseColumns(spec string) []Column {
+
+	var output []Column
+	for _, part := range strings.Split(spec, ",") {
+
+		name, sensor := part, ""
+		if i := strings.Index(part, ":"); i >= 0 {
+			name, sensor = part[:i], part[i+1:]
+		}
+
+		name = strings.TrimSpace(name)
+		if name != "" {
+			output = append(output, Column{Name: name, Sensor: strings.TrimSpace(sensor)})
+		}
+	}
+	return output
+}
+
+/*--------------------------------*/
+
+type Result struct {
+	ChannelId   int64 `json:"channel_id"`
+	Entries     int   `json:"entries"`
+	NewValues   int64 `json:"new_values"`
+	NewSensors  int64 `json:"new_sensors"`
+	SkippedRows int   `json:"skipped_rows"` // the rows without a valid timestamp
+}
+
+// ImportCSV parses a CSV file and stores its entries in a new channel, or in an imported channel, like the collector does
+func ImportCSV(r io.Reader, opts Options) (Result, error) {
+
+	result := Result{ChannelId: opts.ChannelId}
+
+	lastEntryId := int64(0)
+	if opts.ChannelId != 0 {
+
+		channels, err := global.DB.Load("channels", database.RowType{"id": opts.ChannelId, "source": ImportSource})
+		if err != nil {
+			return result, err
+		}
+		if len(channels) == 0 {
+			return result, ErrChannelNotFound
+		}
+		lastEntryId, _ = channels[0]["last_entry_id"].(int64)
+	}
+
+	feed, skipped, err := parseCSV(r, opts, lastEntryId)
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	result.Entries = len(feed.Entries)
+	result.SkippedRows = skipped
+
+	/*---------*/
+
+	if opts.ChannelId != 0 {
+		result.NewValues, result.NewSensors, err = datacollection.StoreImportedFeed(opts.ChannelId, feed)
+		return result, err
+	}
+
+	rows, err := global.DB.Query(`SELECT nextval('imported_channels_id_seq') AS "id"`, database.QueryParams{})
+	if err != nil {
+		return result, err
+	}
+	result.ChannelId = -rows[0]["id"].(int64)
+
+	name := strings.TrimSpace(opts.ChannelName)
+	if name == "" {
+		name = fmt.Sprintf("Imported channel %d", -result.ChannelId)
+	}
+
+	rec := datacollection.Channel{
+		Id:          strconv.FormatInt(result.ChannelId, 10),
+		Name:        truncate(name, 255),
+		Description: truncate(opts.Description, 400),
+		Latitude:    "0",
+		Longitude:   "0",
+		CreatedAt:   time.Now().UTC(),
+		LastEntryId: feed.LastEntryId,
+	}
+
+	// The channel is where its first entry with a location is
+	for _, entry := range feed.Entries {
+		if entry.Latitude != nil && entry.Longitude != nil {
+			rec.Latitude = strconv.FormatFloat(*entry.Latitude, 'f', -1, 64)
+			rec.Longitude = strconv.FormatFloat(*entry.Longitude, 'f', -1, 64)
+			break
+		}
+	}
+
+	feed.ChannelId = rec.Id
+	result.NewValues, result.NewSensors, err = datacollection.ImportChannel(rec, ImportSource, opts.OwnerId, opts.UserId, feed)
+	return result, err
+}
+
+/*--------------------------------*/
+
+// The layouts tried on the timestamps when no format is given, the ThingSpeak exports first
+var timeLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+}
+
+var decimalCommaPattern = regexp.MustCompile(`^[-+]?\d+,\d+$`)
+
+var timeColumnNames = []string{"created_at", "timestamp", "time", "date", "datetime"}
+
+// The columns of the ThingSpeak exports that are not sensors
+var locationColumnNames = []string{"latitude", "longitude", "elevation", "status"}
+
+// parseCSV reads the entries of a file, numbered after afterEntryId if the file has no entry ids.
+// It returns the number of skipped rows too
+func parseCSV(r io.Reader, opts Options, afterEntryId int64) (datacollection.Feed, int, error) {
+
+	feed := datacollection.Feed{}
+
+	reader := bufio.NewReader(r)
+	if opts.Delimiter == 0 {
+		head, _ := reader.Peek(4096)
+		opts.Delimiter = guessDelimiter(head)
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = opts.Delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return feed, 0, fmt.Errorf("could not read the header: %v", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF") // The byte order mark of Excel
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		header[i] = name
+		if _, exists := index[strings.ToLower(name)]; !exists {
+			index[strings.ToLower(name)] = i
+		}
+	}
+
+	/*---------*/
+
+	timeIdx := -1
+	if opts.TimeColumn != "" {
+		if i, ok := index[strings.ToLower(opts.TimeColumn)]; ok {
+			timeIdx = i
+		}
+	} else {
+		for _, name := range timeColumnNames {
+			if i, ok := index[name]; ok {
+				timeIdx = i
+				break
+			}
+		}
+	}
+	if timeIdx < 0 {
+		return feed, 0, ErrNoTimeColumn
+	}
+
+	entryIdName := strings.ToLower(opts.EntryIdColumn)
+	if entryIdName == "" {
+		entryIdName = "entry_id"
+	}
+	entryIdIdx, hasEntryIds := index[entryIdName]
+
+	locationIdx := make(map[string]int)
+	for _, name := range locationColumnNames {
+		if i, ok := index[name]; ok {
+			locationIdx[name] = i
+		}
+	}
+
+	/*---------*/
+
+	var columns []int
+	if len(opts.Columns) > 0 {
+		for _, c := range opts.Columns {
+			i, ok := index[strings.ToLower(c.Name)]
+			if !ok {
+				return feed, 0, fmt.Errorf("column `%v` not found", c.Name)
+			}
+			sensor := c.Sensor
+			if sensor == "" {
+				sensor = header[i]
+			}
+			columns = append(columns, i)
+			feed.Fields = append(feed.Fields, truncate(sensor, 255))
+		}
+	} else {
+		for i, name := range header {
+			_, isLocation := locationIdx[strings.ToLower(name)]
+			if i == timeIdx || (hasEntryIds && i == entryIdIdx) || isLocation || name == "" {
+				continue
+			}
+			columns = append(columns, i)
+			feed.Fields = append(feed.Fields, truncate(name, 255))
+		}
+	}
+	if len(columns) == 0 {
+		return feed, 0, ErrNoSensorColumn
+	}
+	if len(columns) > maxSensorColumns {
+		return feed, 0, fmt.Errorf("too many sensor columns (%d), the most is %d", len(columns), maxSensorColumns)
+	}
+
+	location := time.UTC
+	if opts.TimeZone != "" {
+		location, err = time.LoadLocation(opts.TimeZone)
+		if err != nil {
+			return feed, 0, fmt.Errorf("invalid time zone: %v", err)
+		}
+	}
+
+	/*---------*/
+
+	skipped := 0
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return feed, skipped, err
+		}
+
+		cell := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		createdAt, err := parseTime(cell(timeIdx), opts.TimeFormat, location)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		entry := datacollection.FeedEntry{CreatedAt: createdAt.UTC()}
+		if hasEntryIds {
+			entry.EntryId, err = strconv.ParseInt(cell(entryIdIdx), 10, 64)
+			if err != nil || entry.EntryId <= 0 {
+				skipped++
+				continue
+			}
+		}
+
+		for _, i := range columns {
+			value := cell(i)
+			if opts.Delimiter != ',' && decimalCommaPattern.MatchString(value) {
+				value = strings.Replace(value, ",", ".", 1) // e.g. `20,5` in the European files
+			}
+			entry.Values = append(entry.Values, value)
+		}
+
+		if i, ok := locationIdx["latitude"]; ok {
+			entry.Latitude = datacollection.ParseCoordinate(cell(i), 90)
+		}
+		if i, ok := locationIdx["longitude"]; ok {
+			entry.Longitude = datacollection.ParseCoordinate(cell(i), 180)
+		}
+		if i, ok := locationIdx["elevation"]; ok {
+			entry.Elevation = datacollection.ParseCoordinate(cell(i), 100000)
+		}
+		if i, ok := locationIdx["status"]; ok {
+			entry.Status = cell(i)
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	/*---------*/
+
+	if hasEntryIds {
+		sort.SliceStable(feed.Entries, func(i, j int) bool { return feed.Entries[i].EntryId < feed.Entries[j].EntryId })
+	} else {
+		sort.SliceStable(feed.Entries, func(i, j int) bool { return feed.Entries[i].CreatedAt.Before(feed.Entries[j].CreatedAt) })
+		for i := range feed.Entries {
+			feed.Entries[i].EntryId = afterEntryId + int64(i) + 1
+		}
+	}
+
+	feed.LastEntryId = afterEntryId
+	if len(feed.Entries) > 0 && feed.Entries[len(feed.Entries)-1].EntryId > afterEntryId {
+		feed.LastEntryId = feed.Entries[len(feed.Entries)-1].EntryId
+	}
+
+	return feed, skipped, nil
+}
+
+/*--------------------------------*/
+
+// guessDelimiter picks the most used delimiter of the first line
+func guessDelimiter(head []byte) rune {
+
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	}
+
+	output, most := ',', 0
+	for _, d := range []rune{',', ';', '\t'} {
+		if n := bytes.Count(head, []byte(string(d))); n > most {
+			output, most = d, n
+		}
+	}
+	return output
+}
+
+/*--------------------------------*/
+
+func parseTime(value string, format string, location *time.Location) (time.Time, error) {
+
+	switch format {
+	case "unix", "unix_ms":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == "unix_ms" {
+			return time.Unix(0, int64(n*1e6)), nil
+		}
+		return time.Unix(0, int64(n*1e9)), nil
+
+	case "":
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, value, location); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unknown time format: %v", value)
+	}
+
+	return time.ParseInLocation(format, value, location)
+}
+
+/*--------------------------------*/
+
+func truncate(value string, length int) string {
+
+	if utf8.RuneCountInString(value) > length {
+		return string([]rune(value)[:length])
+	}
+	return value
+}
+
+/*--------------------------------*/
@@ -0,0 +1,299 @@
+package dataimport
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*--------------------------------*/
+
+func TestParseCSV(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		csv          string
+		opts         Options
+		afterEntryId int64
+
+		wantErr     error // Only checked with errors.Is, any error if errAny
+		errAny      bool
+		wantFields  []string
+		wantIds     []int64
+		wantTimes   []string // RFC 3339 in UTC
+		wantValues  [][]string
+		wantSkipped int
+		wantLast    int64
+	}{
+		{
+			name: "thingspeak export",
+			csv: "created_at,entry_id,field1,field2,latitude,longitude,elevation,status\n" +
+				"2021-06-10 11:21:20 UTC,2,21.5,40,52.5,13.4,34,ok\n" +
+				"2021-06-10 11:20:20 UTC,1,21.0,41,,,,\n",
+			wantFields: []string{"field1", "field2"},
+			wantIds:    []int64{1, 2},
+			wantTimes:  []string{"2021-06-10T11:20:20Z", "2021-06-10T11:21:20Z"},
+			wantValues: [][]string{{"21.0", "41"}, {"21.5", "40"}},
+			wantLast:   2,
+		},
+		{
+			name:         "numbered after the last entry, in time order",
+			csv:          "timestamp,temperature\n2021-06-10T12:00:00Z,2\n2021-06-10T11:00:00Z,1\n",
+			afterEntryId: 10,
+			wantFields:   []string{"temperature"},
+			wantIds:      []int64{11, 12},
+			wantTimes:    []string{"2021-06-10T11:00:00Z", "2021-06-10T12:00:00Z"},
+			wantValues:   [][]string{{"1"}, {"2"}},
+			wantLast:     12,
+		},
+		{
+			name:       "header case, spaces and byte order mark",
+			csv:        "\uFEFFTime , Temp\n2021-06-10 11:00, 20\n",
+			wantFields: []string{"Temp"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:00:00Z"},
+			wantValues: [][]string{{"20"}},
+			wantLast:   1,
+		},
+		{
+			name:       "column mapping",
+			csv:        "date,field1,field2,field3\n2021-06-10,1,2,3\n",
+			opts:       Options{Columns: ParseColumns("field3:Rain, field1")},
+			wantFields: []string{"Rain", "field1"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T00:00:00Z"},
+			wantValues: [][]string{{"3", "1"}},
+			wantLast:   1,
+		},
+		{
+			name:       "semicolons and decimal commas",
+			csv:        "datetime;temperature;label\n2021-06-10 11:00:00;20,5;a,b\n",
+			wantFields: []string{"temperature", "label"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:00:00Z"},
+			wantValues: [][]string{{"20.5", "a,b"}},
+			wantLast:   1,
+		},
+		{
+			name:       "decimal commas are kept with the comma delimiter",
+			csv:        "time,value\n2021-06-10 11:00:00,\"20,5\"\n",
+			wantFields: []string{"value"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:00:00Z"},
+			wantValues: [][]string{{"20,5"}},
+			wantLast:   1,
+		},
+		{
+			name: "mixed value types",
+			csv: "time,value\n" +
+				"2021-06-10 11:00:00,20.5\n" +
+				"2021-06-10 11:01:00,true\n" +
+				"2021-06-10 11:02:00,offline\n" +
+				"2021-06-10 11:03:00,\n",
+			wantFields: []string{"value"},
+			wantIds:    []int64{1, 2, 3, 4},
+			wantTimes:  []string{"2021-06-10T11:00:00Z", "2021-06-10T11:01:00Z", "2021-06-10T11:02:00Z", "2021-06-10T11:03:00Z"},
+			wantValues: [][]string{{"20.5"}, {"true"}, {"offline"}, {""}},
+			wantLast:   4,
+		},
+		{
+			name:       "time zone of the timestamps without a zone",
+			csv:        "time,value\n2021-01-10 12:00:00,1\n2021-01-10T12:00:00+03:00,2\n",
+			opts:       Options{TimeZone: "Europe/Berlin"},
+			wantFields: []string{"value"},
+			wantIds:    []int64{1, 2},
+			wantTimes:  []string{"2021-01-10T09:00:00Z", "2021-01-10T11:00:00Z"},
+			wantValues: [][]string{{"2"}, {"1"}},
+			wantLast:   2,
+		},
+		{
+			name:       "custom time column and format",
+			csv:        "when,value\n10/06/2021 11:00,1\n",
+			opts:       Options{TimeColumn: "WHEN", TimeFormat: "02/01/2006 15:04"},
+			wantFields: []string{"value"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:00:00Z"},
+			wantValues: [][]string{{"1"}},
+			wantLast:   1,
+		},
+		{
+			name:       "unix time",
+			csv:        "time,value\n1623324000,1\n",
+			opts:       Options{TimeFormat: "unix"},
+			wantFields: []string{"value"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:20:00Z"},
+			wantValues: [][]string{{"1"}},
+			wantLast:   1,
+		},
+		{
+			name:       "unix time in milliseconds",
+			csv:        "time,value\n1623324000500,1\n",
+			opts:       Options{TimeFormat: "unix_ms"},
+			wantFields: []string{"value"},
+			wantIds:    []int64{1},
+			wantTimes:  []string{"2021-06-10T11:20:00.5Z"},
+			wantValues: [][]string{{"1"}},
+			wantLast:   1,
+		},
+
+		// Malformed rows
+		{
+			name: "rows without a valid timestamp or entry id are skipped",
+			csv: "created_at,entry_id,field1\n" +
+				"yesterday,1,1\n" +
+				"2021-06-10 11:00:00 UTC,x,2\n" +
+				"2021-06-10 11:00:00 UTC,0,3\n" +
+				",4,4\n" +
+				"2021-06-10 11:00:00 UTC,5,5\n",
+			wantFields:  []string{"field1"},
+			wantIds:     []int64{5},
+			wantTimes:   []string{"2021-06-10T11:00:00Z"},
+			wantValues:  [][]string{{"5"}},
+			wantSkipped: 4,
+			wantLast:    5,
+		},
+		{
+			name:       "short and long rows",
+			csv:        "time,a,b\n2021-06-10 11:00:00,1\n2021-06-10 11:01:00,1,2,3\n",
+			wantFields: []string{"a", "b"},
+			wantIds:    []int64{1, 2},
+			wantTimes:  []string{"2021-06-10T11:00:00Z", "2021-06-10T11:01:00Z"},
+			wantValues: [][]string{{"1", ""}, {"1", "2"}},
+			wantLast:   2,
+		},
+		{
+			name:     "no rows",
+			csv:      "time,value\n",
+			wantLast: 7, afterEntryId: 7,
+			wantFields: []string{"value"},
+		},
+		{
+			name:         "entry ids before the last entry keep the cursor",
+			csv:          "created_at,entry_id,field1\n2021-06-10 11:00:00 UTC,3,1\n",
+			wantFields:   []string{"field1"},
+			wantIds:      []int64{3},
+			wantTimes:    []string{"2021-06-10T11:00:00Z"},
+			wantValues:   [][]string{{"1"}},
+			afterEntryId: 10,
+			wantLast:     10,
+		},
+
+		// Missing columns and invalid options
+		{name: "empty file", csv: "", errAny: true},
+		{name: "no time column", csv: "value,other\n1,2\n", wantErr: ErrNoTimeColumn},
+		{name: "missing time column", csv: "time,value\n", opts: Options{TimeColumn: "created"}, wantErr: ErrNoTimeColumn},
+		{name: "no sensor column", csv: "created_at,entry_id,latitude\n", wantErr: ErrNoSensorColumn},
+		{name: "missing mapped column", csv: "time,value\n", opts: Options{Columns: ParseColumns("field1")}, errAny: true},
+		{name: "invalid time zone", csv: "time,value\n", opts: Options{TimeZone: "Mars/Olympus"}, errAny: true},
+		{name: "too many columns", csv: "time," + strings.Repeat("c,", maxSensorColumns) + "c\n", errAny: true},
+	}
+
+	for _, test := range tests {
+
+		feed, skipped, err := parseCSV(strings.NewReader(test.csv), test.opts, test.afterEntryId)
+
+		if test.wantErr != nil || test.errAny {
+			if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("%v: error = %v, want %v", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		var ids []int64
+		var times []string
+		var values [][]string
+		for _, entry := range feed.Entries {
+			ids = append(ids, entry.EntryId)
+			times = append(times, entry.CreatedAt.Format(time.RFC3339Nano))
+			values = append(values, entry.Values)
+		}
+
+		if !reflect.DeepEqual(feed.Fields, test.wantFields) {
+			t.Errorf("%v: fields = %q, want %q", test.name, feed.Fields, test.wantFields)
+		}
+		if !reflect.DeepEqual(ids, test.wantIds) {
+			t.Errorf("%v: entry ids = %v, want %v", test.name, ids, test.wantIds)
+		}
+		if !reflect.DeepEqual(times, test.wantTimes) {
+			t.Errorf("%v: times = %v, want %v", test.name, times, test.wantTimes)
+		}
+		if !reflect.DeepEqual(values, test.wantValues) {
+			t.Errorf("%v: values = %q, want %q", test.name, values, test.wantValues)
+		}
+		if skipped != test.wantSkipped {
+			t.Errorf("%v: skipped = %v, want %v", test.name, skipped, test.wantSkipped)
+		}
+		if feed.LastEntryId != test.wantLast {
+			t.Errorf("%v: last entry id = %v, want %v", test.name, feed.LastEntryId, test.wantLast)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestParseCSVLocation(t *testing.T) {
+
+	csv := "created_at,entry_id,field1,latitude,longitude,elevation,status\n" +
+		"2021-06-10 11:00:00 UTC,1,1,52.5,13.4,34,moving\n" +
+		"2021-06-10 11:01:00 UTC,2,1,95,13.4,x,\n"
+
+	feed, _, err := parseCSV(strings.NewReader(csv), Options{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("entries = %v, want 2", len(feed.Entries))
+	}
+
+	first, second := feed.Entries[0], feed.Entries[1]
+	if first.Latitude == nil || *first.Latitude != 52.5 || first.Longitude == nil || *first.Longitude != 13.4 ||
+		first.Elevation == nil || *first.Elevation != 34 || first.Status != "moving" {
+		t.Errorf("first entry location = %v, %v, %v, %q", first.Latitude, first.Longitude, first.Elevation, first.Status)
+	}
+	if second.Latitude != nil || second.Longitude == nil || second.Elevation != nil || second.Status != "" {
+		t.Errorf("second entry location = %v, %v, %v, %q, want an invalid latitude and elevation", second.Latitude, second.Longitude, second.Elevation, second.Status)
+	}
+}
+
+/*--------------------------------*/
+
+func TestGuessDelimiter(t *testing.T) {
+
+	tests := []struct {
+		head string
+		want rune
+	}{
+		{"time,value,other\n1;2;3;4;5", ','},
+		{"time;value;other\n", ';'},
+		{"time\tvalue\n", '\t'},
+		{"time", ','},
+		{"", ','},
+	}
+
+	for _, test := range tests {
+		if got := guessDelimiter([]byte(test.head)); got != test.want {
+			t.Errorf("guessDelimiter(%q) = %q, want %q", test.head, got, test.want)
+		}
+	}
+}
+
+/*--------------------------------*/
+
+func TestParseColumns(t *testing.T) {
+
+	got := ParseColumns(" field1:Temperature ,field2: Humidity,rain,, :x")
+	want := []Column{{"field1", "Temperature"}, {"field2", "Humidity"}, {"rain", ""}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseColumns = %v, want %v", got, want)
+	}
+}
+
+/*--------------------------------*/
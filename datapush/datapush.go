@@ -1,141 +1,254 @@
 package datapush
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"log"
-	"net/http"
-	"sensor-data-simulator/api"
 	"sensor-data-simulator/database"
 	"sensor-data-simulator/global"
-	"strconv"
 	"time"
 )
 
-func Init() {
+// The catch-up policies of the push settings, what a setting pushes when several values are waiting
+const (
+	CatchUpLatest = "latest" // Only the latest values, the older ones are skipped
+	CatchUpBatch  = "batch"  // The next `batch_size` values, one value by default
+	CatchUpAll    = "all"    // All the values, `batch_size` at a time
+)
+
+// The most values sent at once
+const maxBatchSize = 1000
+
+// The database calls of a push, replaced in the tests
+var (
+	nextValuesToPush   = GetTheNextValuesToPush
+	latestValuesToPush = GetTheLatestValuesToPush
+	countValuesToPush  = CountValuesToPush
+	updateLastEntry    = UpdatePushSettingLastEntry
+	restartLoop        = startLoop
+)
+
+/*--------------*/
+
+// pushSetting pushes the next value of a push setting, if there is one.
+// The setting is loaded again before each push, so the changes made in the meantime apply right away
+func pushSetting(ctx context.Context, settingId int64) {
 
-	// These intervals are the only ones that we support for data push and take care of
-	pushIntervalsInMinutes := []int{
-		1,
-		3,
-		5,
-		10,
-		30,
-		60,
-		2 * 60,
-		3 * 60,
-		5 * 60,
-		24 * 60,
-		2 * 24 * 60,
-		3 * 24 * 60,
+	SQL := `SELECT p.*, u."token"
+			FROM
+				"push_settings" AS p,
+				"users" AS u
+			WHERE
+				p."id" = $1				AND
+				p."active" = true		AND
+				u."id" = p."user_id"`
+
+	pushRows, err := global.DB.Query(SQL, database.QueryParams{settingId})
+	if err != nil {
+		log.Printf("\nError in `push_settings` Load: %v \nSQL: \n%v\nsettingId: %v", err, SQL, settingId)
+		return
 	}
 
-	for _, intervalInMinutes := range pushIntervalsInMinutes {
-		go handlePushInterval(intervalInMinutes)
+	if len(pushRows) == 0 {
+		return // Deleted or deactivated since it was scheduled
 	}
+	pushRow := pushRows[0]
 
-}
+	/*---------*/
 
-/*--------------*/
+	if pushRow["last_pushed_entry_id"] == nil {
+		pushRow["last_pushed_entry_id"] = int64(0)
+	}
+
+	target, err := getPushTarget(pushRow)
+	if err != nil {
+		log.Printf("[PUSH ] Invalid target of the push setting `%v`: %v", pushRow["id"], err)
+		return
+	}
 
-func handlePushInterval(intervalInMinutes int) {
+	pushSettingValues(ctx, pushRow, target)
+}
 
-	for {
-		time.Sleep(time.Duration(intervalInMinutes) * time.Minute)
+// pushSettingValues pushes the values of a loaded push setting to its target, following its catch-up policy and its loop
+func pushSettingValues(ctx context.Context, pushRow database.RowType, target PushTarget) {
 
-		/*-------*/
+	var err error
 
-		SQL := `SELECT p.*, u."token" 
-				FROM 
-					"push_settings" AS p, 
-					"users" AS u 
-				WHERE 
-					p."active" = true		AND
-					u."id" = p."user_id"	AND 
-					"push_interval" = $1`
+	policy, _ := pushRow["catch_up_policy"].(string)
+	batchSize, _ := pushRow["batch_size"].(int64)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if batchSize > maxBatchSize {
+		batchSize = maxBatchSize
+	}
 
-		pushRows, err := global.DB.Query(SQL, database.QueryParams{intervalInMinutes})
+	sensorId := pushRow["sensor_id"].(int64)
+	lastPushedEntryId := pushRow["last_pushed_entry_id"].(int64)
+	skipFlagged, _ := pushRow["skip_flagged"].(bool)
+	useOriginalTime, _ := pushRow["use_original_time"].(bool)
+	pushLocation, _ := pushRow["push_location"].(bool)
+	interval := pushInterval(pushRow)
+
+	loop, _ := pushRow["loop"].(bool)
+	loopCount, _ := pushRow["loop_count"].(int64)
+	loopTimeShift, _ := pushRow["loop_time_shift"].(int64)
+	timeShift := time.Duration(loopTimeShift) * time.Second
+	looped := false
+
+	// Once a loop has started, it replays all the values in order, whatever the catch-up policy
+	inLoop := loop && loopCount > 0
+	pushedCount := 0
+
+	pushTime := time.Now().UTC()
+
+	// Without the original time, the values get the times they would have been pushed at,
+	// one interval apart up to now. With `all`, the values of the next batches come after the ones of this batch
+	remaining := int64(0)
+	if policy == CatchUpAll && !useOriginalTime {
+		remaining, err = countValuesToPush(sensorId, lastPushedEntryId, skipFlagged)
 		if err != nil {
-			log.Printf("\nError in `push_settings` Load: %v \nSQL: \n%v\nintervalInMinutes: %v", err, SQL, intervalInMinutes)
 			return
 		}
+	}
 
-		/*-------*/
-
-		for _, pushRow := range pushRows {
+	for {
 
-			/*---------*/
+		// A loop replays its values from the start, none of them are skipped
+		var sourceRows []database.RowType
+		if policy == CatchUpLatest && !inLoop {
+			sourceRows, err = latestValuesToPush(sensorId, lastPushedEntryId, skipFlagged, batchSize)
+		} else {
+			sourceRows, err = nextValuesToPush(sensorId, lastPushedEntryId, skipFlagged, batchSize)
+		}
+		if err != nil {
+			return
+		}
 
-			if pushRow["last_pushed_entry_id"] == nil {
-				pushRow["last_pushed_entry_id"] = int64(0)
+		// Out of values, a looping setting starts over. The values pushed in this push
+		// keep their times, so the next loop waits for the next push
+		if len(sourceRows) == 0 {
+			if !loop || looped || pushedCount > 0 {
+				return
 			}
+			looped = true
 
-			sourceSensorRow, err := GetTheNextValueToPush(pushRow["sensor_id"].(int64), pushRow["last_pushed_entry_id"].(int64))
-			if err != nil {
-				continue
+			started := false
+			lastPushedEntryId, timeShift, started, err = restartLoop(pushRow, lastPushedEntryId, timeShift, interval)
+			if err != nil || !started {
+				return
 			}
+			inLoop = true
 
-			if sourceSensorRow == nil {
-				// log.Printf("No new values to push. device: %v, sensor: %v", pushRow["target_device_id"], pushRow["target_sensor_id"])
-				continue
+			if policy == CatchUpAll && !useOriginalTime {
+				remaining, err = countValuesToPush(sensorId, lastPushedEntryId, skipFlagged)
+				if err != nil {
+					return
+				}
 			}
+			continue
+		}
+
+		if remaining < int64(len(sourceRows)) {
+			remaining = int64(len(sourceRows))
+		}
 
-			/*---------*/
+		/*---------*/
 
-			pushTime := time.Now()
-			value := sourceSensorRow["value"].(string)
+		pushValuesList := make([]PushValue, 0, len(sourceRows))
+		for _, sourceSensorRow := range sourceRows {
 
-			sensorTimestamp := pushTime
-			if pushRow["use_original_time"] != nil && pushRow["use_original_time"].(bool) {
-				sensorTimestamp = sourceSensorRow["created_at"].(time.Time)
+			// The numbers are pushed as numbers, everything else as the raw string
+			var value interface{} = sourceSensorRow["value"]
+			if sourceSensorRow["value_num"] != nil {
+				value = sourceSensorRow["value_num"]
 			}
 
-			statusCode, err := PushDataToWaziup(pushRow["token"].(string), pushRow["target_device_id"].(string), pushRow["target_sensor_id"].(string), value, sensorTimestamp)
-			if err != nil {
-				if statusCode == 403 { // The token is not valid anymore, let's refresh it
-					// log.Printf("[PUSH ] The token is expired for `%v` Renewing token", pushRow["user_id"])
-					newToken, err := RefreshWaziupToken(pushRow["user_id"].(int64))
-					if err != nil {
-						log.Printf("[PUSH ] Error in token acquisition: %v", err)
-						continue
-					}
-
-					// log.Printf("[PUSH ] New token acquired, pushing again...")
-
-					// Let's repeat the push process one more time
-					_, err = PushDataToWaziup(newToken, pushRow["target_device_id"].(string), pushRow["target_sensor_id"].(string), value, sensorTimestamp)
-					if err != nil {
-						log.Printf("[PUSH ] error in data push: `%v` \nUserId: %v", err, pushRow["user_id"])
-						continue
-					}
-
-				} else {
-					continue
+			remaining--
+			sensorTimestamp := pushTime.Add(-time.Duration(remaining) * interval)
+			if useOriginalTime {
+				sensorTimestamp = sourceSensorRow["created_at"].(time.Time).Add(timeShift)
+			}
+
+			pushValue := PushValue{
+				SettingId:      pushRow["id"].(int64),
+				UserId:         pushRow["user_id"].(int64),
+				SensorId:       sensorId,
+				TargetDeviceId: pushRow["target_device_id"].(string),
+				TargetSensorId: pushRow["target_sensor_id"].(string),
+				EntryId:        sourceSensorRow["entry_id"].(int64),
+				Value:          value,
+				Timestamp:      sensorTimestamp,
+			}
+
+			// The mobile channels move the target device along with the values
+			if pushLocation {
+				latitude, hasLatitude := sourceSensorRow["latitude"].(float64)
+				longitude, hasLongitude := sourceSensorRow["longitude"].(float64)
+				if hasLatitude && hasLongitude {
+					pushValue.Latitude = &latitude
+					pushValue.Longitude = &longitude
 				}
 			}
 
-			/*---------*/
+			pushValuesList = append(pushValuesList, pushValue)
+		}
+
+		pushed, err := pushValues(ctx, target, pushValuesList)
+
+		/*---------*/
+
+		// Update the push row:
+		pushedCount += pushed
+		if pushed > 0 {
+			lastPushedEntryId = pushValuesList[pushed-1].EntryId
+			updateLastEntry(pushRow["id"].(int64), lastPushedEntryId, pushTime, pushed)
+		}
 
-			// Update the push row:
-			UpdatePushSettingLastEntry(pushRow["id"].(int64), sourceSensorRow["entry_id"].(int64), pushTime)
+		if err != nil {
+			log.Printf("[PUSH ] error in data push: `%v` \nUserId: %v", err, pushRow["user_id"])
+			return
+		}
 
+		// Only `all` goes on with the next batch, until nothing is left
+		if policy != CatchUpAll || int64(len(sourceRows)) < batchSize || ctx.Err() != nil {
+			return
 		}
 	}
 }
 
 /*--------------*/
 
-func UpdatePushSettingLastEntry(id int64, lastPushedEntryId int64, lastPushTime time.Time) error {
+func UpdatePushSettingLastEntry(id int64, lastPushedEntryId int64, lastPushTime time.Time, pushedCount int) error {
 
 	SQL := `UPDATE "push_settings" 
 			SET 
 				"last_pushed_entry_id" = $1,
 				"last_push_time" = $2,
-				"pushed_count" = "pushed_count" + 1
+				"pushed_count" = "pushed_count" + $4
 			WHERE 
 				"id" = $3`
 
-	params := database.QueryParams{lastPushedEntryId, lastPushTime, id}
+	params := database.QueryParams{lastPushedEntryId, lastPushTime, id, pushedCount}
+	_, err := global.DB.Exec(SQL, params)
+	if err != nil {
+		log.Printf("\nError in updating `push_settings`: %v \nSQL: %v\nParams: %v", err, SQL, params)
+	}
+
+	return err
+}
+
+// RewindPushSetting takes back values that were counted as pushed but never reached their target,
+// the setting goes back to the given entry unless it is already before it
+func RewindPushSetting(id int64, lastPushedEntryId int64, unpushedCount int) error {
+
+	SQL := `UPDATE "push_settings" 
+			SET 
+				"last_pushed_entry_id" = LEAST("last_pushed_entry_id", $1),
+				"pushed_count" = GREATEST("pushed_count" - $2, 0)
+			WHERE 
+				"id" = $3`
+
+	params := database.QueryParams{lastPushedEntryId, unpushedCount, id}
 	_, err := global.DB.Exec(SQL, params)
 	if err != nil {
 		log.Printf("\nError in updating `push_settings`: %v \nSQL: %v\nParams: %v", err, SQL, params)
@@ -146,93 +259,165 @@ func UpdatePushSettingLastEntry(id int64, lastPushedEntryId int64, lastPushTime
 
 /*--------------*/
 
-func GetTheNextValueToPush(sensorId int64, lastPushedEntryId int64) (database.RowType, error) {
+// startLoop moves a looping setting back to the start of its loop: the configured entry or date, or the first entry.
+// The original times of the new loop are shifted to come one interval after the last pushed value, so the stream goes on
+func startLoop(pushRow database.RowType, lastPushedEntryId int64, timeShift time.Duration, interval time.Duration) (int64, time.Duration, bool, error) {
 
-	SQL := `SELECT * 
-			FROM "sensor_values" 
-			WHERE 
-				"sensor_id" = $1 AND 
-				"entry_id" > $2 
-			ORDER BY "entry_id" ASC 
-			LIMIT 1`
+	settingId := pushRow["id"].(int64)
+	sensorId := pushRow["sensor_id"].(int64)
+	skipFlagged, _ := pushRow["skip_flagged"].(bool)
+
+	startEntryId, err := loopStartEntryId(pushRow)
+	if err != nil {
+		return lastPushedEntryId, timeShift, false, err
+	}
+
+	// Nothing to loop over
+	firstRows, err := GetTheNextValuesToPush(sensorId, startEntryId-1, skipFlagged, 1)
+	if err != nil || len(firstRows) == 0 {
+		return lastPushedEntryId, timeShift, false, err
+	}
+
+	/*---------*/
+
+	SQL := `SELECT "created_at"
+			FROM "sensor_values"
+			WHERE
+				"sensor_id" = $1 AND
+				"entry_id" = $2`
 	params := database.QueryParams{sensorId, lastPushedEntryId}
-	rows, err := global.DB.Query(SQL, params)
+	lastRows, err := global.DB.Query(SQL, params)
 	if err != nil {
 		log.Printf("\nError in Query: %v \nSQL: \n%v\nParams: %v", err, SQL, params)
-		return nil, err
+		return lastPushedEntryId, timeShift, false, err
 	}
 
-	if rows == nil || len(rows) == 0 {
-		return nil, nil
+	if len(lastRows) > 0 {
+		lastPushedTime := lastRows[0]["created_at"].(time.Time).Add(timeShift)
+		timeShift = lastPushedTime.Add(interval).Sub(firstRows[0]["created_at"].(time.Time)).Round(time.Second)
 	}
 
-	return rows[0], nil
-}
+	/*---------*/
 
-/*--------------*/
+	SQL = `UPDATE "push_settings"
+			SET
+				"last_pushed_entry_id" = $1,
+				"loop_count" = "loop_count" + 1,
+				"loop_time_shift" = $2
+			WHERE
+				"id" = $3`
+	params = database.QueryParams{startEntryId - 1, int64(timeShift / time.Second), settingId}
+	if _, err := global.DB.Exec(SQL, params); err != nil {
+		log.Printf("\nError in updating `push_settings`: %v \nSQL: %v\nParams: %v", err, SQL, params)
+		return lastPushedEntryId, timeShift, false, err
+	}
 
-func PushDataToWaziup(token string, deviceId string, sensorId string, value string, timestamp time.Time) (int, error) {
+	log.Printf("[PUSH ] The push setting `%v` loops from the entry `%v` again", settingId, startEntryId)
 
-	apiPath := fmt.Sprintf(global.ENV.WAZIUP_API_PATH+`devices/%s/sensors/%s/value`, deviceId, sensorId)
+	return startEntryId - 1, timeShift, true, nil
+}
 
-	// Attempting to post number value if possible
+// loopStartEntryId returns the entry a looping setting starts over from
+func loopStartEntryId(pushRow database.RowType) (int64, error) {
 
-	var postBody []byte
-	floatValue, err := strconv.ParseFloat(value, 64)
-	if err == nil {
-		postBody = []byte(fmt.Sprintf(`{"value":%v, "timestamp": "%v"}`, floatValue, timestamp.Format(time.RFC3339)))
-	} else {
-		postBody = []byte(fmt.Sprintf(`{"value":"%s", "timestamp": "%v"}`, value, timestamp.Format(time.RFC3339)))
+	if startEntryId, ok := pushRow["loop_start_entry_id"].(int64); ok && startEntryId > 0 {
+		return startEntryId, nil
 	}
 
-	/*--------*/
-
-	req, err := http.NewRequest("POST", apiPath, bytes.NewBuffer(postBody))
-	if err != nil {
-		log.Printf("[PUSH ] could not make the request: %v", err)
-		return 0, err
+	startTime, ok := pushRow["loop_start_time"].(time.Time)
+	if !ok {
+		return 1, nil
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
-	resp, err := http.DefaultClient.Do(req)
+	// The first entry if nothing comes after the date
+	SQL := `SELECT COALESCE(MIN("entry_id"), 1) AS "entry_id"
+			FROM "sensor_values"
+			WHERE
+				"sensor_id" = $1 AND
+				"created_at" >= $2`
+	params := database.QueryParams{pushRow["sensor_id"], startTime}
+	rows, err := global.DB.Query(SQL, params)
 	if err != nil {
-		log.Printf("[PUSH ] did not receive a response from Waziup Server: %v", err)
+		log.Printf("\nError in Query: %v \nSQL: \n%v\nParams: %v", err, SQL, params)
 		return 0, err
 	}
 
-	if resp.StatusCode != 204 {
-		err := fmt.Errorf("waziup api error (%v): %v \n\tAPI path: %v", resp.StatusCode, resp.Status, apiPath)
-		// log.Printf("[PUSH ] Waziup API Error: %v \nAPI path: %v", err, apiPath)
-		return resp.StatusCode, err
-	}
-
-	return resp.StatusCode, nil
+	return rows[0]["entry_id"].(int64), nil
 }
 
 /*--------------*/
 
-func RefreshWaziupToken(userId int64) (string, error) {
+// GetTheNextValuesToPush returns at most `limit` values that come after the last pushed one, the oldest first.
+// With skipFlagged, only the values that are checked and have no quality issue are returned
+func GetTheNextValuesToPush(sensorId int64, lastPushedEntryId int64, skipFlagged bool, limit int64) ([]database.RowType, error) {
+	return getValuesToPush(sensorId, lastPushedEntryId, skipFlagged, limit, false)
+}
 
-	user, err := api.GetUserById(userId)
-	if err != nil {
-		return "", err
+// GetTheLatestValuesToPush returns the `limit` latest values that are not pushed yet, the oldest first,
+// so the values in between are skipped
+func GetTheLatestValuesToPush(sensorId int64, lastPushedEntryId int64, skipFlagged bool, limit int64) ([]database.RowType, error) {
+
+	rows, err := getValuesToPush(sensorId, lastPushedEntryId, skipFlagged, limit, true)
+
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows, err
+}
+
+func getValuesToPush(sensorId int64, lastPushedEntryId int64, skipFlagged bool, limit int64, latest bool) ([]database.RowType, error) {
+
+	qualityCondition := ""
+	if skipFlagged {
+		qualityCondition = ` AND v."quality_flags" = 0`
+	}
+
+	order := "ASC"
+	if latest {
+		order = "DESC"
 	}
 
-	newToken, err := api.CheckUserCredentials(user.Username, user.Password)
+	// The location of the entry comes along for the mobile channels
+	SQL := `SELECT v.*, e."latitude", e."longitude"
+			FROM "sensor_values" AS v
+				JOIN "sensors" AS s ON s."id" = v."sensor_id"
+				LEFT JOIN "channel_entries" AS e ON e."channel_id" = s."channel_id" AND e."entry_id" = v."entry_id"
+			WHERE 
+				v."sensor_id" = $1 AND 
+				v."entry_id" > $2` + qualityCondition + `
+			ORDER BY v."entry_id" ` + order + ` 
+			LIMIT $3`
+	params := database.QueryParams{sensorId, lastPushedEntryId, limit}
+	rows, err := global.DB.Query(SQL, params)
 	if err != nil {
-		return "", err
+		log.Printf("\nError in Query: %v \nSQL: \n%v\nParams: %v", err, SQL, params)
+		return nil, err
 	}
 
-	user.Token = newToken
-	user.TokenHash = ""
+	return rows, nil
+}
+
+// CountValuesToPush returns how many values come after the last pushed one
+func CountValuesToPush(sensorId int64, lastPushedEntryId int64, skipFlagged bool) (int64, error) {
 
-	err = api.SaveUserInfo(user)
+	qualityCondition := ""
+	if skipFlagged {
+		qualityCondition = ` AND "quality_flags" = 0`
+	}
+
+	SQL := `SELECT COUNT(*) AS "total"
+			FROM "sensor_values"
+			WHERE
+				"sensor_id" = $1 AND
+				"entry_id" > $2` + qualityCondition
+	params := database.QueryParams{sensorId, lastPushedEntryId}
+	rows, err := global.DB.Query(SQL, params)
 	if err != nil {
-		return "", err
+		log.Printf("\nError in Query: %v \nSQL: \n%v\nParams: %v", err, SQL, params)
+		return 0, err
 	}
 
-	return user.Token, nil
+	return rows[0]["total"].(int64), nil
 }
 
 /*--------------*/
@@ -0,0 +1,144 @@
+package datapush
+
+import (
+	"context"
+	"reflect"
+	"sensor-data-simulator/database"
+	"testing"
+	"time"
+)
+
+/*--------------*/
+
+// fakePushStore keeps the values of a sensor and a push setting in memory, in place of the database
+type fakePushStore struct {
+	lastEntryId int64 // The values are the entries 1 to lastEntryId
+	row         database.RowType
+}
+
+func (s *fakePushStore) install(t *testing.T) {
+
+	next, latest, count, update, restart := nextValuesToPush, latestValuesToPush, countValuesToPush, updateLastEntry, restartLoop
+	t.Cleanup(func() {
+		nextValuesToPush, latestValuesToPush, countValuesToPush, updateLastEntry, restartLoop = next, latest, count, update, restart
+	})
+
+	nextValuesToPush = func(sensorId int64, lastPushedEntryId int64, skipFlagged bool, limit int64) ([]database.RowType, error) {
+		return s.values(lastPushedEntryId+1, lastPushedEntryId+limit), nil
+	}
+	latestValuesToPush = func(sensorId int64, lastPushedEntryId int64, skipFlagged bool, limit int64) ([]database.RowType, error) {
+		first := s.lastEntryId - limit + 1
+		if first <= lastPushedEntryId {
+			first = lastPushedEntryId + 1
+		}
+		return s.values(first, s.lastEntryId), nil
+	}
+	countValuesToPush = func(sensorId int64, lastPushedEntryId int64, skipFlagged bool) (int64, error) {
+		return int64(len(s.values(lastPushedEntryId+1, s.lastEntryId))), nil
+	}
+	updateLastEntry = func(id int64, lastPushedEntryId int64, lastPushTime time.Time, pushedCount int) error {
+		s.row["last_pushed_entry_id"] = lastPushedEntryId
+		return nil
+	}
+	restartLoop = func(pushRow database.RowType, lastPushedEntryId int64, timeShift time.Duration, interval time.Duration) (int64, time.Duration, bool, error) {
+		if s.lastEntryId == 0 {
+			return lastPushedEntryId, timeShift, false, nil
+		}
+		s.row["last_pushed_entry_id"] = int64(0)
+		s.row["loop_count"] = s.row["loop_count"].(int64) + 1
+		return 0, timeShift, true, nil
+	}
+}
+
+func (s *fakePushStore) values(first int64, last int64) []database.RowType {
+
+	rows := []database.RowType{}
+	for entryId := first; entryId <= last && entryId <= s.lastEntryId; entryId++ {
+		rows = append(rows, database.RowType{
+			"entry_id":   entryId,
+			"value":      "",
+			"value_num":  float64(entryId),
+			"created_at": time.Date(2021, 6, 10, 0, int(entryId), 0, 0, time.UTC),
+		})
+	}
+	return rows
+}
+
+// load returns the setting as pushSetting loads it before each push
+func (s *fakePushStore) load() database.RowType {
+
+	row := make(database.RowType, len(s.row))
+	for name, value := range s.row {
+		row[name] = value
+	}
+	return row
+}
+
+/*--------------*/
+
+// recordingTarget keeps the entries of the pushed values
+type recordingTarget struct {
+	entryIds []int64
+}
+
+func (t *recordingTarget) Push(ctx context.Context, value PushValue) error {
+	t.entryIds = append(t.entryIds, value.EntryId)
+	return nil
+}
+
+func (t *recordingTarget) Close() error {
+	return nil
+}
+
+/*--------------*/
+
+func TestPushSettingValues(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		policy string
+		loop   bool
+		pushes [][]int64 // The entries pushed at each push
+	}{
+		{"latest", CatchUpLatest, false, [][]int64{{8, 9, 10}, nil}},
+		{"batch", CatchUpBatch, false, [][]int64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10}, nil}},
+		{"all", CatchUpAll, false, [][]int64{{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, nil}},
+		{"batch loop", CatchUpBatch, true, [][]int64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10}, {1, 2, 3}}},
+		{"all loop", CatchUpAll, true, [][]int64{{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, {1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}},
+
+		// The latest values first, then the loops replay the whole series
+		{"latest loop", CatchUpLatest, true, [][]int64{{8, 9, 10}, {1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10}, {1, 2, 3}}},
+	}
+
+	for _, test := range tests {
+
+		store := &fakePushStore{
+			lastEntryId: 10,
+			row: database.RowType{
+				"id":                    int64(1),
+				"user_id":               int64(2),
+				"sensor_id":             int64(3),
+				"target_device_id":      "device",
+				"target_sensor_id":      "sensor",
+				"push_interval_seconds": int64(60),
+				"last_pushed_entry_id":  int64(0),
+				"catch_up_policy":       test.policy,
+				"batch_size":            int64(3),
+				"loop":                  test.loop,
+				"loop_count":            int64(0),
+			},
+		}
+		store.install(t)
+
+		for i, want := range test.pushes {
+			target := &recordingTarget{}
+			pushSettingValues(context.Background(), store.load(), target)
+
+			if !reflect.DeepEqual(target.entryIds, want) {
+				t.Errorf("%v: push %v: entries = %v, want %v", test.name, i+1, target.entryIds, want)
+			}
+		}
+	}
+}
+
+/*--------------*/
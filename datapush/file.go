@@ -0,0 +1,97 @@
+package datapush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*--------------*/
+
+const defaultPushFileDir = "push-files"
+
+// fileConfig is the `target_config` of the file targets
+type fileConfig struct {
+	Path string `json:"path"` // Relative to the directory of the user in `PUSH_FILE_DIR`
+}
+
+// fileTarget appends each value as a JSON line to a local file, e.g. to replay it in another tool
+type fileTarget struct {
+	path string
+}
+
+// fileWrites keeps the lines of the settings that share a file from mixing up
+var fileWrites sync.Mutex
+
+func newFileTarget(userId int64, config json.RawMessage) (PushTarget, error) {
+
+	var conf fileConfig
+	if err := decodeTargetConfig(config, &conf); err != nil {
+		return nil, err
+	}
+
+	// The files stay in the directory of their user, whatever the users ask for
+	path := filepath.Clean(filepath.FromSlash(conf.Path))
+	if conf.Path == "" || filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("invalid target config: `path` has to be a relative path of a file")
+	}
+
+	return &fileTarget{path: filepath.Join(pushFileDir(), strconv.FormatInt(userId, 10), path)}, nil
+}
+
+func (t *fileTarget) Push(ctx context.Context, value PushValue) error {
+	return t.PushBatch(ctx, []PushValue{value})
+}
+
+// PushBatch appends the lines of all the values in one write
+func (t *fileTarget) PushBatch(ctx context.Context, values []PushValue) error {
+
+	var lines []byte
+	for _, value := range values {
+		line, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	fileWrites.Lock()
+	defer fileWrites.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(lines); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (t *fileTarget) Close() error {
+	return nil
+}
+
+/*--------------*/
+
+func pushFileDir() string {
+
+	if global.ENV.PUSH_FILE_DIR != "" {
+		return global.ENV.PUSH_FILE_DIR
+	}
+	return defaultPushFileDir
+}
+
+/*--------------*/
@@ -0,0 +1,161 @@
+package datapush
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sensor-data-simulator/global"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*--------------*/
+
+// The hosts of the targets are chosen by the users, so the server does not send anything to its own network
+// (localhost, the private networks, the metadata endpoint of the cloud, ...) unless `PUSH_ALLOWED_HOSTS` allows it
+
+const targetLookupTimeout = 10 * time.Second
+
+// internalNetworks are the ranges that are not loopback or link-local, but are not on the internet either
+var internalNetworks = parseNetworks(
+	"0.0.0.0/8",      // "This" network
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"172.16.0.0/12",  // Private
+	"192.168.0.0/16", // Private
+	"fc00::/7",       // Unique local
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+/*--------------*/
+
+// checkTargetHost refuses a host that resolves to an internal address, when a target is created
+func checkTargetHost(host string) error {
+
+	if allowedTargetHost(host) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), targetLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve `%v`: %v", host, err)
+	}
+
+	for _, addr := range addrs {
+		if err := checkTargetIP(addr.IP); err != nil {
+			return fmt.Errorf("`%v`: %v", host, err)
+		}
+	}
+	return nil
+}
+
+// checkTargetIP refuses the loopback, link-local, private and unspecified addresses that are not allowed
+func checkTargetIP(ip net.IP) error {
+
+	if allowedTargetIP(ip) {
+		return nil
+	}
+
+	internal := ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+	for _, network := range internalNetworks {
+		internal = internal || network.Contains(ip)
+	}
+
+	if internal {
+		return fmt.Errorf("`%v` is an internal address, it has to be in `PUSH_ALLOWED_HOSTS` to be used", ip)
+	}
+	return nil
+}
+
+/*--------------*/
+
+// allowedTargetHost tells if a host name or an address is in `PUSH_ALLOWED_HOSTS`
+func allowedTargetHost(host string) bool {
+
+	if ip := net.ParseIP(host); ip != nil {
+		return allowedTargetIP(ip)
+	}
+
+	for _, allowed := range strings.Split(global.ENV.PUSH_ALLOWED_HOSTS, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedTargetIP tells if an address is in `PUSH_ALLOWED_HOSTS`, as an address or in a CIDR range
+func allowedTargetIP(ip net.IP) bool {
+
+	for _, allowed := range strings.Split(global.ENV.PUSH_ALLOWED_HOSTS, ",") {
+
+		allowed = strings.TrimSpace(allowed)
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/*--------------*/
+
+// targetTransport is the HTTP transport of the user-defined targets, it checks the address of each connection,
+// so a redirect or a DNS answer that changes after the target is created cannot reach an internal address either
+var targetTransport = newTargetTransport()
+
+func newTargetTransport() *http.Transport {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // The connections go straight to the checked addresses
+	transport.DialContext = dialTarget
+
+	return transport
+}
+
+func dialTarget(ctx context.Context, network string, address string) (net.Conn, error) {
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !allowedTargetHost(host) {
+		// Called with the resolved address, right before connecting
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			ipText, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipText)
+			if ip == nil {
+				return fmt.Errorf("invalid address `%v`", address)
+			}
+			return checkTargetIP(ip)
+		}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+/*--------------*/
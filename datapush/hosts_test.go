@@ -0,0 +1,76 @@
+package datapush
+
+import (
+	"net"
+	"sensor-data-simulator/global"
+	"testing"
+)
+
+/*--------------*/
+
+func TestCheckTargetIP(t *testing.T) {
+
+	defer func(allowed string) { global.ENV.PUSH_ALLOWED_HOSTS = allowed }(global.ENV.PUSH_ALLOWED_HOSTS)
+
+	tests := []struct {
+		allowed string
+		ip      string
+		valid   bool
+	}{
+		{"", "93.184.216.34", true},
+		{"", "2606:2800:220:1::1", true},
+		{"", "127.0.0.1", false},
+		{"", "::1", false},
+		{"", "0.0.0.0", false},
+		{"", "169.254.169.254", false}, // The metadata endpoint of the clouds
+		{"", "fe80::1", false},
+		{"", "10.1.2.3", false},
+		{"", "172.16.0.1", false},
+		{"", "172.32.0.1", true},
+		{"", "192.168.1.10", false},
+		{"", "100.64.0.1", false},
+		{"", "fd00::1", false},
+		{"", "::ffff:127.0.0.1", false},
+
+		{"10.1.2.3", "10.1.2.3", true},
+		{"10.1.2.3", "10.1.2.4", false},
+		{"broker.local, 192.168.0.0/16", "192.168.1.10", true},
+		{"192.168.0.0/16", "127.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		global.ENV.PUSH_ALLOWED_HOSTS = test.allowed
+		err := checkTargetIP(net.ParseIP(test.ip))
+		if (err == nil) != test.valid {
+			t.Errorf("checkTargetIP(%v) with `%v` allowed: error = %v, valid = %v", test.ip, test.allowed, err, test.valid)
+		}
+	}
+}
+
+/*--------------*/
+
+func TestAllowedTargetHost(t *testing.T) {
+
+	defer func(allowed string) { global.ENV.PUSH_ALLOWED_HOSTS = allowed }(global.ENV.PUSH_ALLOWED_HOSTS)
+	global.ENV.PUSH_ALLOWED_HOSTS = " Broker.Local ,10.0.0.0/8"
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"broker.local", true},
+		{"BROKER.LOCAL", true},
+		{"other.local", false},
+		{"10.20.30.40", true},
+		{"127.0.0.1", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := allowedTargetHost(test.host); got != test.want {
+			t.Errorf("allowedTargetHost(%q) = %v, want %v", test.host, got, test.want)
+		}
+	}
+}
+
+/*--------------*/
@@ -0,0 +1,303 @@
+package datapush
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+/*--------------*/
+
+const (
+	defaultMQTTTopic      = "devices/{target_device_id}/sensors/{target_sensor_id}/value"
+	defaultMQTTBufferSize = 1000
+	maxMQTTBufferSize     = 100000
+
+	mqttPublishTimeout = 10 * time.Second
+)
+
+// The payload formats of the MQTT targets
+const (
+	MQTTPayloadJSON   = "json"   // The value with all its fields, like the webhooks
+	MQTTPayloadWaziup = "waziup" // {"value": ..., "timestamp": ...} like the Waziup API
+	MQTTPayloadValue  = "value"  // Only the value as text
+)
+
+// mqttConfig is the `target_config` of the MQTT targets
+type mqttConfig struct {
+	Broker     string `json:"broker"` // e.g. `tcp://broker.example.com:1883`, `ssl://...`, `ws://...`
+	ClientId   string `json:"client_id"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Topic      string `json:"topic"` // With the {target_device_id}, {target_sensor_id}, {sensor_id} and {setting_id} placeholders
+	QoS        int    `json:"qos"`
+	Retain     bool   `json:"retain"`
+	Payload    string `json:"payload"`     // json (default), waziup or value
+	BufferSize int    `json:"buffer_size"` // The messages kept while the broker is down
+}
+
+// mqttTarget publishes each value to a broker. The client reconnects on its own,
+// and the messages wait in a buffer while the broker is down
+type mqttTarget struct {
+	conf    mqttConfig
+	options *mqtt.ClientOptions
+
+	mu     sync.Mutex
+	client mqtt.Client // nil until the first push
+	buffer []mqttMessage
+	closed bool
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+
+	settingId int64 // The value it comes from, to push it again if it never goes out
+	entryId   int64
+}
+
+var mqttBrokerSchemes = map[string]bool{"tcp": true, "mqtt": true, "ssl": true, "tls": true, "mqtts": true, "ws": true, "wss": true}
+
+func newMQTTTarget(userId int64, config json.RawMessage) (PushTarget, error) {
+
+	conf := mqttConfig{QoS: -1}
+	if err := decodeTargetConfig(config, &conf); err != nil {
+		return nil, err
+	}
+
+	brokerURL, err := url.Parse(conf.Broker)
+	if err != nil || !mqttBrokerSchemes[brokerURL.Scheme] || brokerURL.Host == "" {
+		return nil, fmt.Errorf("invalid target config: `broker` has to be a URL like `tcp://broker.example.com:1883`")
+	}
+	if err := checkTargetHost(brokerURL.Hostname()); err != nil {
+		return nil, fmt.Errorf("invalid target config: `broker`: %v", err)
+	}
+
+	if conf.Topic == "" {
+		conf.Topic = defaultMQTTTopic
+	}
+	if strings.ContainsAny(conf.Topic, "+#") {
+		return nil, fmt.Errorf("invalid target config: `topic` cannot have wildcards")
+	}
+
+	switch conf.QoS {
+	case -1:
+		conf.QoS = 1
+	case 0, 1, 2:
+	default:
+		return nil, fmt.Errorf("invalid target config: `qos` has to be 0, 1 or 2")
+	}
+
+	switch conf.Payload {
+	case "":
+		conf.Payload = MQTTPayloadJSON
+	case MQTTPayloadJSON, MQTTPayloadWaziup, MQTTPayloadValue:
+	default:
+		return nil, fmt.Errorf("invalid target config: `payload` has to be json, waziup or value")
+	}
+
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = defaultMQTTBufferSize
+	}
+	if conf.BufferSize > maxMQTTBufferSize {
+		return nil, fmt.Errorf("invalid target config: `buffer_size` has to be at most %v", maxMQTTBufferSize)
+	}
+
+	// The brokers drop the older connection of a client id, so each target has its own
+	if conf.ClientId == "" {
+		suffix := make([]byte, 6)
+		rand.Read(suffix)
+		conf.ClientId = "sensor-data-simulator-" + hex.EncodeToString(suffix)
+	}
+
+	target := &mqttTarget{conf: conf}
+
+	target.options = mqtt.NewClientOptions().
+		AddBroker(conf.Broker).
+		SetClientID(conf.ClientId).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetMaxReconnectInterval(1 * time.Minute).
+		SetWriteTimeout(mqttPublishTimeout).
+		SetOnConnectHandler(target.onConnect).
+		SetConnectionLostHandler(func(client mqtt.Client, err error) {
+			log.Printf("[PUSH ] Lost the MQTT broker `%v`: %v", conf.Broker, err)
+		})
+
+	return target, nil
+}
+
+/*--------------*/
+
+func (t *mqttTarget) Push(ctx context.Context, value PushValue) error {
+
+	message, err := t.message(value)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errors.New("the MQTT target is closed")
+	}
+
+	// The client connects in the background, and keeps trying until the broker is up
+	if t.client == nil {
+		t.client = mqtt.NewClient(t.options)
+		t.client.Connect()
+	}
+
+	// The messages keep their order, so the waiting ones go out first
+	if t.client.IsConnectionOpen() {
+		t.flushBuffer()
+		if len(t.buffer) == 0 {
+			if err := t.publish(message); err == nil {
+				return nil
+			}
+		}
+	}
+
+	// The value is not pushed if the buffer is full, so it is pushed again later
+	if len(t.buffer) >= t.conf.BufferSize {
+		return fmt.Errorf("the MQTT broker `%v` is not reachable and the buffer is full (%v messages)", t.conf.Broker, len(t.buffer))
+	}
+
+	t.buffer = append(t.buffer, message)
+	return nil
+}
+
+// onConnect sends the buffered messages once the client is connected (again)
+func (t *mqttTarget) onConnect(client mqtt.Client) {
+	go t.flush()
+}
+
+// flush sends the buffered messages in order, it stops at the first failure
+func (t *mqttTarget) flush() {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.flushBuffer()
+}
+
+// flushBuffer is flush with the lock already held
+func (t *mqttTarget) flushBuffer() {
+
+	sent := 0
+	for _, message := range t.buffer {
+		if t.client == nil || !t.client.IsConnectionOpen() || t.publish(message) != nil {
+			break
+		}
+		sent++
+	}
+	t.buffer = t.buffer[sent:]
+
+	if sent > 0 {
+		log.Printf("[PUSH ] Sent %v buffered messages to the MQTT broker `%v`", sent, t.conf.Broker)
+	}
+}
+
+// publish sends a message and waits for its acknowledgement (with QoS 1 and 2)
+func (t *mqttTarget) publish(message mqttMessage) error {
+
+	token := t.client.Publish(message.topic, byte(t.conf.QoS), t.conf.Retain, message.payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return errors.New("timeout in publishing to the MQTT broker")
+	}
+	return token.Error()
+}
+
+func (t *mqttTarget) Close() error {
+
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	// The last chance for the buffered messages
+	t.flush()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The values that never went out count as not pushed, so they are pushed again, e.g. by the next leader
+	if len(t.buffer) > 0 {
+		log.Printf("[PUSH ] %v messages to the MQTT broker `%v` are not sent, their values will be pushed again", len(t.buffer), t.conf.Broker)
+		if err := unpushBufferedValues(t.buffer); err != nil {
+			return err
+		}
+		t.buffer = nil
+	}
+
+	if t.client != nil {
+		t.client.Disconnect(250)
+	}
+	return nil
+}
+
+/*--------------*/
+
+// message builds the topic and the payload of a value
+func (t *mqttTarget) message(value PushValue) (mqttMessage, error) {
+
+	topic := strings.NewReplacer(
+		"{target_device_id}", value.TargetDeviceId,
+		"{target_sensor_id}", value.TargetSensorId,
+		"{sensor_id}", strconv.FormatInt(value.SensorId, 10),
+		"{setting_id}", strconv.FormatInt(value.SettingId, 10),
+	).Replace(t.conf.Topic)
+
+	var payload []byte
+	var err error
+
+	switch t.conf.Payload {
+	case MQTTPayloadWaziup:
+		payload, err = json.Marshal(map[string]interface{}{
+			"value":     value.Value,
+			"timestamp": value.Timestamp.Format(time.RFC3339),
+		})
+	case MQTTPayloadValue:
+		payload = []byte(fmt.Sprint(value.Value))
+	default:
+		payload, err = json.Marshal(value)
+	}
+
+	return mqttMessage{topic: topic, payload: payload, settingId: value.SettingId, entryId: value.EntryId}, err
+}
+
+// unpushBufferedValues moves the push settings back to before their first unsent message
+func unpushBufferedValues(buffer []mqttMessage) error {
+
+	firstEntryIds := make(map[int64]int64)
+	counts := make(map[int64]int)
+	for _, message := range buffer {
+		if entryId, ok := firstEntryIds[message.settingId]; !ok || message.entryId < entryId {
+			firstEntryIds[message.settingId] = message.entryId
+		}
+		counts[message.settingId]++
+	}
+
+	for settingId, entryId := range firstEntryIds {
+		if err := RewindPushSetting(settingId, entryId-1, counts[settingId]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*--------------*/
@@ -0,0 +1,245 @@
+package datapush
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"sync"
+	"time"
+)
+
+/*--------------*/
+
+const (
+	// How often the settings are loaded again, to pick up the new, changed and removed ones
+	settingsReloadPeriod = 30 * time.Second
+
+	// How many settings are pushed at the same time, so a slow target does not hold the others back
+	pushWorkers = 16
+)
+
+// scheduledPush is a push setting in the queue of the scheduler
+type scheduledPush struct {
+	settingId int64
+	interval  time.Duration
+	due       time.Time
+	running   bool // Out of the queue while it is pushed
+	removed   bool // Deleted or deactivated while it is pushed, it is dropped once the push is over
+	index     int  // In the queue
+}
+
+// pushQueue is a heap of the settings, the first due on top
+type pushQueue []*scheduledPush
+
+func (q pushQueue) Len() int           { return len(q) }
+func (q pushQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q pushQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *pushQueue) Push(x interface{}) {
+	item := x.(*scheduledPush)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *pushQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*q = old[:len(old)-1]
+	return item
+}
+
+/*--------------*/
+
+// pushScheduler keeps every active push setting in one queue ordered by the time it is due
+type pushScheduler struct {
+	queue    pushQueue
+	settings map[int64]*scheduledPush
+}
+
+// Run pushes the values until the given context is cancelled, e.g. while this instance leads the push
+func Run(ctx context.Context) {
+
+	scheduler := &pushScheduler{settings: make(map[int64]*scheduledPush)}
+
+	done := make(chan int64)
+	workers := make(chan struct{}, pushWorkers)
+	var wg sync.WaitGroup
+
+	scheduler.reload(time.Now())
+	nextReload := time.Now().Add(settingsReloadPeriod)
+
+	for {
+
+		wait := time.Until(nextReload)
+		if scheduler.queue.Len() > 0 {
+			if untilDue := time.Until(scheduler.queue[0].due); untilDue < wait {
+				wait = untilDue
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case settingId := <-done:
+			timer.Stop()
+			scheduler.finish(settingId, time.Now())
+		case <-ctx.Done():
+			timer.Stop()
+			wg.Wait()
+			closeTargets(nil)
+			return
+		}
+
+		/*---------*/
+
+		now := time.Now()
+		if !now.Before(nextReload) {
+			scheduler.reload(now)
+			nextReload = now.Add(settingsReloadPeriod)
+		}
+
+		for scheduler.queue.Len() > 0 && !scheduler.queue[0].due.After(now) {
+
+			item := heap.Pop(&scheduler.queue).(*scheduledPush)
+			item.running = true
+
+			wg.Add(1)
+			go func(settingId int64) {
+				defer wg.Done()
+
+				workers <- struct{}{}
+				pushSetting(ctx, settingId)
+				<-workers
+
+				select {
+				case done <- settingId:
+				case <-ctx.Done():
+				}
+			}(item.settingId)
+		}
+	}
+}
+
+/*--------------*/
+
+// finish puts a setting back in the queue once it is pushed.
+// The next time comes from the previous due time, so the pushes do not drift by the time they take
+func (s *pushScheduler) finish(settingId int64, now time.Time) {
+
+	item, ok := s.settings[settingId]
+	if !ok || !item.running {
+		return // Removed in the meantime
+	}
+
+	item.running = false
+	if item.removed {
+		delete(s.settings, settingId)
+		return
+	}
+
+	item.due = item.due.Add(item.interval)
+	if item.due.Before(now) {
+		item.due = now // Late by more than an interval, the missed ones are not made up for
+	}
+	heap.Push(&s.queue, item)
+}
+
+// reload syncs the queue with the active settings in the database
+func (s *pushScheduler) reload(now time.Time) {
+
+	rows, err := loadActiveSettings()
+	if err != nil {
+		log.Printf("\nError in `push_settings` Load: %v", err)
+		return
+	}
+
+	activeIds := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+
+		settingId := row["id"].(int64)
+		activeIds[settingId] = true
+		interval := pushInterval(row)
+
+		// A setting that is still pushed keeps its item, so it is never pushed twice at the same time
+		item, ok := s.settings[settingId]
+		if ok {
+			item.removed = false
+		}
+		if ok && item.interval == interval {
+			continue
+		}
+
+		// The due time of a new or changed setting comes from its last push, so it stays on schedule across restarts
+		due := now
+		if lastPushTime, pushed := row["last_push_time"].(time.Time); pushed && lastPushTime.Add(interval).After(now) {
+			due = lastPushTime.Add(interval)
+		}
+
+		if !ok {
+			item = &scheduledPush{settingId: settingId, interval: interval, due: due}
+			s.settings[settingId] = item
+			heap.Push(&s.queue, item)
+			continue
+		}
+
+		item.interval = interval
+		if !item.running {
+			item.due = due
+			heap.Fix(&s.queue, item.index)
+		}
+	}
+
+	// The deleted and the deactivated settings
+	for settingId, item := range s.settings {
+		if activeIds[settingId] {
+			continue
+		}
+		if item.running {
+			item.removed = true
+			continue
+		}
+		heap.Remove(&s.queue, item.index)
+		delete(s.settings, settingId)
+	}
+
+	closeTargets(activeIds)
+}
+
+// The database call of the scheduler, replaced in the tests
+var loadActiveSettings = activePushSettings
+
+func activePushSettings() ([]database.RowType, error) {
+
+	SQL := `SELECT "id", "push_interval", "push_interval_seconds", "last_push_time"
+			FROM "push_settings"
+			WHERE "active" = true`
+
+	return global.DB.Query(SQL, database.QueryParams{})
+}
+
+/*--------------*/
+
+// pushInterval is the interval of a setting, `push_interval_seconds` or the older `push_interval` in minutes
+func pushInterval(row database.RowType) time.Duration {
+
+	if seconds, ok := row["push_interval_seconds"].(int64); ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if minutes, ok := row["push_interval"].(int64); ok && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	return time.Minute
+}
+
+/*--------------*/
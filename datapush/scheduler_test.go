@@ -0,0 +1,245 @@
+package datapush
+
+import (
+	"container/heap"
+	"reflect"
+	"sensor-data-simulator/database"
+	"sort"
+	"testing"
+	"time"
+)
+
+/*--------------*/
+
+var schedulerNow = time.Date(2021, 6, 10, 12, 0, 0, 0, time.UTC)
+
+// installSettings makes the scheduler load the given rows in place of the active settings of the database
+func installSettings(t *testing.T, rows *[]database.RowType) {
+
+	load := loadActiveSettings
+	t.Cleanup(func() { loadActiveSettings = load })
+
+	loadActiveSettings = func() ([]database.RowType, error) {
+		return *rows, nil
+	}
+}
+
+func settingRow(id int64, intervalSeconds int64, lastPushTime interface{}) database.RowType {
+	return database.RowType{
+		"id":                    id,
+		"push_interval":         nil,
+		"push_interval_seconds": intervalSeconds,
+		"last_push_time":        lastPushTime,
+	}
+}
+
+// queuedIds returns the settings of the queue, the first due first
+func (s *pushScheduler) queuedIds() []int64 {
+
+	items := make(pushQueue, len(s.queue))
+	copy(items, s.queue)
+	sort.Slice(items, func(i, j int) bool { return items[i].due.Before(items[j].due) })
+
+	ids := []int64{}
+	for _, item := range items {
+		ids = append(ids, item.settingId)
+	}
+	return ids
+}
+
+// start takes a setting out of the queue, like the scheduler when it pushes it
+func (s *pushScheduler) start(settingId int64) *scheduledPush {
+
+	item := s.settings[settingId]
+	heap.Remove(&s.queue, item.index)
+	item.running = true
+	return item
+}
+
+/*--------------*/
+
+func TestPushQueue(t *testing.T) {
+
+	queue := pushQueue{}
+	items := map[int64]*scheduledPush{}
+	for i, minutes := range []int{30, 10, 50, 20, 40} {
+		item := &scheduledPush{settingId: int64(i + 1), due: schedulerNow.Add(time.Duration(minutes) * time.Minute)}
+		items[item.settingId] = item
+		heap.Push(&queue, item)
+	}
+
+	// Setting 3 becomes the first due, setting 4 is removed
+	items[3].due = schedulerNow
+	heap.Fix(&queue, items[3].index)
+	heap.Remove(&queue, items[4].index)
+
+	got := []int64{}
+	for queue.Len() > 0 {
+		item := heap.Pop(&queue).(*scheduledPush)
+		if item.index != -1 {
+			t.Errorf("setting %v: index out of the queue = %v, want -1", item.settingId, item.index)
+		}
+		got = append(got, item.settingId)
+	}
+
+	if want := []int64{3, 2, 1, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pushQueue order = %v, want %v", got, want)
+	}
+}
+
+/*--------------*/
+
+func TestPushSchedulerReload(t *testing.T) {
+
+	rows := []database.RowType{
+		settingRow(1, 60, nil),                                 // Never pushed: due now
+		settingRow(2, 600, schedulerNow.Add(-5*time.Minute)),   // Pushed 5 minutes ago: due in 5 minutes
+		settingRow(3, 60, schedulerNow.Add(-time.Hour)),        // Late: due now
+		settingRow(4, 3600, schedulerNow.Add(-20*time.Minute)), // Due in 40 minutes
+	}
+	installSettings(t, &rows)
+
+	s := &pushScheduler{settings: make(map[int64]*scheduledPush)}
+	s.reload(schedulerNow)
+
+	wantDue := map[int64]time.Time{
+		1: schedulerNow,
+		2: schedulerNow.Add(5 * time.Minute),
+		3: schedulerNow,
+		4: schedulerNow.Add(40 * time.Minute),
+	}
+	for settingId, want := range wantDue {
+		if item := s.settings[settingId]; item == nil || !item.due.Equal(want) {
+			t.Errorf("setting %v: due = %v, want %v", settingId, item, want)
+		}
+	}
+	if got := s.queuedIds(); len(got) != 4 || got[2] != 2 || got[3] != 4 {
+		t.Errorf("queue after the first load = %v, want 1 and 3, then 2 and 4", got)
+	}
+
+	/*---------*/
+
+	// Setting 1 is pushed while the settings change, setting 3 is deactivated
+	running := s.start(1)
+
+	later := schedulerNow.Add(time.Minute)
+	rows = []database.RowType{
+		settingRow(1, 120, nil),                                // Changed while it is pushed
+		settingRow(2, 60, schedulerNow.Add(-5*time.Minute)),    // Changed: due from its last push again
+		settingRow(4, 3600, schedulerNow.Add(-20*time.Minute)), // Not changed
+		settingRow(5, 60, nil),                                 // New
+	}
+	s.reload(later)
+
+	if _, ok := s.settings[3]; ok {
+		t.Errorf("setting 3: still scheduled once deactivated")
+	}
+	if running.interval != 2*time.Minute || !running.due.Equal(schedulerNow) || running.index != -1 {
+		t.Errorf("running setting: interval = %v, due = %v, index = %v, want 2m, %v and out of the queue",
+			running.interval, running.due, running.index, schedulerNow)
+	}
+	if due := s.settings[2].due; !due.Equal(later) {
+		t.Errorf("changed setting 2: due = %v, want %v", due, later) // Its last push + 1 minute is over
+	}
+	if due := s.settings[4].due; !due.Equal(schedulerNow.Add(40 * time.Minute)) {
+		t.Errorf("setting 4: due = %v, want it unchanged", due)
+	}
+	if due := s.settings[5].due; !due.Equal(later) {
+		t.Errorf("new setting 5: due = %v, want %v", due, later)
+	}
+	if got := s.queuedIds(); len(got) != 3 || got[2] != 4 {
+		t.Errorf("queue after the second load = %v, want 2 and 5, then 4", got)
+	}
+}
+
+/*--------------*/
+
+func TestPushSchedulerRunning(t *testing.T) {
+
+	rows := []database.RowType{settingRow(1, 60, nil), settingRow(2, 600, schedulerNow.Add(-time.Minute))}
+	installSettings(t, &rows)
+
+	s := &pushScheduler{settings: make(map[int64]*scheduledPush)}
+	s.reload(schedulerNow)
+
+	// Pushed on time, the next push is an interval after the previous due time
+	item := s.start(1)
+	s.finish(1, schedulerNow.Add(10*time.Second))
+	if item.running || !item.due.Equal(schedulerNow.Add(time.Minute)) {
+		t.Errorf("finished on time: running = %v, due = %v, want false, %v", item.running, item.due, schedulerNow.Add(time.Minute))
+	}
+
+	// Pushed late, the missed pushes are not made up for
+	item = s.start(1)
+	late := schedulerNow.Add(5 * time.Minute)
+	s.finish(1, late)
+	if !item.due.Equal(late) {
+		t.Errorf("finished late: due = %v, want %v", item.due, late)
+	}
+
+	// Finished twice, or not running
+	s.finish(1, late)
+	s.finish(99, late)
+	if got := s.queuedIds(); !reflect.DeepEqual(got, []int64{1, 2}) && !reflect.DeepEqual(got, []int64{2, 1}) {
+		t.Errorf("queue after extra finishes = %v, want 1 and 2 once", got)
+	}
+
+	/*---------*/
+
+	// Deactivated while it is pushed: dropped once the push is over
+	item = s.start(2)
+	rows = []database.RowType{settingRow(1, 60, nil)}
+	s.reload(late)
+
+	if !item.removed || s.settings[2] == nil {
+		t.Errorf("deactivated while pushed: removed = %v, scheduled = %v, want true, true", item.removed, s.settings[2] != nil)
+	}
+	s.finish(2, late)
+	if _, ok := s.settings[2]; ok {
+		t.Errorf("deactivated while pushed: still scheduled once the push is over")
+	}
+	if got := s.queuedIds(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("queue once the removed push is over = %v, want [1]", got)
+	}
+
+	/*---------*/
+
+	// Deactivated and activated again while it is pushed: back in the queue
+	item = s.start(1)
+	rows = []database.RowType{}
+	s.reload(late)
+	rows = []database.RowType{settingRow(1, 60, nil)}
+	s.reload(late)
+
+	s.finish(1, late)
+	if item.removed || item.running || s.settings[1] != item {
+		t.Errorf("activated again while pushed: removed = %v, running = %v, want false, false", item.removed, item.running)
+	}
+	if got := s.queuedIds(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("queue once the push is over = %v, want [1]", got)
+	}
+}
+
+/*--------------*/
+
+func TestPushInterval(t *testing.T) {
+
+	tests := []struct {
+		row  database.RowType
+		want time.Duration
+	}{
+		{database.RowType{"push_interval_seconds": int64(30), "push_interval": int64(5)}, 30 * time.Second},
+		{database.RowType{"push_interval_seconds": nil, "push_interval": int64(5)}, 5 * time.Minute},
+		{database.RowType{"push_interval_seconds": int64(0), "push_interval": int64(2)}, 2 * time.Minute},
+		{database.RowType{"push_interval_seconds": nil, "push_interval": nil}, time.Minute},
+		{database.RowType{"push_interval_seconds": int64(-5), "push_interval": int64(0)}, time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := pushInterval(test.row); got != test.want {
+			t.Errorf("pushInterval(%v) = %v, want %v", test.row, got, test.want)
+		}
+	}
+}
+
+/*--------------*/
@@ -0,0 +1,196 @@
+package datapush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sensor-data-simulator/api"
+	"sensor-data-simulator/database"
+	"sync"
+	"time"
+)
+
+/*--------------*/
+
+// The types of the push targets
+const (
+	TargetWaziup  = "waziup"
+	TargetWebhook = "webhook"
+	TargetFile    = "file"
+	TargetMQTT    = "mqtt"
+)
+
+// PushValue is a value of a source sensor on its way to a target
+type PushValue struct {
+	SettingId      int64       `json:"setting_id"`
+	UserId         int64       `json:"-"`
+	SensorId       int64       `json:"sensor_id"`
+	TargetDeviceId string      `json:"target_device_id"`
+	TargetSensorId string      `json:"target_sensor_id"`
+	EntryId        int64       `json:"entry_id"`
+	Value          interface{} `json:"value"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Latitude       *float64    `json:"latitude,omitempty"` // Only for the entries with a location (mobile channels)
+	Longitude      *float64    `json:"longitude,omitempty"`
+}
+
+// PushTarget is where the values of a push setting go
+type PushTarget interface {
+	// Push sends one value, the value counts as pushed only if it returns no error
+	Push(ctx context.Context, value PushValue) error
+
+	// Close releases what the target holds (e.g. a connection), it is not used anymore after that
+	Close() error
+}
+
+// BatchPushTarget is a target that can send several values at once
+type BatchPushTarget interface {
+	PushTarget
+
+	// PushBatch sends the values of a setting in one go, either all of them are pushed or none
+	PushBatch(ctx context.Context, values []PushValue) error
+}
+
+// pushValues sends the values in order, in one batch if the target can,
+// it returns how many of them are pushed before an error
+func pushValues(ctx context.Context, target PushTarget, values []PushValue) (int, error) {
+
+	if batchTarget, ok := target.(BatchPushTarget); ok && len(values) > 1 {
+		if err := batchTarget.PushBatch(ctx, values); err != nil {
+			return 0, err
+		}
+		return len(values), nil
+	}
+
+	for i, value := range values {
+		if err := target.Push(ctx, value); err != nil {
+			return i, err
+		}
+	}
+	return len(values), nil
+}
+
+// pushTargetTypes creates the targets of each type from the owner and the `target_config` of the push settings
+var pushTargetTypes = map[string]func(userId int64, config json.RawMessage) (PushTarget, error){
+	TargetWaziup:  newWaziupTarget,
+	TargetWebhook: newWebhookTarget,
+	TargetFile:    newFileTarget,
+	TargetMQTT:    newMQTTTarget,
+}
+
+func init() {
+	api.ValidatePushTarget = ValidateTarget
+}
+
+/*--------------*/
+
+// ValidateTarget checks that a target type exists and that its config is valid, without creating the target
+func ValidateTarget(userId int64, targetType string, config json.RawMessage) error {
+
+	target, err := newPushTarget(userId, targetType, config)
+	if err != nil {
+		return err
+	}
+
+	return target.Close()
+}
+
+func newPushTarget(userId int64, targetType string, config json.RawMessage) (PushTarget, error) {
+
+	newTarget, ok := pushTargetTypes[targetType]
+	if !ok {
+		return nil, fmt.Errorf("unknown target type `%v`", targetType)
+	}
+
+	if len(bytes.TrimSpace(config)) == 0 {
+		config = json.RawMessage("{}")
+	}
+
+	return newTarget(userId, config)
+}
+
+// decodeTargetConfig reads the config of a target into the given struct, the unknown fields are rejected
+func decodeTargetConfig(config json.RawMessage, dest interface{}) error {
+
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dest); err != nil {
+		return fmt.Errorf("invalid target config: %v", err)
+	}
+	return nil
+}
+
+/*--------------*/
+
+// The targets are kept between the pushes, so they can keep their state (tokens, connections, ...)
+var targetCache struct {
+	sync.Mutex
+	targets map[int64]*cachedTarget
+}
+
+type cachedTarget struct {
+	targetType string
+	config     string
+	target     PushTarget
+}
+
+// getPushTarget returns the target of a push setting, a new one if the setting has changed since the last push
+func getPushTarget(pushRow database.RowType) (PushTarget, error) {
+
+	settingId := pushRow["id"].(int64)
+	userId, _ := pushRow["user_id"].(int64)
+	targetType, _ := pushRow["target_type"].(string)
+	if targetType == "" {
+		targetType = TargetWaziup
+	}
+	config, _ := pushRow["target_config"].(string)
+
+	targetCache.Lock()
+	defer targetCache.Unlock()
+
+	if targetCache.targets == nil {
+		targetCache.targets = make(map[int64]*cachedTarget)
+	}
+
+	if cached, ok := targetCache.targets[settingId]; ok {
+		if cached.targetType == targetType && cached.config == config {
+			return cached.target, nil
+		}
+		closeTarget(settingId, cached.target)
+		delete(targetCache.targets, settingId)
+	}
+
+	target, err := newPushTarget(userId, targetType, json.RawMessage(config))
+	if err != nil {
+		return nil, err
+	}
+
+	targetCache.targets[settingId] = &cachedTarget{targetType: targetType, config: config, target: target}
+	return target, nil
+}
+
+// closeTargets closes the targets of the push settings that are not in the given ones, all of them with nil
+func closeTargets(keepIds map[int64]bool) {
+
+	targetCache.Lock()
+	defer targetCache.Unlock()
+
+	for settingId, cached := range targetCache.targets {
+		if !keepIds[settingId] {
+			closeTarget(settingId, cached.target)
+			delete(targetCache.targets, settingId)
+		}
+	}
+}
+
+func closeTarget(settingId int64, target PushTarget) {
+
+	if err := target.Close(); err != nil {
+		log.Printf("[PUSH ] Error in closing the target of the push setting `%v`: %v", settingId, err)
+	}
+}
+
+/*--------------*/
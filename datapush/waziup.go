@@ -0,0 +1,302 @@
+package datapush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sensor-data-simulator/api"
+	"sensor-data-simulator/global"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*--------------*/
+
+// A Waziup call that hangs would hold the push back, e.g. when the instance steps down
+const waziupTimeout = 30 * time.Second
+
+var waziupClient = &http.Client{Timeout: waziupTimeout}
+
+// waziupConfig is the `target_config` of the Waziup targets, all of it is optional
+type waziupConfig struct {
+	APIURL string `json:"api_url"` // Default is `WAZIUP_API_PATH`, the others have to be in `WAZIUP_API_URLS`
+}
+
+// waziupTarget pushes to the Waziup cloud with the token of the owner of the push setting
+type waziupTarget struct {
+	apiURL string
+
+	mu    sync.Mutex
+	token string
+}
+
+func newWaziupTarget(userId int64, config json.RawMessage) (PushTarget, error) {
+
+	var conf waziupConfig
+	if err := decodeTargetConfig(config, &conf); err != nil {
+		return nil, err
+	}
+
+	if conf.APIURL == "" {
+		conf.APIURL = global.ENV.WAZIUP_API_PATH
+	}
+	conf.APIURL = withTrailingSlash(conf.APIURL)
+
+	// The token of the user goes along with each value, so only the known Waziup APIs get it
+	if !allowedWaziupURL(conf.APIURL) {
+		return nil, fmt.Errorf("invalid target config: `api_url` has to be `WAZIUP_API_PATH` or one of `WAZIUP_API_URLS`")
+	}
+
+	return &waziupTarget{apiURL: conf.APIURL}, nil
+}
+
+func allowedWaziupURL(apiURL string) bool {
+
+	if apiURL == withTrailingSlash(global.ENV.WAZIUP_API_PATH) {
+		return true
+	}
+	for _, allowed := range strings.Split(global.ENV.WAZIUP_API_URLS, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && apiURL == withTrailingSlash(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func withTrailingSlash(path string) string {
+
+	if !strings.HasSuffix(path, "/") {
+		return path + "/"
+	}
+	return path
+}
+
+func (t *waziupTarget) Push(ctx context.Context, value PushValue) error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.withToken(value.UserId, func(token string) (int, error) {
+		return PushDataToWaziup(ctx, t.apiURL, token, value.TargetDeviceId, value.TargetSensorId, value.Value, value.Timestamp)
+	})
+	if err != nil {
+		return err
+	}
+
+	t.pushLocation(ctx, value)
+	return nil
+}
+
+// PushBatch sends the values of a sensor in one request, with the multi-value API of Waziup
+func (t *waziupTarget) PushBatch(ctx context.Context, values []PushValue) error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	first := values[0]
+	err := t.withToken(first.UserId, func(token string) (int, error) {
+		return PushValuesToWaziup(ctx, t.apiURL, token, first.TargetDeviceId, first.TargetSensorId, values)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The device ends up where the last value was taken
+	t.pushLocation(ctx, values[len(values)-1])
+	return nil
+}
+
+// withToken calls Waziup with the token of the user, and once more with a new token if it is not valid anymore
+func (t *waziupTarget) withToken(userId int64, call func(token string) (int, error)) error {
+
+	if t.token == "" {
+		user, err := api.GetUserById(userId)
+		if err != nil {
+			return err
+		}
+		t.token = user.Token
+	}
+
+	statusCode, err := call(t.token)
+	if statusCode != 403 {
+		return err
+	}
+
+	newToken, err := RefreshWaziupToken(userId)
+	if err != nil {
+		return fmt.Errorf("token acquisition: %v", err)
+	}
+	t.token = newToken
+
+	_, err = call(t.token)
+	return err
+}
+
+// pushLocation moves the target device along with the values of the mobile channels
+func (t *waziupTarget) pushLocation(ctx context.Context, value PushValue) {
+
+	if value.Latitude == nil || value.Longitude == nil {
+		return
+	}
+
+	if _, err := PushLocationToWaziup(ctx, t.apiURL, t.token, value.TargetDeviceId, *value.Latitude, *value.Longitude); err != nil {
+		log.Printf("[PUSH ] error in location push: `%v` \nUserId: %v", err, value.UserId)
+	}
+}
+
+func (t *waziupTarget) Close() error {
+	return nil
+}
+
+/*--------------*/
+
+func PushDataToWaziup(ctx context.Context, apiURL string, token string, deviceId string, sensorId string, value interface{}, timestamp time.Time) (int, error) {
+
+	apiPath := fmt.Sprintf(apiURL+`devices/%s/sensors/%s/value`, deviceId, sensorId)
+
+	postBody, err := json.Marshal(map[string]interface{}{
+		"value":     value,
+		"timestamp": timestamp.Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	/*--------*/
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiPath, bytes.NewBuffer(postBody))
+	if err != nil {
+		log.Printf("[PUSH ] could not make the request: %v", err)
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := waziupClient.Do(req)
+	if err != nil {
+		log.Printf("[PUSH ] did not receive a response from Waziup Server: %v", err)
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		err := fmt.Errorf("waziup api error (%v): %v \n\tAPI path: %v", resp.StatusCode, resp.Status, apiPath)
+		// log.Printf("[PUSH ] Waziup API Error: %v \nAPI path: %v", err, apiPath)
+		return resp.StatusCode, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+/*--------------*/
+
+// PushValuesToWaziup sends several values of a sensor in one request
+func PushValuesToWaziup(ctx context.Context, apiURL string, token string, deviceId string, sensorId string, values []PushValue) (int, error) {
+
+	apiPath := fmt.Sprintf(apiURL+`devices/%s/sensors/%s/values`, deviceId, sensorId)
+
+	datapoints := make([]map[string]interface{}, 0, len(values))
+	for _, value := range values {
+		datapoints = append(datapoints, map[string]interface{}{
+			"value":     value.Value,
+			"timestamp": value.Timestamp.Format(time.RFC3339),
+		})
+	}
+
+	postBody, err := json.Marshal(datapoints)
+	if err != nil {
+		return 0, err
+	}
+
+	/*--------*/
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiPath, bytes.NewBuffer(postBody))
+	if err != nil {
+		log.Printf("[PUSH ] could not make the request: %v", err)
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := waziupClient.Do(req)
+	if err != nil {
+		log.Printf("[PUSH ] did not receive a response from Waziup Server: %v", err)
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return resp.StatusCode, fmt.Errorf("waziup api error (%v): %v \n\tAPI path: %v", resp.StatusCode, resp.Status, apiPath)
+	}
+
+	return resp.StatusCode, nil
+}
+
+/*--------------*/
+
+func PushLocationToWaziup(ctx context.Context, apiURL string, token string, deviceId string, latitude float64, longitude float64) (int, error) {
+
+	apiPath := fmt.Sprintf(apiURL+`devices/%s/location`, deviceId)
+
+	postBody, err := json.Marshal(map[string]interface{}{
+		"latitude":  latitude,
+		"longitude": longitude,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	/*--------*/
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", apiPath, bytes.NewBuffer(postBody))
+	if err != nil {
+		log.Printf("[PUSH ] could not make the request: %v", err)
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := waziupClient.Do(req)
+	if err != nil {
+		log.Printf("[PUSH ] did not receive a response from Waziup Server: %v", err)
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		return resp.StatusCode, fmt.Errorf("waziup api error (%v): %v \n\tAPI path: %v", resp.StatusCode, resp.Status, apiPath)
+	}
+
+	return resp.StatusCode, nil
+}
+
+/*--------------*/
+
+func RefreshWaziupToken(userId int64) (string, error) {
+
+	user, err := api.GetUserById(userId)
+	if err != nil {
+		return "", err
+	}
+
+	newToken, err := api.CheckUserCredentials(user.Username, user.Password)
+	if err != nil {
+		return "", err
+	}
+
+	user.Token = newToken
+	user.TokenHash = ""
+
+	err = api.SaveUserInfo(user)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Token, nil
+}
+
+/*--------------*/
@@ -0,0 +1,154 @@
+package datapush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/*--------------*/
+
+const defaultWebhookTimeout = 30 // seconds
+
+// webhookConfig is the `target_config` of the webhook targets
+type webhookConfig struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`  // Default is POST
+	Headers map[string]string `json:"headers"` // e.g. an API key of the receiving service
+	Body    string            `json:"body"`    // A text/template of the body, default is the value as JSON
+	Timeout int               `json:"timeout"` // In seconds
+}
+
+// webhookTarget sends each value in an HTTP request to any service
+type webhookTarget struct {
+	url     string
+	method  string
+	headers map[string]string
+	body    *template.Template // nil for the default body
+	client  *http.Client
+}
+
+// The functions available in the body templates, e.g. `{"temp": {{json .Value}}, "at": {{unix .Timestamp}}}`
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	"unix": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+func newWebhookTarget(userId int64, config json.RawMessage) (PushTarget, error) {
+
+	var conf webhookConfig
+	if err := decodeTargetConfig(config, &conf); err != nil {
+		return nil, err
+	}
+
+	targetURL, err := url.Parse(conf.URL)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+		return nil, fmt.Errorf("invalid target config: `url` has to be an http(s) URL")
+	}
+	if err := checkTargetHost(targetURL.Hostname()); err != nil {
+		return nil, fmt.Errorf("invalid target config: `url`: %v", err)
+	}
+
+	method := strings.ToUpper(conf.Method)
+	switch method {
+	case "":
+		method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("invalid target config: `method` has to be POST, PUT or PATCH")
+	}
+
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	target := &webhookTarget{
+		url:     conf.URL,
+		method:  method,
+		headers: conf.Headers,
+		client:  &http.Client{Timeout: time.Duration(timeout) * time.Second, Transport: targetTransport},
+	}
+
+	if conf.Body != "" {
+		target.body, err = template.New("body").Funcs(webhookTemplateFuncs).Parse(conf.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target config: `body`: %v", err)
+		}
+
+		// The unknown fields only show up when the template runs
+		sample := PushValue{Value: 21.5, Timestamp: time.Now()}
+		if _, err := target.renderBody(sample); err != nil {
+			return nil, fmt.Errorf("invalid target config: `body`: %v", err)
+		}
+	}
+
+	return target, nil
+}
+
+// renderBody builds the body of the request of a value
+func (t *webhookTarget) renderBody(value PushValue) ([]byte, error) {
+
+	if t.body == nil {
+		return json.Marshal(value)
+	}
+
+	var body bytes.Buffer
+	if err := t.body.Execute(&body, value); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+func (t *webhookTarget) Push(ctx context.Context, value PushValue) error {
+
+	body, err := t.renderBody(value)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, headerValue := range t.headers {
+		req.Header.Set(name, headerValue)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook error (%v): %v \n\tURL: %v", resp.StatusCode, resp.Status, t.url)
+	}
+
+	return nil
+}
+
+func (t *webhookTarget) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+/*--------------*/
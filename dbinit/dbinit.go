@@ -15,21 +15,26 @@ import (
  */
 func DatabaseInit() {
 
-	if !NeedToInitDB() {
-		return
+	if NeedToInitDB() {
+
+		log.Printf("Database initialization started.")
+		log.Printf("\tCreating Tables and Indices...")
+
+		err := CreateTables()
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Done")
+
+		log.Printf("Database initialization Done.\n\n")
 	}
 
 	/*--------------*/
-	log.Printf("Database initialization started.")
-	log.Printf("\tCreating Tables and Indices...")
 
-	err := CreateTables()
+	err := MigrateTables()
 	if err != nil {
 		panic(err)
 	}
-	log.Printf("Done")
-
-	log.Printf("Database initialization Done.\n\n")
 }
 
 /*--------------------------------*/
@@ -0,0 +1,270 @@
+package dbinit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/datacollection"
+	"sensor-data-simulator/global"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*--------------------------------*/
+
+// SeedSource is the source of the seeded channels, it is never fetched
+const SeedSource = "seed"
+
+const (
+	defaultSeedChannels = 100
+	defaultSeedDays     = 7
+	seedInterval        = 15 * time.Minute // between two entries of a seeded channel
+	seedMaxFields       = 8                // like on ThingSpeak
+)
+
+/*--------------------------------*/
+
+// How the values of a quantity are generated: a daily cycle around a base value,
+// a slow random walk and some noise, kept in the physical range
+type seriesModel struct {
+	FieldName string
+	Base      float64
+	Daily     float64 // the amplitude of the daily cycle, it peaks in the afternoon (negative: peaks at night)
+	Walk      float64 // the step of the random walk
+	Noise     float64
+	Min, Max  float64
+	Decimals  int
+	Kind      string // empty for the usual series, `daylight` (only during the day), `rain`, `counter` or `battery`
+}
+
+var seriesModels = map[string]seriesModel{
+	"temperature":       {FieldName: "Temperature (°C)", Base: 18, Daily: 5, Walk: 0.15, Noise: 0.2, Min: -40, Max: 55, Decimals: 1},
+	"relative_humidity": {FieldName: "Humidity (%)", Base: 65, Daily: -15, Walk: 0.5, Noise: 1, Min: 5, Max: 100, Decimals: 1},
+	"dew_point":         {FieldName: "Dew Point (°C)", Base: 10, Daily: 1, Walk: 0.1, Noise: 0.2, Min: -40, Max: 35, Decimals: 1},
+	"pressure":          {FieldName: "Pressure (hPa)", Base: 1013, Daily: 0.5, Walk: 0.2, Noise: 0.1, Min: 950, Max: 1050, Decimals: 1},
+	"pm1":               {FieldName: "PM1.0 (ug/m3)", Base: 8, Daily: -3, Walk: 0.8, Noise: 1, Min: 0, Max: 500, Decimals: 0},
+	"pm25":              {FieldName: "PM2.5 (ug/m3)", Base: 15, Daily: -5, Walk: 1, Noise: 2, Min: 0, Max: 500, Decimals: 0},
+	"pm10":              {FieldName: "PM10 (ug/m3)", Base: 25, Daily: -8, Walk: 1.5, Noise: 3, Min: 0, Max: 800, Decimals: 0},
+	"co2":               {FieldName: "CO2 (ppm)", Base: 600, Daily: 150, Walk: 10, Noise: 15, Min: 400, Max: 5000, Decimals: 0},
+	"co":                {FieldName: "CO (ppm)", Base: 2, Daily: 1, Walk: 0.1, Noise: 0.2, Min: 0, Max: 100, Decimals: 1},
+	"tvoc":              {FieldName: "TVOC (ppb)", Base: 150, Daily: 50, Walk: 5, Noise: 10, Min: 0, Max: 5000, Decimals: 0},
+	"soil_moisture":     {FieldName: "Soil Moisture (%)", Base: 40, Daily: -2, Walk: 0.3, Noise: 0.3, Min: 0, Max: 100, Decimals: 1},
+	"battery_voltage":   {FieldName: "Battery (V)", Base: 4.1, Noise: 0.01, Min: 3.3, Max: 4.2, Decimals: 2, Kind: "battery"},
+	"battery_level":     {FieldName: "Battery (%)", Base: 95, Noise: 0.2, Min: 5, Max: 100, Decimals: 0, Kind: "battery"},
+	"rainfall":          {FieldName: "Rain (mm)", Base: 0, Noise: 0, Min: 0, Max: 50, Decimals: 1, Kind: "rain"},
+	"wind_speed":        {FieldName: "Wind Speed (m/s)", Base: 3, Daily: 1.5, Walk: 0.4, Noise: 0.8, Min: 0, Max: 40, Decimals: 1},
+	"wind_direction":    {FieldName: "Wind Direction", Base: 180, Walk: 10, Noise: 15, Min: 0, Max: 359, Decimals: 0},
+	"light":             {FieldName: "Light (lux)", Base: 0, Daily: 40000, Walk: 500, Noise: 300, Min: 0, Max: 120000, Decimals: 0, Kind: "daylight"},
+	"uv_index":          {FieldName: "UV Index", Base: 0, Daily: 8, Walk: 0.1, Noise: 0.1, Min: 0, Max: 14, Decimals: 1, Kind: "daylight"},
+	"water_level":       {FieldName: "Water Level (cm)", Base: 120, Walk: 1, Noise: 0.5, Min: 0, Max: 400, Decimals: 1},
+	"ph":                {FieldName: "pH", Base: 7, Walk: 0.02, Noise: 0.02, Min: 4, Max: 10, Decimals: 2},
+	"turbidity":         {FieldName: "Turbidity (NTU)", Base: 5, Walk: 0.3, Noise: 0.5, Min: 0, Max: 1000, Decimals: 1},
+	"voltage":           {FieldName: "Voltage (V)", Base: 230, Daily: -3, Walk: 0.5, Noise: 0.5, Min: 200, Max: 250, Decimals: 1},
+	"current":           {FieldName: "Current (A)", Base: 3, Daily: 2, Walk: 0.3, Noise: 0.2, Min: 0, Max: 60, Decimals: 2},
+	"power":             {FieldName: "Power (W)", Base: 500, Daily: 400, Walk: 30, Noise: 40, Min: 0, Max: 10000, Decimals: 0},
+	"energy":            {FieldName: "Energy (kWh)", Base: 0.12, Daily: 0.1, Noise: 0.02, Min: 0, Max: 10, Decimals: 2, Kind: "counter"},
+	"frequency":         {FieldName: "Frequency (Hz)", Base: 50, Walk: 0.01, Noise: 0.01, Min: 49.5, Max: 50.5, Decimals: 2},
+	"heart_rate":        {FieldName: "Heart Rate (bpm)", Base: 70, Daily: 10, Walk: 1, Noise: 3, Min: 40, Max: 180, Decimals: 0},
+	"weight":            {FieldName: "Weight (kg)", Base: 40, Daily: 0.3, Walk: 0.05, Noise: 0.05, Min: 0, Max: 200, Decimals: 2},
+	"noise":             {FieldName: "Noise (dB)", Base: 45, Daily: 12, Walk: 1, Noise: 3, Min: 20, Max: 120, Decimals: 0},
+	"signal_strength":   {FieldName: "RSSI (dBm)", Base: -70, Walk: 1, Noise: 3, Min: -120, Max: -30, Decimals: 0},
+	"distance":          {FieldName: "Distance (cm)", Base: 100, Walk: 2, Noise: 1, Min: 2, Max: 400, Decimals: 0},
+	"altitude":          {FieldName: "Altitude (m)", Base: 100, Walk: 0.5, Noise: 0.5, Min: -100, Max: 9000, Decimals: 1},
+}
+
+// The channels that do not tell what they measure get a weather station
+var defaultSeedQuantities = []string{"temperature", "relative_humidity"}
+
+/*--------------------------------*/
+
+// NeedToSeed tells if the database has no channel yet
+func NeedToSeed() bool {
+
+	rows, err := global.DB.Query(`SELECT "id" FROM "channels" LIMIT 1`, database.QueryParams{})
+	if err != nil {
+		log.Printf("Error in db query: %v", err)
+		return false
+	}
+	return len(rows) == 0
+}
+
+/*--------------------------------*/
+
+// SeedDatabase fills the database with the channels of the given ThingSpeak channel list (e.g. `ui/extTools/data.json`)
+// and generates days of synthetic values for them from what their name and description tell, for at most channelsCount channels.
+// Seeding again adds the values up to now, the channels that are collected from a real source are left alone
+func SeedDatabase(channelList []byte, channelsCount int, days int) error {
+
+	channels, err := datacollection.ParseThingSpeakChannels(channelList)
+	if err != nil {
+		return err
+	}
+
+	if channelsCount <= 0 {
+		channelsCount = defaultSeedChannels
+	}
+	if days <= 0 {
+		days = defaultSeedDays
+	}
+
+	end := time.Now().UTC().Truncate(seedInterval)
+	start := end.Add(-time.Duration(days) * 24 * time.Hour)
+
+	// The channels that tell what they measure go first
+	type seedChannel struct {
+		Channel    datacollection.Channel
+		Quantities []string
+	}
+	var described, others []seedChannel
+	for _, rec := range channels {
+		if quantities := datacollection.QuantitiesInText(rec.Name + "\n" + rec.Description); len(quantities) > 0 {
+			described = append(described, seedChannel{rec, quantities})
+		} else {
+			others = append(others, seedChannel{rec, defaultSeedQuantities})
+		}
+	}
+
+	seeded := 0
+	totalValues := int64(0)
+	for _, ch := range append(described, others...) {
+
+		if seeded >= channelsCount {
+			break
+		}
+
+		existing, err := global.DB.Load("channels", database.RowType{"id": ch.Channel.Id})
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 && existing[0]["source"] != SeedSource {
+			continue
+		}
+
+		newValues, _, err := datacollection.ImportChannel(ch.Channel, SeedSource, 0, 0, seedFeed(ch.Channel, ch.Quantities, start, end))
+		if err != nil {
+			return fmt.Errorf("channel %v: %v", ch.Channel.Id, err)
+		}
+
+		seeded++
+		totalValues += newValues
+		fmt.Printf("\r\tSeeded channels: %-5d values: %-10d", seeded, totalValues)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+/*--------------------------------*/
+
+// seedFeed generates the entries of a channel between start and end
+func seedFeed(rec datacollection.Channel, quantities []string, start time.Time, end time.Time) datacollection.Feed {
+
+	channelId, _ := strconv.ParseInt(rec.Id, 10, 64)
+	rnd := rand.New(rand.NewSource(channelId))
+
+	var models []seriesModel
+	for _, q := range quantities {
+		if model, ok := seriesModels[q]; ok && len(models) < seedMaxFields {
+			models = append(models, adaptModel(q, model, rec))
+		}
+	}
+
+	feed := datacollection.Feed{ChannelId: rec.Id}
+	for _, model := range models {
+		feed.Fields = append(feed.Fields, model.FieldName)
+	}
+
+	// The daily cycles follow the sun of the channel
+	longitude, _ := strconv.ParseFloat(strings.TrimSpace(rec.Longitude), 64)
+
+	walks := make([]float64, len(models))
+	levels := make([]float64, len(models))
+	for i, model := range models {
+		levels[i] = model.Base
+	}
+
+	// The entry ids come from the time, so seeding again continues the series
+	entryId := int64(0)
+	for t := start; !t.After(end); t = t.Add(seedInterval) {
+
+		entryId = t.Unix() / int64(seedInterval/time.Second)
+
+		localHour := float64(t.Hour()) + float64(t.Minute())/60 + longitude/15
+		daily := math.Cos(2 * math.Pi * (localHour - 15) / 24) // 1 at 15:00, -1 at 3:00
+		daylight := math.Max(0, math.Cos(2*math.Pi*(localHour-13)/24)*1.4-0.4)
+
+		entry := datacollection.FeedEntry{EntryId: entryId, CreatedAt: t}
+		for i, model := range models {
+
+			// Mean-reverting random walk, so the series drift but stay around their base
+			walks[i] = walks[i]*0.98 + rnd.NormFloat64()*model.Walk
+
+			var value float64
+			switch model.Kind {
+
+			case "rain":
+				if rnd.Float64() < 0.03 {
+					levels[i] = rnd.ExpFloat64() * 2 // a shower
+				} else {
+					levels[i] *= 0.5
+				}
+				value = levels[i]
+				if value < 0.1 {
+					value = 0
+				}
+
+			case "counter":
+				levels[i] += math.Max(0, model.Base+model.Daily*daily+rnd.NormFloat64()*model.Noise) / 4 // per quarter hour
+				value = levels[i]
+
+			case "battery":
+				levels[i] -= (model.Base - model.Min) / (60 * 24 * 4) // empty in 60 days
+				if levels[i] <= model.Min {
+					levels[i] = model.Base // recharged
+				}
+				value = levels[i] + rnd.NormFloat64()*model.Noise
+
+			default:
+				value = model.Base + model.Daily*daily + walks[i] + rnd.NormFloat64()*model.Noise
+				if model.Kind == "daylight" {
+					value = model.Base + (model.Daily+walks[i]+rnd.NormFloat64()*model.Noise)*daylight // dark at night
+				}
+			}
+
+			if model.Kind != "counter" {
+				value = math.Max(model.Min, math.Min(model.Max, value))
+			}
+			entry.Values = append(entry.Values, strconv.FormatFloat(value, 'f', model.Decimals, 64))
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	feed.LastEntryId = entryId
+	return feed
+}
+
+/*--------------------------------*/
+
+// adaptModel changes the base of the model to where the channel is, e.g. the temperature by its latitude
+func adaptModel(quantity string, model seriesModel, rec datacollection.Channel) seriesModel {
+
+	latitude, _ := strconv.ParseFloat(strings.TrimSpace(rec.Latitude), 64)
+	elevation, _ := strconv.ParseFloat(strings.TrimSpace(rec.Elevation), 64)
+
+	switch quantity {
+	case "temperature":
+		model.Base = 28 - 0.35*math.Abs(latitude) - elevation*0.0065
+	case "dew_point":
+		model.Base = 20 - 0.3*math.Abs(latitude) - elevation*0.002
+	case "pressure":
+		model.Base = 1013 - elevation/8.3
+		model.Min, model.Max = model.Base-60, model.Base+40
+	}
+	return model
+}
+
+/*--------------------------------*/
@@ -3,6 +3,7 @@ package global
 import (
 	"os"
 	"sensor-data-simulator/database"
+	"sync"
 	"time"
 )
 
@@ -12,19 +13,62 @@ var DB *database.Database // initiated in the main package
 
 const RowsPerPage = 200 // This is the number of rows that APIs show per page
 
-const MaxNumGoRoutines = 64 // Max number of concurent threads (mostly for data collection)
+const MaxNumGoRoutines = 64 // Default number of concurent workers (mostly for data collection)
 
 /*-------------*/
 
-var DataCollectorProgress struct {
+// DataCollectorStatus is a snapshot of the data collector state
+type DataCollectorStatus struct {
 	ChannelsRunning bool
 	SensorsRunning  bool
 	SensorsProgress int
+	QualityRunning  bool
+	Trigger         string // What started the current (or the last) run: `schedule` or `api`
 
 	NewExtractedChannels     int64
 	NewExtractedSensors      int64
 	NewExtractedSensorValues int64
+	NewFlaggedValues         int64
+	NewClassifiedSensors     int64
 	LastExtractionTime       time.Time
+
+	// When the stages are scheduled to run next, NextRunTime is the earliest of them
+	NextDiscoveryTime time.Time
+	NextRefreshTime   time.Time
+	NextRunTime       time.Time
+
+	// Outbound requests of the current run
+	RetriedRequests   int64
+	AbandonedRequests int64
+
+	// Channels or pages of the current run that could not be processed
+	Errors    int64
+	LastError string
+}
+
+// CollectorProgress is updated by many goroutines of the collector at the same time,
+// so the state is only accessible through its methods
+type CollectorProgress struct {
+	mu     sync.RWMutex
+	status DataCollectorStatus
+}
+
+var DataCollectorProgress CollectorProgress
+
+// Update changes the state, e.g. DataCollectorProgress.Update(func(s *DataCollectorStatus) { s.Errors++ })
+func (p *CollectorProgress) Update(change func(status *DataCollectorStatus)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	change(&p.status)
+}
+
+// Status returns a copy of the current state
+func (p *CollectorProgress) Status() DataCollectorStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.status
 }
 
 /*-------------*/
@@ -32,12 +76,32 @@ var DataCollectorProgress struct {
 var ENV struct {
 	SERVING_ADDR             string
 	DATA_EXTRACTION_INTERVAL string
+	DATA_SOURCES             string
+	COLLECTION_DISCOVER_CRON string
+	COLLECTION_REFRESH_CRON  string
+	THINGSPEAK_API_URL       string
+	THINGSPEAK_FIXTURE_DIR   string
+	BACKFILL_HORIZON_DAYS    string
+	BACKFILL_ON_DISCOVERY    string
+	COLLECTION_RATE_LIMIT    string
+	COLLECTION_HTTP_TIMEOUT  string
+	COLLECTION_MAX_RETRIES   string
+	COLLECTION_WORKERS       string
+	SEED_ON_EMPTY            string
+	SEED_CHANNELS            string
+	SEED_DAYS                string
+	INSTANCE_ID              string
+	LEADER_LEASE_SECONDS     string
 	POSTGRES_DB              string
 	POSTGRES_USER            string
 	POSTGRES_PASSWORD        string
 	POSTGRES_PORT            string
 	POSTGRES_HOST            string
 	WAZIUP_API_PATH          string
+	PUSH_FILE_DIR            string
+	ADMIN_USERS              string
+	PUSH_ALLOWED_HOSTS       string
+	WAZIUP_API_URLS          string
 }
 
 /*-------------*/
@@ -46,24 +110,34 @@ func init() {
 
 	/*----------*/
 
-	DataCollectorProgress.ChannelsRunning = false
-	DataCollectorProgress.SensorsRunning = false
-	DataCollectorProgress.SensorsProgress = 0
-
-	DataCollectorProgress.NewExtractedChannels = 0
-	DataCollectorProgress.NewExtractedSensors = 0
-	DataCollectorProgress.NewExtractedSensorValues = 0
-
-	/*----------*/
-
 	ENV.SERVING_ADDR = os.Getenv("SERVING_ADDR")
 	ENV.DATA_EXTRACTION_INTERVAL = os.Getenv("DATA_EXTRACTION_INTERVAL")
+	ENV.DATA_SOURCES = os.Getenv("DATA_SOURCES")
+	ENV.COLLECTION_DISCOVER_CRON = os.Getenv("COLLECTION_DISCOVER_CRON")
+	ENV.COLLECTION_REFRESH_CRON = os.Getenv("COLLECTION_REFRESH_CRON")
+	ENV.THINGSPEAK_API_URL = os.Getenv("THINGSPEAK_API_URL")
+	ENV.THINGSPEAK_FIXTURE_DIR = os.Getenv("THINGSPEAK_FIXTURE_DIR")
+	ENV.BACKFILL_HORIZON_DAYS = os.Getenv("BACKFILL_HORIZON_DAYS")
+	ENV.BACKFILL_ON_DISCOVERY = os.Getenv("BACKFILL_ON_DISCOVERY")
+	ENV.COLLECTION_RATE_LIMIT = os.Getenv("COLLECTION_RATE_LIMIT")
+	ENV.COLLECTION_HTTP_TIMEOUT = os.Getenv("COLLECTION_HTTP_TIMEOUT")
+	ENV.COLLECTION_MAX_RETRIES = os.Getenv("COLLECTION_MAX_RETRIES")
+	ENV.COLLECTION_WORKERS = os.Getenv("COLLECTION_WORKERS")
+	ENV.SEED_ON_EMPTY = os.Getenv("SEED_ON_EMPTY")
+	ENV.SEED_CHANNELS = os.Getenv("SEED_CHANNELS")
+	ENV.SEED_DAYS = os.Getenv("SEED_DAYS")
+	ENV.INSTANCE_ID = os.Getenv("INSTANCE_ID")
+	ENV.LEADER_LEASE_SECONDS = os.Getenv("LEADER_LEASE_SECONDS")
 	ENV.POSTGRES_DB = os.Getenv("POSTGRES_DB")
 	ENV.POSTGRES_USER = os.Getenv("POSTGRES_USER")
 	ENV.POSTGRES_PASSWORD = os.Getenv("POSTGRES_PASSWORD")
 	ENV.POSTGRES_PORT = os.Getenv("POSTGRES_PORT")
 	ENV.POSTGRES_HOST = os.Getenv("POSTGRES_HOST")
 	ENV.WAZIUP_API_PATH = os.Getenv("WAZIUP_API_PATH")
+	ENV.PUSH_FILE_DIR = os.Getenv("PUSH_FILE_DIR")
+	ENV.ADMIN_USERS = os.Getenv("ADMIN_USERS")
+	ENV.PUSH_ALLOWED_HOSTS = os.Getenv("PUSH_ALLOWED_HOSTS")
+	ENV.WAZIUP_API_URLS = os.Getenv("WAZIUP_API_URLS")
 
 	/*----------*/
 }
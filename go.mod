@@ -3,6 +3,7 @@ module sensor-data-simulator
 go 1.16
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/influxdata/influxdb-client-go/v2 v2.3.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.2
@@ -0,0 +1,274 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sensor-data-simulator/database"
+	"sensor-data-simulator/global"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*--------------------------------*/
+
+// The background subsystems that only one instance runs at a time, each one has its own lease
+const (
+	Collection = "collection"
+	Push       = "push"
+)
+
+// The default duration of a lease, a standby takes over at most this long after the leader is gone
+const defaultLeaseDuration = 30 * time.Second
+
+// Lease is the leadership of a subsystem, as stored in the `leader_leases` table
+type Lease struct {
+	Name       string
+	Holder     string
+	AcquiredAt time.Time
+	RenewedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+/*--------------------------------*/
+
+// leaderWG keeps track of the subsystems started with Start, so the shutdown can wait for them
+var leaderWG sync.WaitGroup
+
+// leading keeps the leases that this instance holds at the moment
+var leading struct {
+	sync.RWMutex
+	names map[string]bool
+}
+
+var instanceId struct {
+	sync.Once
+	id string
+}
+
+/*--------------------------------*/
+
+// InstanceId identifies this instance in the leases, it is `INSTANCE_ID` or the host name with the process id
+func InstanceId() string {
+
+	instanceId.Do(func() {
+		instanceId.id = global.ENV.INSTANCE_ID
+		if instanceId.id == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				hostname = "instance"
+			}
+			instanceId.id = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+	})
+
+	return instanceId.id
+}
+
+// IsLeader tells if this instance holds the lease of the given subsystem
+func IsLeader(name string) bool {
+
+	leading.RLock()
+	defer leading.RUnlock()
+
+	return leading.names[name]
+}
+
+func setLeader(name string, isLeader bool) {
+
+	leading.Lock()
+	defer leading.Unlock()
+
+	if leading.names == nil {
+		leading.names = make(map[string]bool)
+	}
+	leading.names[name] = isLeader
+}
+
+/*--------------------------------*/
+
+// Start runs the given subsystem in the background whenever this instance holds its lease (see Run)
+func Start(ctx context.Context, name string, run func(ctx context.Context)) {
+
+	leaderWG.Add(1)
+	go func() {
+		defer leaderWG.Done()
+		Run(ctx, name, run)
+	}()
+}
+
+// Wait blocks until all the subsystems started with Start have stopped (i.e. after their context is cancelled)
+func Wait() {
+	leaderWG.Wait()
+}
+
+/*--------------------------------*/
+
+// Run competes for the lease of the given subsystem until the context is cancelled.
+// While this instance holds the lease, the subsystem runs with a context that is cancelled as soon as the lease is lost,
+// so it has to return once its context is done. The standby instances try to take over every third of the lease duration
+func Run(ctx context.Context, name string, run func(ctx context.Context)) {
+
+	duration := leaseDuration()
+
+	for {
+
+		acquired, err := renewLease(name, duration)
+		if err != nil {
+			log.Printf("[LEAD ] Error in acquiring the `%v` lease: %v", name, err)
+		}
+
+		if acquired {
+			log.Printf("[LEAD ] `%v` is the leader of `%v`", InstanceId(), name)
+			lead(ctx, name, duration, run)
+
+			if ctx.Err() != nil {
+				releaseLease(name)
+				return
+			}
+			log.Printf("[LEAD ] `%v` lost the leadership of `%v`", InstanceId(), name)
+		}
+
+		timer := time.NewTimer(duration / 3)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// lead runs the subsystem and renews its lease until the lease is lost or the context is cancelled
+func lead(ctx context.Context, name string, duration time.Duration, run func(ctx context.Context)) {
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	setLeader(name, true)
+	defer setLeader(name, false)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(leadCtx)
+	}()
+
+	// The lease is valid until this time as far as this instance knows
+	validUntil := time.Now().Add(duration)
+
+	// The subsystem is cancelled when the lease expires, so the work still in flight (e.g. a slow request)
+	// does not go on once a standby may have taken over. The deadline moves with each renewal
+	expiry := time.AfterFunc(duration, cancel)
+	defer expiry.Stop()
+
+	ticker := time.NewTicker(duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ticker.C:
+			renewStart := time.Now()
+			renewed, err := renewLease(name, duration)
+			if err != nil {
+				log.Printf("[LEAD ] Error in renewing the `%v` lease: %v", name, err)
+
+				// It steps down before a standby may take over, even if the database is only unreachable
+				if time.Until(validUntil) > duration/3 {
+					continue
+				}
+			}
+			if !renewed {
+				cancel()
+				<-done
+				return
+			}
+			validUntil = renewStart.Add(duration)
+			expiry.Reset(time.Until(validUntil))
+
+		case <-done:
+			return // The subsystem stopped, e.g. the context is cancelled
+
+		case <-ctx.Done():
+			<-done
+			return
+		}
+	}
+}
+
+/*--------------------------------*/
+
+// renewLease takes the lease if it is free or expired, or extends it if this instance already holds it.
+// The times come from the database, so the clocks of the instances do not need to agree
+func renewLease(name string, duration time.Duration) (bool, error) {
+
+	SQL := `INSERT INTO "leader_leases" ("name", "holder", "acquired_at", "renewed_at", "expires_at")
+			VALUES ($1, $2, timezone('UTC', now()), timezone('UTC', now()), timezone('UTC', now()) + $3::double precision * interval '1 second')
+			ON CONFLICT ("name") DO UPDATE SET
+				"holder" = EXCLUDED."holder",
+				"acquired_at" = CASE WHEN "leader_leases"."holder" = EXCLUDED."holder" THEN "leader_leases"."acquired_at" ELSE EXCLUDED."acquired_at" END,
+				"renewed_at" = EXCLUDED."renewed_at",
+				"expires_at" = EXCLUDED."expires_at"
+			WHERE
+				"leader_leases"."holder" = EXCLUDED."holder" OR
+				"leader_leases"."expires_at" < EXCLUDED."renewed_at"
+			RETURNING "holder"`
+
+	rows, err := global.DB.Query(SQL, database.QueryParams{name, InstanceId(), duration.Seconds()})
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0, nil
+}
+
+// releaseLease gives the lease up on shutdown, so a standby takes over right away
+func releaseLease(name string) {
+
+	SQL := `DELETE FROM "leader_leases" WHERE "name" = $1 AND "holder" = $2`
+	if _, err := global.DB.Exec(SQL, database.QueryParams{name, InstanceId()}); err != nil {
+		log.Printf("[LEAD ] Error in releasing the `%v` lease: %v", name, err)
+	}
+}
+
+/*--------------------------------*/
+
+// GetLeases returns the leases that are not expired, i.e. which instance leads each subsystem
+func GetLeases() ([]Lease, error) {
+
+	SQL := `SELECT * FROM "leader_leases" WHERE "expires_at" >= timezone('UTC', now()) ORDER BY "name" ASC`
+	rows, err := global.DB.Query(SQL, database.QueryParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]Lease, 0, len(rows))
+	for _, row := range rows {
+		lease := Lease{}
+		lease.Name, _ = row["name"].(string)
+		lease.Holder, _ = row["holder"].(string)
+		lease.AcquiredAt, _ = row["acquired_at"].(time.Time)
+		lease.RenewedAt, _ = row["renewed_at"].(time.Time)
+		lease.ExpiresAt, _ = row["expires_at"].(time.Time)
+		leases = append(leases, lease)
+	}
+
+	return leases, nil
+}
+
+/*--------------------------------*/
+
+func leaseDuration() time.Duration {
+
+	seconds, err := strconv.Atoi(global.ENV.LEADER_LEASE_SECONDS)
+	if err != nil || seconds < 3 {
+		return defaultLeaseDuration
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+/*--------------------------------*/
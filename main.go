@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
 	"sensor-data-simulator/api"
 	"sensor-data-simulator/database"
 	"sensor-data-simulator/datacollection"
 	"sensor-data-simulator/datapush"
 	"sensor-data-simulator/dbinit"
 	"sensor-data-simulator/global"
+	"sensor-data-simulator/leader"
+	"syscall"
 )
 
+// The channels that the database is seeded with, so it works without internet
+//
+//go:embed ui/extTools/data.json
+var seedChannels []byte
+
 func main() {
 
 	psqlconn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
@@ -29,13 +41,45 @@ func main() {
 
 	/*--------*/
 
-	datapush.Init()
+	// The commands do their job on the database and exit, e.g. `app seed`
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			log.Fatalf("Unknown command `%v`", os.Args[1])
+		}
+		if err := command(os.Args[2:]); err != nil {
+			log.Fatalf("Error in `%v`: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	if global.ENV.SEED_ON_EMPTY != "false" && dbinit.NeedToSeed() {
+
+		log.Printf("The database is empty, seeding it with synthetic data...")
+		if err := dbinit.SeedDatabase(seedChannels, envInt(global.ENV.SEED_CHANNELS), envInt(global.ENV.SEED_DAYS)); err != nil {
+			log.Printf("Error in seeding the database: %v", err)
+		}
+	}
+
+	/*--------*/
+
+	// Everything stops gracefully on SIGINT / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	/*--------*/
 
-	datacollection.Init()
+	// With several instances, only the leader of each subsystem runs it, the others stand by
+	leader.Start(ctx, leader.Push, datapush.Run)
+
+	leader.Start(ctx, leader.Collection, datacollection.Run)
 
 	/*--------*/
 
-	api.ListenAndServeHTTP()
+	api.ListenAndServeHTTP(ctx)
+
+	log.Printf("Shutting down...")
+	leader.Wait()
 }
 
 /*--------------------------------*/
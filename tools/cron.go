@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*------------------------------*/
+
+// CronSchedule is a standard 5 fields cron expression: minute hour day-of-month month day-of-week
+//
+// Each field accepts `*`, numbers, ranges (`1-5`), lists (`1,15`) and steps (`*/10`, `8-18/2`),
+// the months and the days of the week also accept their names (`jan`, `mon`, ...) and Sunday is either 0 or 7.
+// The macros `@hourly`, `@daily` (or `@midnight`), `@weekly`, `@monthly` and `@yearly` are also accepted.
+// Like cron, if both the day-of-month and the day-of-week are restricted, a day matching either of them is taken.
+// The times that do not exist when the clocks go forward are skipped, and the times of the hour repeated
+// when they go back only match once, unless every hour matches.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bitsets of the allowed values
+
+	domRestricted, dowRestricted bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+const allCronHours = 1<<24 - 1
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+/*------------------------------*/
+
+func ParseCron(expr string) (*CronSchedule, error) {
+
+	expr = strings.TrimSpace(strings.ToLower(expr))
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("a cron expression needs 5 fields, got %d: `%v`", len(fields), expr)
+	}
+
+	var s CronSchedule
+	var err error
+
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+
+	// Sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("`%v` never matches", expr)
+	}
+
+	return &s, nil
+}
+
+/*------------------------------*/
+
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in `%v`", part)
+			}
+			rangePart = part[:i]
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+			if start, err = parseCronValue(bounds[0], min, max, names); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = max // e.g. `5/15` means from 5 to the end every 15
+			}
+
+			if start > end {
+				return 0, fmt.Errorf("invalid range `%v`", rangePart)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(value string, min int, max int, names map[string]int) (int, error) {
+
+	if n, ok := names[value]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid value `%v`, it must be between %d and %d", value, min, max)
+	}
+	return n, nil
+}
+
+/*------------------------------*/
+
+// Next returns the first time matching the schedule strictly after the given time, in its location.
+// It returns the zero time if nothing matches in the next 5 years (e.g. `0 0 30 2 *`)
+func (s *CronSchedule) Next(after time.Time) time.Time {
+
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		// The clocks went back, the same time was already shown an hour before
+		if earlier := t.Add(-time.Hour); sameWallClock(earlier, t) {
+			if earlier.After(after) {
+				return earlier
+			}
+			if s.hour != allCronHours {
+				t = t.Add(time.Minute)
+				continue
+			}
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func sameWallClock(a time.Time, b time.Time) bool {
+	return a.Day() == b.Day() && a.Hour() == b.Hour() && a.Minute() == b.Minute()
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+/*------------------------------*/
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // The DST cases do not depend on the zoneinfo of the system
+)
+
+/*------------------------------*/
+
+func TestParseCron(t *testing.T) {
+
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"*/10 * * * *", true},
+		{"0 8-18/2 * * mon-fri", true},
+		{"0,30 1,13 1,15 * *", true},
+		{"5/15 * * * *", true},
+		{"0 0 * jan,jul sun", true},
+		{"0 0 * * 7", true},
+		{"  @Daily ", true},
+		{"@hourly", true},
+		{"@midnight", true},
+
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"10-5 * * * *", false},
+		{"a * * * *", false},
+		{"* * * foo *", false},
+		{"0 0 30 2 *", false}, // Never matches
+		{"@every5m", false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCron(test.expr)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseCron(%q): error = %v, valid = %v", test.expr, err, test.valid)
+		}
+	}
+}
+
+/*------------------------------*/
+
+func TestCronScheduleNext(t *testing.T) {
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utc := func(value string) time.Time {
+		result, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	local := func(value string, offset string) time.Time {
+		result, err := time.Parse("2006-01-02 15:04 -0700", value+" "+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.In(berlin)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"every minute", "* * * * *", utc("2021-06-10 11:21"), utc("2021-06-10 11:22")},
+		{"strictly after", "30 * * * *", utc("2021-06-10 11:30"), utc("2021-06-10 12:30")},
+		{"seconds are dropped", "* * * * *", utc("2021-06-10 11:21").Add(59 * time.Second), utc("2021-06-10 11:22")},
+		{"step", "*/15 * * * *", utc("2021-06-10 11:16"), utc("2021-06-10 11:30")},
+		{"step from a value", "5/20 * * * *", utc("2021-06-10 11:26"), utc("2021-06-10 11:45")},
+		{"range with a step", "0 8-18/4 * * *", utc("2021-06-10 12:01"), utc("2021-06-10 16:00")},
+		{"list", "0 1,13 * * *", utc("2021-06-10 02:00"), utc("2021-06-10 13:00")},
+		{"next day", "0 3 * * *", utc("2021-06-10 03:00"), utc("2021-06-11 03:00")},
+
+		// Month and year boundaries
+		{"end of month", "0 0 1 * *", utc("2021-01-31 23:59"), utc("2021-02-01 00:00")},
+		{"31st skips the short months", "0 0 31 * *", utc("2021-01-31 00:00"), utc("2021-03-31 00:00")},
+		{"end of year", "0 0 * * *", utc("2021-12-31 23:30"), utc("2022-01-01 00:00")},
+		{"month name", "0 0 1 jul *", utc("2021-07-01 00:00"), utc("2022-07-01 00:00")},
+		{"leap day", "0 0 29 2 *", utc("2021-03-01 00:00"), utc("2024-02-29 00:00")},
+		{"yearly", "@yearly", utc("2021-06-10 11:21"), utc("2022-01-01 00:00")},
+
+		// Days of the week, 2021-06-10 is a Thursday
+		{"day of week", "0 9 * * mon", utc("2021-06-10 11:21"), utc("2021-06-14 09:00")},
+		{"sunday as 7", "0 9 * * 7", utc("2021-06-10 11:21"), utc("2021-06-13 09:00")},
+		{"sunday as 0", "0 9 * * 0", utc("2021-06-10 11:21"), utc("2021-06-13 09:00")},
+		{"weekdays", "0 9 * * mon-fri", utc("2021-06-11 09:00"), utc("2021-06-14 09:00")},
+		{"weekly", "@weekly", utc("2021-06-10 11:21"), utc("2021-06-13 00:00")},
+
+		// Both days restricted: either of them
+		{"day of month or of week, week first", "0 0 20 * fri", utc("2021-06-10 11:21"), utc("2021-06-11 00:00")},
+		{"day of month or of week, month first", "0 0 12 * mon", utc("2021-06-10 11:21"), utc("2021-06-12 00:00")},
+		{"only the day of month", "0 0 20 * *", utc("2021-06-10 11:21"), utc("2021-06-20 00:00")},
+		{"day of month with a step is not restricted", "0 0 */2 * fri", utc("2021-06-10 11:21"), utc("2021-06-11 00:00")},
+
+		// Europe/Berlin goes from 02:00 CET to 03:00 CEST on 2021-03-28,
+		// and back from 03:00 CEST to 02:00 CET on 2021-10-31
+		{"time zone", "0 9 * * *", local("2021-06-10 09:00", "+0200"), local("2021-06-11 09:00", "+0200")},
+		{"missing hour is skipped", "30 2 * * *", local("2021-03-28 01:00", "+0100"), local("2021-03-29 02:30", "+0200")},
+		{"every minute over the missing hour", "* * * * *", local("2021-03-28 01:59", "+0100"), local("2021-03-28 03:00", "+0200")},
+		{"after the missing hour", "0 * * * *", local("2021-03-28 01:00", "+0100"), local("2021-03-28 03:00", "+0200")},
+		{"repeated hour, first time", "30 2 * * *", local("2021-10-31 00:00", "+0200"), local("2021-10-31 02:30", "+0200")},
+		{"repeated hour runs once", "30 2 * * *", local("2021-10-31 02:30", "+0200"), local("2021-11-01 02:30", "+0100")},
+		{"every minute over the repeated hour", "* * * * *", local("2021-10-31 02:59", "+0200"), local("2021-10-31 02:00", "+0100")},
+		{"every hour over the repeated hour", "0 * * * *", local("2021-10-31 02:00", "+0200"), local("2021-10-31 02:00", "+0100")},
+	}
+
+	for _, test := range tests {
+
+		schedule, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("%v: ParseCron(%q): %v", test.name, test.expr, err)
+			continue
+		}
+
+		got := schedule.Next(test.after)
+		if !got.Equal(test.want) {
+			t.Errorf("%v: Next(%v) of %q = %v, want %v", test.name, test.after, test.expr, got, test.want)
+		}
+		if got.Location() != test.after.Location() {
+			t.Errorf("%v: Next(%v) of %q is in %v, want %v", test.name, test.after, test.expr, got.Location(), test.after.Location())
+		}
+	}
+}
+
+/*------------------------------*/
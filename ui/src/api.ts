@@ -22,6 +22,9 @@ export type DataCollectionStatus = {
   NewExtractedSensors: number;
   NewExtractedSensorValues: number;
   LastExtractionTime: Date;
+  NextDiscoveryTime: Date;
+  NextRefreshTime: Date;
+  NextRunTime: Date;
 };
 
 export async function getDataCollectionStatus(): Promise<DataCollectionStatus> {
@@ -92,6 +95,9 @@ export type SensorRow = {
   name: string;
   channel_id: number;
   channel_name: string;
+  quantity?: string | null;
+  unit?: string | null;
+  quantity_source?: string | null;
 };
 
 export type SensorsData = {
@@ -121,6 +127,12 @@ export type SensorValueRow = {
   sensor_id: number;
   name: string;
   value: string;
+  value_num: number | null;
+  value_type: string | null;
+  latitude: number | null;
+  longitude: number | null;
+  elevation: number | null;
+  status: string | null;
   created_at: Date;
 };
 
@@ -213,9 +225,20 @@ export type SensorPushSettings = {
   target_sensor_id: string;
   active: boolean;
   push_interval: number;
+  push_interval_seconds?: number;
   last_push_time?: Date;
   use_original_time?: boolean;
   pushed_count?: number;
+  skip_flagged?: boolean;
+  push_location?: boolean;
+  target_type?: string;
+  target_config?: { [key: string]: any };
+  batch_size?: number;
+  catch_up_policy?: "latest" | "batch" | "all";
+  loop?: boolean;
+  loop_start_entry_id?: number;
+  loop_start_time?: Date;
+  loop_count?: number;
 };
 
 export type AllSensorPushSettings = {
@@ -17,18 +17,20 @@ const useStyles = makeStyles((theme: Theme) =>
 /*-----------*/
 
 const marks = [
-    { value: 0, realValue: 1, label: '1m', shortLabel: '1m', },
-    { value: 5, realValue: 3, label: '3m', shortLabel: '3m', },
-    { value: 10, realValue: 5, label: '5m', shortLabel: '5m', },
-    { value: 15, realValue: 10, label: '10m', shortLabel: '10m', },
-    { value: 25, realValue: 30, label: '30 mins', shortLabel: '30m', },
-    { value: 35, realValue: 60, label: '1 hr', shortLabel: '1h', },
-    { value: 45, realValue: 2 * 60, label: '2 hrs', shortLabel: '2h', },
-    { value: 55, realValue: 3 * 60, label: '3 hrs', shortLabel: '3h', },
-    { value: 65, realValue: 5 * 60, label: '5 hrs', shortLabel: '5h', },
-    { value: 80, realValue: 24 * 60, label: '1 day', shortLabel: '1d', },
-    { value: 90, realValue: 2 * 24 * 60, label: '2 days', shortLabel: '2d', },
-    { value: 100, realValue: 3 * 24 * 60, label: '3 days', shortLabel: '3d', },
+    { value: 0, realValue: 10, label: '10s', shortLabel: '10s', },
+    { value: 5, realValue: 30, label: '30s', shortLabel: '30s', },
+    { value: 10, realValue: 60, label: '1m', shortLabel: '1m', },
+    { value: 15, realValue: 3 * 60, label: '3m', shortLabel: '3m', },
+    { value: 20, realValue: 5 * 60, label: '5m', shortLabel: '5m', },
+    { value: 25, realValue: 10 * 60, label: '10m', shortLabel: '10m', },
+    { value: 35, realValue: 30 * 60, label: '30 mins', shortLabel: '30m', },
+    { value: 45, realValue: 60 * 60, label: '1 hr', shortLabel: '1h', },
+    { value: 55, realValue: 2 * 60 * 60, label: '2 hrs', shortLabel: '2h', },
+    { value: 62, realValue: 3 * 60 * 60, label: '3 hrs', shortLabel: '3h', },
+    { value: 70, realValue: 5 * 60 * 60, label: '5 hrs', shortLabel: '5h', },
+    { value: 80, realValue: 24 * 60 * 60, label: '1 day', shortLabel: '1d', },
+    { value: 90, realValue: 2 * 24 * 60 * 60, label: '2 days', shortLabel: '2d', },
+    { value: 100, realValue: 3 * 24 * 60 * 60, label: '3 days', shortLabel: '3d', },
 ];
 
 /*-----------*/
@@ -44,9 +46,9 @@ function valueLabelFormat(value: number) {
 /*-----------*/
 
 interface Props {
-    onChange: (newValue: number) => void; // new value in minutes (realValue)
-    defaultValue?: number; // realValue in minutes
-    value?: number; // realValue in minutes
+    onChange: (newValue: number) => void; // new value in seconds (realValue)
+    defaultValue?: number; // realValue in seconds
+    value?: number; // realValue in seconds
 }
 
 /*-----------*/
@@ -64,7 +66,7 @@ export default function PushScheduleSlider(props: Props) {
         <div className={classes.root}>
 
             <Slider
-                defaultValue={props.defaultValue ? marks.find(o => o.realValue == props.defaultValue)?.value : 10}
+                defaultValue={props.defaultValue ? marks.find(o => o.realValue == props.defaultValue)?.value : 25}
                 getAriaValueText={valuetext}
                 valueLabelFormat={valueLabelFormat}
                 aria-labelledby="schedule-slider"
@@ -183,6 +183,13 @@ export default function DataTablePushSettings(props: Props) {
         return value + " minute" + (value > 1 ? "s" : "");
     }
 
+    const intervalSecondsFormat = (seconds: number): string => {
+        if (seconds % 60 === 0) {
+            return intervalFormat(seconds / 60);
+        }
+        return seconds + " second" + (seconds > 1 ? "s" : "");
+    }
+
     /**--------------- */
 
     const handleChangePage = (e: React.MouseEvent<HTMLButtonElement>, page: number) => {
@@ -266,13 +273,14 @@ export default function DataTablePushSettings(props: Props) {
                                 }
                             </StyledTableCell>
                             <StyledTableCell component="th" scope="row" >
-                                {intervalFormat(row.push_interval)}
+                                {row.push_interval_seconds ? intervalSecondsFormat(row.push_interval_seconds) : intervalFormat(row.push_interval)}
                             </StyledTableCell>
                             <StyledTableCell component="th" scope="row" >
                                 {lastPushTime}
                             </StyledTableCell>
                             <StyledTableCell component="th" scope="row" >
                                 {row?.pushed_count?.toLocaleString()}
+                                {row.loop && row.loop_count ? ` (loop ${row.loop_count + 1})` : ""}
                             </StyledTableCell>
                         </StyledTableRow>)
                     })}
@@ -57,6 +57,12 @@ export default function SensorPushSettings(props: Props) {
     }
     /**--------------- */
 
+    const [pushLocation, setPushLocation] = useState(false)
+    const handlePushLocation = (event: React.ChangeEvent<HTMLInputElement>) => {
+        setPushLocation(event.target.checked);
+    }
+    /**--------------- */
+
     const [activePush, setActivePush] = useState(true)
     const handleActiveChange = (event: React.ChangeEvent<HTMLInputElement>) => {
         setActivePush(event.target.checked);
@@ -75,8 +81,10 @@ export default function SensorPushSettings(props: Props) {
             target_sensor_id: selectedSensor.id,
             active: activePush,
             id: editMode ? recordId : 0, //default:0 means insert a new record
-            push_interval: pushInterval,
+            push_interval: Math.ceil(pushInterval / 60),
+            push_interval_seconds: pushInterval,
             use_original_time: originalTimestamp,
+            push_location: pushLocation,
         }
 
         setSavingPushSettings(true);
@@ -147,7 +155,7 @@ export default function SensorPushSettings(props: Props) {
         setSelectedSensor(val);
     }
 
-    const [pushInterval, setPushInterval] = useState(10)
+    const [pushInterval, setPushInterval] = useState(10 * 60) // in seconds
     const handleIntervalSelect = (value: number) => {
         setPushInterval(value);
     }
@@ -181,10 +189,11 @@ export default function SensorPushSettings(props: Props) {
     const handleTableRowClick = (data: API.SensorPushSettings) => {
 
         setEditMode(true);
-        setPushInterval(data.push_interval);
+        setPushInterval(data.push_interval_seconds || data.push_interval * 60);
         setActivePush(data.active);
         setRecordId(data.id);
         setOriginalTimestamp(data.use_original_time == true);
+        setPushLocation(data.push_location == true);
 
         /**--------- */
 
@@ -233,10 +242,11 @@ export default function SensorPushSettings(props: Props) {
 
         setEditMode(false);
         setSelectedSensor(null);
-        setPushInterval(10);
+        setPushInterval(10 * 60);
         setActivePush(true);
         setRecordId(0);
         setOriginalTimestamp(false);
+        setPushLocation(false);
     }
 
     /**--------------- */
@@ -308,6 +318,19 @@ export default function SensorPushSettings(props: Props) {
                 />
             </Grid>
 
+            <Grid item xs={3}>
+                <Typography gutterBottom>Push Location</Typography>
+            </Grid>
+            <Grid item xs={9}>
+                <Switch
+                    checked={pushLocation}
+                    onChange={handlePushLocation}
+                    color="primary"
+                    name="pushLocation"
+                    inputProps={{ 'aria-label': 'primary checkbox' }}
+                />
+            </Grid>
+
             <Grid item xs={12}><br /></Grid>
 
             <Grid item xs={3}></Grid>